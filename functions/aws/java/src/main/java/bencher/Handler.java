@@ -0,0 +1,36 @@
+package bencher;
+
+import com.amazonaws.services.lambda.runtime.Context;
+import com.amazonaws.services.lambda.runtime.RequestStreamHandler;
+import com.google.gson.JsonObject;
+import com.google.gson.JsonParser;
+
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.InputStreamReader;
+import java.io.OutputStream;
+import java.nio.charset.StandardCharsets;
+
+/**
+ * Lambda entry point, answers with an http api response carrying the trace as body.
+ */
+public class Handler implements RequestStreamHandler {
+
+    @Override
+    public void handleRequest(InputStream input, OutputStream output, Context context) throws IOException {
+        JsonObject event = new JsonParser().parse(new InputStreamReader(input, StandardCharsets.UTF_8)).getAsJsonObject();
+        //http api events carry the job as body, direct invocations are the job
+        JsonObject job = event.has("body") && event.get("body").isJsonPrimitive()
+                ? new JsonParser().parse(event.get("body").getAsString()).getAsJsonObject()
+                : event;
+
+        JsonObject headers = new JsonObject();
+        headers.addProperty("Content-Type", "application/json");
+        JsonObject response = new JsonObject();
+        response.addProperty("statusCode", 200);
+        response.add("headers", headers);
+        response.addProperty("body", Bencher.handle(job).toString());
+
+        output.write(response.toString().getBytes(StandardCharsets.UTF_8));
+    }
+}
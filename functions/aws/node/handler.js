@@ -0,0 +1,15 @@
+'use strict';
+
+const { Handle } = require('./bencher');
+
+module.exports.bench = async (event) => {
+  //http api events carry the job as body, direct invocations are the job
+  const job = event && typeof event.body === 'string' ? JSON.parse(event.body) : event;
+  const body = await Handle(job);
+
+  return {
+    statusCode: 200,
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body),
+  };
+};
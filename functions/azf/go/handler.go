@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"azf/bencher"
+
+	factc "github.com/faas-facts/fact-go-client"
+	log "github.com/sirupsen/logrus"
+)
+
+var client *factc.FactClient
+
+func init() {
+	client = &factc.FactClient{}
+
+	platformHint := "AZF"
+
+	client.Boot(factc.FactClientConfig{
+		SendOnUpdate:       false,
+		IncludeEnvironment: false,
+		IOArgs:             map[string]string{},
+		Platform:           &platformHint,
+	})
+}
+
+// Bench runs the job posted as body and responds with its trace, the host forwards the http request as it is
+func Bench(w http.ResponseWriter, r *http.Request) {
+	var job bencher.Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	trace := bencher.Handle(client, job, r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&trace); err != nil {
+		log.Errorf("failed to write the trace %+v", err)
+	}
+}
+
+func main() {
+	//the functions host starts the custom handler and tells it the port
+	port := os.Getenv("FUNCTIONS_CUSTOMHANDLER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	http.HandleFunc("/api/bench", Bench)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
+}
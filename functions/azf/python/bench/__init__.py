@@ -0,0 +1,15 @@
+import json
+
+import azure.functions as func
+
+from bencher import Handle
+
+def main(req: func.HttpRequest) -> func.HttpResponse:
+    try:
+        job = req.get_json()
+    except ValueError as e:
+        return func.HttpResponse(json.dumps({"error": str(e)}), status_code=400, mimetype="application/json")
+
+    body = Handle(None, job, None)
+
+    return func.HttpResponse(json.dumps(body), mimetype="application/json")
@@ -0,0 +1,12 @@
+module container
+
+go 1.13
+
+require (
+	github.com/aws/aws-sdk-go v1.37.9
+	github.com/faas-facts/fact v0.1.5
+	github.com/faas-facts/fact-go-client v0.1.8
+	github.com/google/go-cmp v0.5.4 // indirect
+	github.com/sirupsen/logrus v1.7.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
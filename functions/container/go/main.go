@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+
+	"container/bencher"
+
+	factc "github.com/faas-facts/fact-go-client"
+	log "github.com/sirupsen/logrus"
+)
+
+var client *factc.FactClient
+
+//the client keeps a single trace, so concurrent requests would mix up their traces
+var lock sync.Mutex
+
+func init() {
+	client = &factc.FactClient{}
+
+	platformHint := "container"
+
+	client.Boot(factc.FactClientConfig{
+		SendOnUpdate:       false,
+		IncludeEnvironment: false,
+		IOArgs:             map[string]string{},
+		Platform:           &platformHint,
+	})
+}
+
+// Handler runs the job posted as body and responds with its trace
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var job bencher.Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	lock.Lock()
+	trace := bencher.Handle(client, job, r.Context())
+	lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&trace); err != nil {
+		log.Errorf("failed to write the trace %+v", err)
+	}
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func main() {
+	//knative sets PORT, the openfaas watchdog is not used and the gateway forwards to 8080
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	http.HandleFunc("/", Handler)
+	http.HandleFunc("/healthz", health)
+	http.HandleFunc("/_/health", health)
+
+	log.Infof("listening on :%s", port)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
+}
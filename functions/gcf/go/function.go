@@ -0,0 +1,44 @@
+// Package function is the Google Cloud Functions entry point of the go workload.
+package function
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gcf/bencher"
+
+	factc "github.com/faas-facts/fact-go-client"
+	log "github.com/sirupsen/logrus"
+)
+
+var client *factc.FactClient
+
+func init() {
+	client = &factc.FactClient{}
+
+	platformHint := "GCF"
+
+	client.Boot(factc.FactClientConfig{
+		SendOnUpdate:       false,
+		IncludeEnvironment: false,
+		IOArgs:             map[string]string{},
+		Platform:           &platformHint,
+	})
+}
+
+// Bench runs the job posted as body and responds with its trace
+func Bench(w http.ResponseWriter, r *http.Request) {
+	var job bencher.Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	trace := bencher.Handle(client, job, r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&trace); err != nil {
+		log.Errorf("failed to write the trace %+v", err)
+	}
+}
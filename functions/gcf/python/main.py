@@ -0,0 +1,12 @@
+import json
+
+from bencher import Handle
+
+def bench(request):
+    job = request.get_json(silent=True)
+    if job is None:
+        return json.dumps({"error": "the job is missing"}), 400, {"Content-Type": "application/json"}
+
+    body = Handle(None, job, None)
+
+    return json.dumps(body), 200, {"Content-Type": "application/json"}
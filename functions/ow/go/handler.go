@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"os"
 	"ow/bencher"
 
 	factc "github.com/faas-facts/fact-go-client"
@@ -22,17 +23,30 @@ func init() {
 	})
 }
 
+// default parameters bound at deployment time that the bencher expects in its environment
+var envParams = []string{"SET_IO_KEY_ID", "SET_IO_SECRET"}
+
 // Main forwading to Hello
 func Main(args map[string]interface{}) map[string]interface{} {
-	delay := 10
-	//TODO: convert input to job
-	job := bencher.Job{
-		Idle: &delay,
+	for _, key := range envParams {
+		if value, ok := args[key].(string); ok {
+			os.Setenv(key, value)
+		}
+		delete(args, key)
+	}
+
+	var job bencher.Job
+	data, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(data, &job)
+	}
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
 	}
 
 	trace := bencher.Handle(client, job, nil)
 
-	data, err := json.Marshal(&trace)
+	data, err = json.Marshal(&trace)
 	if err != nil {
 		panic(err)
 	}
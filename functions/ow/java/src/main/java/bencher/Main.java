@@ -0,0 +1,23 @@
+package bencher;
+
+import com.google.gson.JsonObject;
+
+/**
+ * OpenWhisk entry point, the action parameters are the job.
+ */
+public class Main {
+
+    // default parameters bound at deployment time that the bencher expects in its environment
+    private static final String[] envParams = {"SET_IO_KEY_ID", "SET_IO_SECRET"};
+
+    public static JsonObject main(JsonObject args) {
+        for (String key : envParams) {
+            if (args.has(key)) {
+                //java can't change its environment, the io job falls back to these properties
+                System.setProperty(key, args.get(key).getAsString());
+                args.remove(key);
+            }
+        }
+        return Bencher.handle(args);
+    }
+}
@@ -0,0 +1,18 @@
+'use strict';
+
+const { Handle } = require('./bencher');
+
+// default parameters bound at deployment time that the bencher expects in its environment
+const envParams = ['SET_IO_KEY_ID', 'SET_IO_SECRET'];
+
+async function main(args) {
+  for (const key of envParams) {
+    if (typeof args[key] === 'string') {
+      process.env[key] = args[key];
+    }
+    delete args[key];
+  }
+  return Handle(args);
+}
+
+exports.main = main;
@@ -27,6 +27,8 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/faas-facts/bench/bencher"
 
@@ -73,6 +75,18 @@ func setup() {
 	flag.String("workload", "workloads/b0.yml", "the workload descriptor file")
 	flag.Bool("y", false, "run without waiting for user confirmation")
 
+	flag.Bool("calibrate", false, "generate a calibration file instead of running the workload")
+	flag.String("calibration-platform", "local", "calibrate locally or against the target of the workload (target)")
+	flag.String("calibration-targets", "10ms,100ms,1s", "target execution times of the calibrated levels")
+	flag.String("calibration-memory", "", "optional target memory footprints of the calibrated levels, e.g. 1MiB,16MiB,128MiB")
+	flag.String("calibration-types", "prime,memory,idle,io", "workload types to calibrate")
+	flag.String("calibration-out", "calibration.yml", "the calibration file to write")
+
+	flag.String("artifact-cache", set.DefaultArtifactCache, "directory of the packaged functions, unchanged sources are not rebuilt")
+	flag.Bool("plan", false, "print what the run would deploy, upload and invoke without doing any of it")
+	flag.String("pricing", "", "pricing file (see example/pricing.yml), estimates the cost before the run and computes it afterwards")
+	flag.Duration("readiness-timeout", 2*time.Minute, "how long the deployed function gets to run a first job before the run fails, 0 skips the check")
+
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
 
@@ -99,8 +113,256 @@ func main() {
 		bencher.SetDefaultLogger(log)
 	}
 
+	if viper.GetBool("calibrate") {
+		calibrate()
+		return
+	}
+
+	w := readWorkload(viper.GetString("workload"))
+
+	err := w.LoadCalibration()
+	if err != nil {
+		panic(err)
+	}
+
+	if w.Uses("io") {
+		err = w.ResolveCredentials()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if viper.GetBool("plan") {
+		printPlan(splitWorkload(w))
+		return
+	}
+
+	if w.Uses("io") && w.LocalS3 != "" {
+		store, err := w.StartLocalS3()
+		if err != nil {
+			panic(err)
+		}
+		defer store.Stop()
+	}
+
+	if w.Uses("net") && w.NetSink != "" {
+		sink, err := w.StartNetSink()
+		if err != nil {
+			panic(err)
+		}
+		defer sink.Stop()
+	}
+
+	//the local services are shared by all targets
+	workloads := splitWorkload(w)
+	pricing := loadPricing()
+	experiments := make([]*experiment, len(workloads))
+	for i := range workloads {
+		experiments[i] = newExperiment(&workloads[i], pricing)
+	}
+
+	if !bencher.AskForConfirmation(fmt.Sprintf("deploying the workload to %d target(s)", len(experiments)), os.Stdin) {
+		os.Exit(0)
+	}
+
+	//deployed one after another, targets may share their function folder
+	for _, e := range experiments {
+		e.deploy()
+	}
+
+	if w.Uses("io") {
+		if !bencher.AskForConfirmation("generating IO Objects?", os.Stdin) {
+			os.Exit(0)
+		}
+		for _, e := range experiments {
+			e.w.GenerateIObjects()
+		}
+	}
+
+	if timeout := viper.GetDuration("readiness-timeout"); timeout > 0 {
+		for _, e := range experiments {
+			if err := e.w.AwaitTarget(set.NewReadinessCheck(timeout)); err != nil {
+				log.Fatalf("the deployed function is not ready, no load was started: %v", err)
+			}
+		}
+	}
+
+	if !bencher.AskForConfirmation("run SET benchmark?", os.Stdin) {
+		os.Exit(0)
+	}
+
+	if w.Sequential() || len(experiments) == 1 {
+		for _, e := range experiments {
+			e.run()
+		}
+		return
+	}
+	//all targets see the same load in the same time window
+	wg := sync.WaitGroup{}
+	for _, e := range experiments {
+		wg.Add(1)
+		go func(e *experiment) {
+			defer wg.Done()
+			e.run()
+		}(e)
+	}
+	wg.Wait()
+}
+
+// splitWorkload returns the workload of every target, with the io credentials handed to its deployment
+func splitWorkload(w set.PerformanceWorkload) []set.PerformanceWorkload {
+	workloads, err := w.Split()
+	if err != nil {
+		log.Fatalf("invalid targets: %v", err)
+	}
+	if w.Uses("io") {
+		for i := range workloads {
+			workloads[i].Deployment = workloads[i].Deployment.WithSecrets(w.FunctionSecrets())
+		}
+	}
+	return workloads
+}
+
+// experiment is the run of a workload against one target
+type experiment struct {
+	w        *set.PerformanceWorkload
+	platform set.ArtifactPlatform
+	bench    *bencher.Bencher
+
+	pricing  *set.Pricing
+	estimate *set.Cost
+}
+
+func newExperiment(w *set.PerformanceWorkload, pricing *set.Pricing) *experiment {
+	e := &experiment{
+		w:        w,
+		platform: set.NewPlatform(w.Deployment, viper.GetString("artifact-cache")),
+		pricing:  pricing,
+	}
+	w.Platform = e.platform
+	if pricing != nil {
+		e.estimate = estimateCost(w, pricing)
+	}
+	return e
+}
+
+// deploy deploys the function and its workflow steps and prepares the bencher
+func (e *experiment) deploy() {
+	result, err := e.platform.Deploy(e.w.Deployment)
+	if err != nil {
+		panic(err)
+	}
+	if err := e.w.ApplyDeployment(result); err != nil {
+		panic(err)
+	}
+
+	err = e.w.DeployWorkflow(result)
+	if err != nil {
+		panic(err)
+	}
+
+	//prepared after the deployment, the bencher needs the deployed target
+	e.bench = e.w.Prepare()
+}
+
+// run runs the bencher and records the provenance, results of a target are tagged with its name
+func (e *experiment) run() {
+	w := e.w
+	provenance, err := set.NewProvenance(*w, Build)
+	if err != nil {
+		panic(err)
+	}
+	if artifact, ok := e.platform.Artifact(w.Deployment.Source); ok {
+		provenance.Artifact = &artifact
+	}
+	provenance.EstimatedCost = e.estimate
+	if err := provenance.Write(); err != nil {
+		log.Errorf("failed to write %s %+v", provenance.File(), err)
+	}
+
+	e.bench.Run()
+
+	provenance.Finish()
+	if w.TargetName != "" {
+		if err := set.TagResults(w.ResultFile(), w.TargetName); err != nil {
+			log.Errorf("failed to tag %s with target %s %+v", w.ResultFile(), w.TargetName, err)
+		}
+	}
+	if e.pricing != nil {
+		cost, err := w.ActualCost(e.pricing, w.ResultFile())
+		if err != nil {
+			log.Errorf("failed to compute the cost of %s %+v", w.ResultFile(), err)
+		} else {
+			log.Infof("the run of %s cost %.4f %s for %d invocations", w.Name, cost.Total, cost.Currency, cost.Invocations)
+			provenance.Cost = &cost
+		}
+	}
+	if err := provenance.Write(); err != nil {
+		log.Errorf("failed to write %s %+v", provenance.File(), err)
+	}
+}
+
+// printPlan prints the plan of every workload as yaml document, nothing is deployed, started or uploaded
+func printPlan(workloads []set.PerformanceWorkload) {
+	pricing := loadPricing()
+	encoder := yaml.NewEncoder(os.Stdout)
+	defer encoder.Close()
+	for i := range workloads {
+		w := &workloads[i]
+		w.Platform = set.NewPlatform(w.Deployment, viper.GetString("artifact-cache"))
+		plan, err := w.Plan()
+		if err != nil {
+			log.Fatalf("failed to plan %s: %v", w.Name, err)
+		}
+		if pricing != nil {
+			cost, err := w.EstimateCost(pricing, plan)
+			if err != nil {
+				log.Fatalf("failed to estimate the cost of %s: %v", w.Name, err)
+			}
+			plan.Cost = &cost
+		}
+		if err := encoder.Encode(plan); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// loadPricing reads the configured pricing file, nil if none is configured
+func loadPricing() *set.Pricing {
+	path := viper.GetString("pricing")
+	if path == "" {
+		return nil
+	}
+	pricing, err := set.LoadPricing(path)
+	if err != nil {
+		log.Fatalf("failed to load the pricing: %v", err)
+	}
+	return pricing
+}
+
+// estimateCost logs the estimated cost of the run, nil if it can't be estimated
+func estimateCost(w *set.PerformanceWorkload, pricing *set.Pricing) *set.Cost {
+	plan, err := w.Plan()
+	if err != nil {
+		log.Warnf("can't estimate the cost, planning failed: %v", err)
+		return nil
+	}
+	cost, err := w.EstimateCost(pricing, plan)
+	if err != nil {
+		log.Warnf("can't estimate the cost: %v", err)
+		return nil
+	}
+	log.Infof("the run of %s is estimated to cost %.4f %s for %d invocations", w.Name, cost.Total, cost.Currency, cost.Invocations)
+	for class, c := range cost.Classes {
+		if c.Basis == "timeout" {
+			log.Warnf("the duration of %s is unknown, assuming the timeout %s gives an upper bound", class, c.Duration)
+		}
+	}
+	return &cost
+}
+
+func readWorkload(worklaodFile string) set.PerformanceWorkload {
 	w := set.PerformanceWorkload{}
-	worklaodFile := viper.GetString("workload")
 	data, err := os.ReadFile(worklaodFile)
 	if err != nil {
 		panic(err)
@@ -118,35 +380,68 @@ func main() {
 	} else {
 		panic(fmt.Sprintf("cant read worklaod file type - %s", worklaodFile))
 	}
-
-	platform := set.MakefileDeployment{}
-
-	w.Platform = platform
-
-	bench := w.Prepare()
-
-	if !bencher.AskForConfirmation("deploying the workload", os.Stdin) {
-		os.Exit(0)
+	if err := w.Validate(); err != nil {
+		log.Fatalf("invalid workload %s: %v", worklaodFile, err)
 	}
+	return w
+}
 
-	target, err := platform.Deploy(w.Deployment)
-	if err != nil {
-		panic(err)
+func calibrate() {
+	durations := strings.Split(viper.GetString("calibration-targets"), ",")
+	var memory []string
+	if m := viper.GetString("calibration-memory"); m != "" {
+		memory = strings.Split(m, ",")
 	}
 
-	if w.Target == "" {
-		w.Target = target
+	targets := make([]set.CalibrationTarget, len(durations))
+	for i, d := range durations {
+		duration, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			panic(err)
+		}
+		targets[i].Duration = duration
+		if i < len(memory) {
+			targets[i].Memory, err = set.ParseUnit(memory[i])
+			if err != nil {
+				panic(err)
+			}
+		}
 	}
-	if w.Type == "io" {
-		if !bencher.AskForConfirmation("generating IO Objects?", os.Stdin) {
-			os.Exit(0)
+	types := strings.Split(viper.GetString("calibration-types"), ",")
+
+	var calibrator *set.Calibrator
+	if viper.GetString("calibration-platform") == "target" {
+		w := readWorkload(viper.GetString("workload"))
+		w.Platform = set.NewPlatform(w.Deployment, viper.GetString("artifact-cache"))
+		target, err := w.CalibrationTarget()
+		if err != nil {
+			log.Fatalf("can't calibrate against the target of the workload: %v", err)
+		}
+		calibrator = set.NewTargetCalibrator(target, targets, types)
+		if w.Endpoint != "" {
+			err := w.ResolveCredentials()
+			if err != nil {
+				panic(err)
+			}
+			calibrator.Storage = &w
 		}
-		w.GenerateIObjects()
+	} else {
+		calibrator = set.NewLocalCalibrator(targets, types)
 	}
 
-	if !bencher.AskForConfirmation("run SET benchmark?", os.Stdin) {
+	if !bencher.AskForConfirmation(fmt.Sprintf("calibrating %v on %s", types, calibrator.Platform), os.Stdin) {
 		os.Exit(0)
 	}
-	bench.Run()
 
+	calibration, err := calibrator.Calibrate()
+
+	//written even if a type failed, the other levels are still usable
+	out := viper.GetString("calibration-out")
+	if saveErr := calibration.Save(out); saveErr != nil {
+		panic(saveErr)
+	}
+	if err != nil {
+		log.Fatalf("wrote a partial calibration to %s: %v", out, err)
+	}
+	log.Infof("wrote calibration to %s", out)
 }
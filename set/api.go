@@ -3,9 +3,30 @@ package set
 import "time"
 
 type Platform interface {
-	Deploy(Deployment) (string, error)
+	Deploy(Deployment) (DeploymentResult, error)
 	Change(Deployment) error
 	Remove(Deployment) error
+	//Plan reports what Deploy would do, without building, uploading or changing anything
+	Plan(Deployment) (DeploymentPlan, error)
+}
+
+// ArtifactPlatform is a Platform that packages the deployment source and remembers what it deployed.
+type ArtifactPlatform interface {
+	Platform
+	Artifact(source string) (Artifact, bool)
+}
+
+// NewPlatform selects the platform configured by the deployment, the Makefile of its source if none is.
+func NewPlatform(d Deployment, cache string) ArtifactPlatform {
+	switch {
+	case d.Container != nil:
+		return NewContainerDeployment(cache)
+	case d.GCF != nil:
+		return NewGCFDeployment(cache)
+	case d.Azure != nil:
+		return NewAzureDeployment(cache)
+	}
+	return &MakefileDeployment{Cache: cache}
 }
 
 type Deployment struct {
@@ -15,4 +36,26 @@ type Deployment struct {
 	FunctionMemory  Unit          `json:"memory,omitempty" yaml:"memory"`
 	FunctionTimeout time.Duration `json:"timeout,omitempty" yaml:"timeout"`
 	FunctionRegion  string        `json:"region,omitempty" yaml:"region"`
+
+	//entry of the pricing file the cost is computed with, see PricingKey
+	Pricing string `json:"pricing,omitempty" yaml:"pricing"`
+
+	//additional environment handed to the deployment scripts
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment"`
+
+	//deploys the source as container image instead of through its Makefile, see ContainerDeployment
+	Container *ContainerConfig `json:"container,omitempty" yaml:"container"`
+	//deploys the source through the Google Cloud Functions api, see GCFDeployment
+	GCF *GCFConfig `json:"gcf,omitempty" yaml:"gcf"`
+	//deploys the source to an Azure function app, see AzureDeployment
+	Azure *AzureConfig `json:"azure,omitempty" yaml:"azure"`
+
+	//credentials the function needs at runtime, never serialized
+	secrets map[string]Secret
+}
+
+// WithSecrets returns a copy of the deployment that passes the given secrets to the deployment scripts.
+func (d Deployment) WithSecrets(secrets map[string]Secret) Deployment {
+	d.secrets = secrets
+	return d
 }
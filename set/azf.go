@@ -0,0 +1,267 @@
+package set
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AzureConfig describes a deployment to an existing Azure function app.
+// The app (plan, storage account, runtime stack) is created once outside of SET, SET deploys the code and settings.
+type AzureConfig struct {
+	Subscription  string `json:"subscription" yaml:"subscription"`
+	ResourceGroup string `json:"resourceGroup" yaml:"resourceGroup"`
+	App           string `json:"app" yaml:"app"`
+	//http triggered function of the function folder, defaults to bench
+	Function string `json:"function,omitempty" yaml:"function"`
+
+	//access token for the management api (e.g. of az account get-access-token) as env:NAME or file:PATH reference
+	TokenRef string `json:"tokenRef,omitempty" yaml:"tokenRef"`
+	//management and kudu api, only changed for tests
+	API string `json:"api,omitempty" yaml:"api"`
+	SCM string `json:"scm,omitempty" yaml:"scm"`
+}
+
+func (c AzureConfig) function() string {
+	if c.Function == "" {
+		return "bench"
+	}
+	return c.Function
+}
+
+func (c AzureConfig) scm() string {
+	if c.SCM == "" {
+		return fmt.Sprintf("https://%s.scm.azurewebsites.net", c.App)
+	}
+	return strings.TrimSuffix(c.SCM, "/")
+}
+
+const (
+	azureAPI        = "https://management.azure.com"
+	azureAPIVersion = "2022-03-01"
+)
+
+// kudu deployment states, see https://github.com/projectkudu/kudu/wiki/REST-API
+const (
+	kuduFailed  = 3
+	kuduSuccess = 4
+)
+
+// AzureDeployment deploys the packaged source to a function app with the zip deployment of its kudu api.
+// The memory of a function app is fixed by its plan, the timeout is set as host setting.
+type AzureDeployment struct {
+	//directory of the packaged artifacts, DefaultArtifactCache if empty
+	Cache  string
+	Client *http.Client
+	//how long a zip deployment may take
+	ReadyTimeout time.Duration
+
+	deployedArtifacts
+}
+
+// NewAzureDeployment returns an Azure Functions platform.
+func NewAzureDeployment(cache string) *AzureDeployment {
+	return &AzureDeployment{
+		Cache:        cache,
+		Client:       &http.Client{Timeout: 5 * time.Minute},
+		ReadyTimeout: 10 * time.Minute,
+	}
+}
+
+func (a *AzureDeployment) Deploy(d Deployment) (DeploymentResult, error) {
+	api, err := a.api(d)
+	if err != nil {
+		return DeploymentResult{}, err
+	}
+	if err := a.apply(api, d); err != nil {
+		return DeploymentResult{}, err
+	}
+
+	site := struct {
+		Location   string `json:"location"`
+		Properties struct {
+			DefaultHostName string `json:"defaultHostName"`
+		} `json:"properties"`
+	}{}
+	if _, err := api.do(http.MethodGet, a.site(d)+"?api-version="+azureAPIVersion, nil, &site); err != nil {
+		return DeploymentResult{}, err
+	}
+	if site.Properties.DefaultHostName == "" {
+		return DeploymentResult{}, fmt.Errorf("function app %s has no host name", d.Azure.App)
+	}
+	result := DeploymentResult{
+		URL:      fmt.Sprintf("https://%s/api/%s", site.Properties.DefaultHostName, d.Azure.function()),
+		Function: d.Azure.App + "/" + d.Azure.function(),
+		//"West Europe" is westeurope in the apis
+		Region: strings.ToLower(strings.ReplaceAll(site.Location, " ", "")),
+	}
+	if artifact, ok := a.Artifact(d.Source); ok {
+		result.Version = artifact.Hash
+	}
+	log.Infof("deployed %s to %s", d.Source, result.URL)
+	return result, nil
+}
+
+func (a *AzureDeployment) Change(d Deployment) error {
+	api, err := a.api(d)
+	if err != nil {
+		return err
+	}
+	return a.apply(api, d)
+}
+
+// Remove deletes the function, the function app is kept
+func (a *AzureDeployment) Remove(d Deployment) error {
+	api, err := a.api(d)
+	if err != nil {
+		return err
+	}
+	_, err = api.do(http.MethodDelete, a.site(d)+"/functions/"+d.Azure.function()+"?api-version="+azureAPIVersion, nil, nil)
+	return err
+}
+
+func (a *AzureDeployment) api(d Deployment) (restClient, error) {
+	if d.Azure == nil {
+		return restClient{}, fmt.Errorf("the deployment of %s has no azure settings", d.Source)
+	}
+	if d.Azure.Subscription == "" || d.Azure.ResourceGroup == "" || d.Azure.App == "" {
+		return restClient{}, fmt.Errorf("the deployment of %s needs an azure subscription, resource group and app", d.Source)
+	}
+	base := d.Azure.API
+	if base == "" {
+		base = azureAPI
+	}
+	rest := newRestClient(a.Client, base)
+	token, err := resolveSecretRef(d.Azure.TokenRef)
+	if err != nil {
+		return rest, err
+	}
+	if token != "" {
+		rest.auth = func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	return rest, nil
+}
+
+func (a *AzureDeployment) site(d Deployment) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Web/sites/%s",
+		d.Azure.Subscription, d.Azure.ResourceGroup, d.Azure.App)
+}
+
+// apply updates the app settings and deploys the artifact if it changed
+func (a *AzureDeployment) apply(api restClient, d Deployment) error {
+	manifest, err := readFunctionManifest(d.Source)
+	if err != nil {
+		return err
+	}
+	artifact, err := Package(d, cacheDir(a.Cache))
+	if err != nil {
+		return err
+	}
+	if d.FunctionMemory > 0 {
+		log.Warnf("the memory of %s is fixed by its plan, memory %d is ignored", d.Azure.App, d.FunctionMemory)
+	}
+
+	//the settings api replaces all settings, so the existing ones are merged
+	settings := struct {
+		Properties map[string]string `json:"properties"`
+	}{}
+	if _, err := api.do(http.MethodPost, a.site(d)+"/config/appsettings/list?api-version="+azureAPIVersion, nil, &settings); err != nil {
+		return err
+	}
+	if settings.Properties == nil {
+		settings.Properties = make(map[string]string)
+	}
+	for k, v := range functionEnv(d) {
+		settings.Properties[k] = v
+	}
+	if timeout := d.FunctionTimeout.Round(time.Second); timeout > 0 {
+		//overrides functionTimeout of host.json
+		settings.Properties["AzureFunctionsJobHost__functionTimeout"] = hostTimeout(timeout)
+	}
+	if manifest.Runtime == "python" {
+		//installs requirements.txt on deployment
+		settings.Properties["SCM_DO_BUILD_DURING_DEPLOYMENT"] = "true"
+	}
+	if _, err := api.do(http.MethodPut, a.site(d)+"/config/appsettings?api-version="+azureAPIVersion, settings, nil); err != nil {
+		return err
+	}
+
+	if last, ok := a.Artifact(d.Source); ok && last.Hash == artifact.Hash {
+		return nil
+	}
+	if err := a.zipDeploy(api, d, artifact); err != nil {
+		return err
+	}
+	a.deployed(d.Source, artifact)
+	return nil
+}
+
+func (a *AzureDeployment) Plan(d Deployment) (DeploymentPlan, error) {
+	if d.Azure == nil || d.Azure.Subscription == "" || d.Azure.ResourceGroup == "" || d.Azure.App == "" {
+		return DeploymentPlan{}, fmt.Errorf("the deployment of %s needs an azure subscription, resource group and app", d.Source)
+	}
+	plan, manifest, err := planPackage("azure", d, a.Cache)
+	if err != nil {
+		return plan, err
+	}
+	if d.FunctionMemory > 0 {
+		plan.add("ignore memory %d, the memory of %s is fixed by its plan", d.FunctionMemory, d.Azure.App)
+		plan.MemoryMiB = 0
+	}
+
+	settings := []string{"the function environment"}
+	if timeout := d.FunctionTimeout.Round(time.Second); timeout > 0 {
+		settings = append(settings, "AzureFunctionsJobHost__functionTimeout="+hostTimeout(timeout))
+	}
+	if manifest.Runtime == "python" {
+		settings = append(settings, "SCM_DO_BUILD_DURING_DEPLOYMENT=true")
+	}
+	plan.add("merge %s into the app settings of %s", strings.Join(settings, ", "), d.Azure.App)
+
+	if last, ok := a.Artifact(d.Source); !ok || !plan.Artifact.Cached || last.Hash != plan.Artifact.Hash {
+		plan.add("zip deploy the artifact to %s", d.Azure.scm())
+	}
+	return plan, nil
+}
+
+// hostTimeout formats the functionTimeout of host.json
+func hostTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d", int(timeout.Hours()), int(timeout.Minutes())%60, int(timeout.Seconds())%60)
+}
+
+// zipDeploy uploads the artifact to kudu and waits for the deployment to finish
+func (a *AzureDeployment) zipDeploy(api restClient, d Deployment, artifact Artifact) error {
+	data, err := ioutil.ReadFile(artifact.Path)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/zip")
+	_, response, err := api.send(http.MethodPost, d.Azure.scm()+"/api/zipdeploy?isAsync=true", header, data, nil)
+	if err != nil {
+		return err
+	}
+	location := response.Get("Location")
+	if location == "" {
+		location = d.Azure.scm() + "/api/deployments/latest"
+	}
+
+	return poll(a.ReadyTimeout, func() (bool, error) {
+		deployment := struct {
+			Status     int    `json:"status"`
+			StatusText string `json:"status_text"`
+			Complete   bool   `json:"complete"`
+		}{}
+		if _, _, err := api.send(http.MethodGet, location, nil, nil, &deployment); err != nil {
+			return false, err
+		}
+		if deployment.Status == kuduFailed {
+			return false, fmt.Errorf("zip deployment to %s failed: %s", d.Azure.App, deployment.StatusText)
+		}
+		return deployment.Complete && deployment.Status == kuduSuccess, nil
+	})
+}
@@ -0,0 +1,82 @@
+package set
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAzureDeployment(t *testing.T) {
+	site := "/subscriptions/0000/resourceGroups/set/providers/Microsoft.Web/sites/set-bench"
+	api := newFixtureServer(t, map[string][]fixtureResponse{
+		"POST " + site + "/config/appsettings/list": {{fixture: "azf/appsettings.json"}},
+		"PUT " + site + "/config/appsettings":       {{fixture: "azf/appsettings.json"}},
+		"POST /api/zipdeploy":                       {{status: http.StatusAccepted}},
+		"GET /api/deployments/latest": {
+			{status: http.StatusAccepted, fixture: "azf/deployment_pending.json"},
+			{fixture: "azf/deployment_complete.json"},
+		},
+		"GET " + site:                         {{fixture: "azf/site.json"}},
+		"DELETE " + site + "/functions/bench": {{status: http.StatusNoContent}},
+	})
+	defer api.Close()
+
+	source := functionSource(t, "runtime: go\nsources:\n  - handler.go\n  - host.json\n  - bench/function.json\n",
+		"handler.go", "host.json", "bench/function.json")
+	os.Setenv("SET_TEST_AZURE_TOKEN", "eyJ0eXAi")
+	defer os.Unsetenv("SET_TEST_AZURE_TOKEN")
+
+	platform := &AzureDeployment{Cache: t.TempDir(), ReadyTimeout: 5 * time.Second}
+	d := Deployment{
+		Source:          source,
+		FunctionTimeout: 90 * time.Second,
+		Azure: &AzureConfig{
+			Subscription:  "0000",
+			ResourceGroup: "set",
+			App:           "set-bench",
+			TokenRef:      "env:SET_TEST_AZURE_TOKEN",
+			API:           api.URL,
+			SCM:           api.URL,
+		},
+	}.WithSecrets(map[string]Secret{"SET_IO_SECRET": "s3cret"})
+
+	result, err := platform.Deploy(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact, _ := platform.Artifact(source)
+	expected := DeploymentResult{
+		URL:      "https://set-bench.azurewebsites.net/api/bench",
+		Function: "set-bench/bench",
+		Region:   "westeurope",
+		Version:  artifact.Hash,
+	}
+	if result != expected || result.Validate() != nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(api.unmatched) > 0 {
+		t.Errorf("unexpected calls %v", api.unmatched)
+	}
+	//existing settings are kept, the timeout overrides host.json
+	assertJSON(t, "appsettings", fixture(t, "azf/appsettings_request.json", api.URL), api.request("PUT "+site+"/config/appsettings", 0))
+	if auth := api.headers["POST /api/zipdeploy"].Get("Authorization"); auth != "Bearer eyJ0eXAi" {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+	if api.calls("GET /api/deployments/latest") != 2 {
+		t.Errorf("expected the deployment to be polled until complete, got %d calls", api.calls("GET /api/deployments/latest"))
+	}
+
+	//a settings change keeps the deployed code
+	d.FunctionTimeout = 2 * time.Minute
+	if err := platform.Change(d); err != nil {
+		t.Fatal(err)
+	}
+	if api.calls("POST /api/zipdeploy") != 1 {
+		t.Error("the unchanged source was deployed again")
+	}
+
+	if err := platform.Remove(d); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,548 @@
+package set
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	workload "github.com/ISE-SMILE/SET/workloads/go"
+)
+
+// CalibrationVersion is increased whenever the calibration file format changes.
+const CalibrationVersion = 1
+
+// measurements further than this fraction away from the target count as unreached
+const calibrationTolerance = 0.25
+
+// Calibration holds generated level tables that replace the preset levels of the workloads.
+// Level i of every table aims at Targets[i].
+type Calibration struct {
+	Version  int       `json:"version" yaml:"version"`
+	Created  time.Time `json:"created" yaml:"created"`
+	Platform string    `json:"platform" yaml:"platform"`
+	Host     string    `json:"host" yaml:"host"`
+
+	Targets []CalibrationTarget `json:"targets" yaml:"targets"`
+
+	Prime  map[byte]int32      `json:"prime,omitempty" yaml:"prime,omitempty"`
+	Memory map[byte]MemoryTask `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Idle   map[byte]float64    `json:"idle,omitempty" yaml:"idle,omitempty"`
+	IO     map[byte]IOTask     `json:"io,omitempty" yaml:"io,omitempty"`
+
+	Measurements []CalibrationMeasurement `json:"measurements" yaml:"measurements"`
+}
+
+// CalibrationTarget is the execution time and, optionally, the memory footprint a level should reach.
+type CalibrationTarget struct {
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	Memory   Unit          `json:"memory,omitempty" yaml:"memory,omitempty"`
+}
+
+// CalibrationMeasurement records what the generated parameters of a level actually achieved.
+type CalibrationMeasurement struct {
+	Type     string        `json:"type" yaml:"type"`
+	Level    byte          `json:"level" yaml:"level"`
+	Target   time.Duration `json:"target" yaml:"target"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	Memory   Unit          `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Reached  bool          `json:"reached" yaml:"reached"`
+}
+
+func LoadCalibration(path string) (*Calibration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Calibration
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Version != CalibrationVersion {
+		return nil, fmt.Errorf("calibration %s has version %d, expected %d - please recalibrate", path, c.Version, CalibrationVersion)
+	}
+	return &c, nil
+}
+
+func (c *Calibration) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadCalibration reads the calibration file of the workload, if any, to replace the preset level tables.
+func (w *PerformanceWorkload) LoadCalibration() error {
+	if w.CalibrationFile == "" {
+		return nil
+	}
+	c, err := LoadCalibration(w.CalibrationFile)
+	if err != nil {
+		return err
+	}
+	log.Infof("using calibration of %s from %s", c.Platform, c.Created.Format(time.RFC3339))
+	w.calibration = c
+	return nil
+}
+
+type calibrationSample struct {
+	duration time.Duration
+	memory   Unit
+}
+
+// Calibrator measures the workload functions and derives level tables for the given targets.
+type Calibrator struct {
+	Platform    string
+	Targets     []CalibrationTarget
+	Types       []string
+	Repetitions int
+
+	//storage used to calibrate the io job, we start a local S3 stand-in if unset
+	Storage *PerformanceWorkload
+
+	run func(job Job) (calibrationSample, error)
+}
+
+// NewLocalCalibrator runs the workload functions inside the driver process.
+func NewLocalCalibrator(targets []CalibrationTarget, types []string) *Calibrator {
+	return &Calibrator{
+		Platform:    "local",
+		Targets:     targets,
+		Types:       types,
+		Repetitions: 3,
+		run:         runLocal,
+	}
+}
+
+// CalibrationTarget returns the url the target calibrator sends its jobs to, the target of the workload if it is an http url
+// and otherwise the url the deployed function reports. Functions that are only invoked by name can't be calibrated.
+func (w *PerformanceWorkload) CalibrationTarget() (string, error) {
+	if httpTarget(w.Target) {
+		return w.Target, nil
+	}
+	if w.Deployed == nil {
+		platform, ok := w.Platform.(interface {
+			Info(Deployment) (DeploymentResult, error)
+		})
+		if !ok || w.Deployment.Source == "" {
+			return "", fmt.Errorf("the target %q is no http url and the deployment can't report one", w.Target)
+		}
+		result, err := platform.Info(w.Deployment)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the deployed function: %w", err)
+		}
+		w.Deployed = &result
+	}
+	if !httpTarget(w.Deployed.URL) {
+		return "", fmt.Errorf("the function %s has no http url to calibrate against, e.g. deploy OpenWhisk actions as web action", w.Deployed.Function)
+	}
+	return w.Deployed.URL, nil
+}
+
+// NewTargetCalibrator sends the jobs to a deployed function, the target must accept the job as a json POST body.
+// Memory footprints can't be observed remotely and are reported as 0.
+func NewTargetCalibrator(target string, targets []CalibrationTarget, types []string) *Calibrator {
+	client := &http.Client{Timeout: 15 * time.Minute}
+	return &Calibrator{
+		Platform:    target,
+		Targets:     targets,
+		Types:       types,
+		Repetitions: 3,
+		run: func(job Job) (calibrationSample, error) {
+			return runRemote(client, target, job)
+		},
+	}
+}
+
+func runLocal(job Job) (calibrationSample, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return calibrationSample{}, err
+	}
+	var fnJob workload.Job
+	if err := json.Unmarshal(data, &fnJob); err != nil {
+		return calibrationSample{}, err
+	}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	//the footprint is the peak of the heap in use, sampled while the job runs since it frees its memory again
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var stats runtime.MemStats
+		max := before.HeapInuse
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for running := true; running; {
+			select {
+			case <-ticker.C:
+			case <-done:
+				running = false
+			}
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > max {
+				max = stats.HeapInuse
+			}
+		}
+		peak <- max
+	}()
+
+	start := time.Now()
+	_, err = workload.Execute(fnJob)
+	duration := time.Since(start)
+	close(done)
+
+	return calibrationSample{
+		duration: duration,
+		memory:   Unit(<-peak - before.HeapInuse),
+	}, err
+}
+
+func runRemote(client *http.Client, target string, job Job) (calibrationSample, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return calibrationSample{}, err
+	}
+
+	start := time.Now()
+	resp, err := client.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return calibrationSample{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	roundTrip := time.Since(start)
+	if err != nil {
+		return calibrationSample{}, err
+	}
+	if resp.StatusCode >= 300 {
+		return calibrationSample{}, fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+
+	//prefer the execution latency of the trace over the round trip time
+	var trace struct {
+		ExecutionLatency *struct {
+			Seconds int64 `json:"seconds"`
+			Nanos   int64 `json:"nanos"`
+		}
+	}
+	if err := json.Unmarshal(body, &trace); err == nil && trace.ExecutionLatency != nil {
+		return calibrationSample{
+			duration: time.Duration(trace.ExecutionLatency.Seconds)*time.Second + time.Duration(trace.ExecutionLatency.Nanos),
+		}, nil
+	}
+	return calibrationSample{duration: roundTrip}, nil
+}
+
+// measure runs the job Repetitions times and reports the median duration and the largest memory footprint.
+func (c *Calibrator) measure(job Job) (calibrationSample, error) {
+	repetitions := c.Repetitions
+	if repetitions < 1 {
+		repetitions = 1
+	}
+
+	durations := make([]time.Duration, 0, repetitions)
+	result := calibrationSample{}
+	for i := 0; i < repetitions; i++ {
+		sample, err := c.run(job)
+		if err != nil {
+			return result, err
+		}
+		durations = append(durations, sample.duration)
+		if sample.memory > result.memory {
+			result.memory = sample.memory
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	result.duration = durations[len(durations)/2]
+	return result, nil
+}
+
+func reached(target, measured time.Duration) bool {
+	return math.Abs(float64(measured-target)) <= calibrationTolerance*float64(target)
+}
+
+// distance compares measurements on a log scale, the levels span several orders of magnitude
+func distance(target, measured time.Duration) float64 {
+	return math.Abs(math.Log(float64(measured+1) / float64(target)))
+}
+
+// scaleIterations searches the iteration count that makes job(n) run for the target duration,
+// assuming the runtime grows roughly linearly with the iterations.
+func (c *Calibrator) scaleIterations(target time.Duration, job func(n int64) Job) (int64, calibrationSample, error) {
+	n := int64(1000)
+	sample, err := c.measure(job(n))
+	if err != nil {
+		return n, sample, err
+	}
+
+	for round := 0; round < 4 && !reached(target, sample.duration); round++ {
+		perIteration := float64(sample.duration) / float64(n)
+		if perIteration <= 0 {
+			perIteration = 1
+		}
+		next := int64(math.Round(float64(target) / perIteration))
+		if next < 1 {
+			next = 1
+		}
+		if next > math.MaxUint32 {
+			next = math.MaxUint32
+		}
+		if next == n {
+			break
+		}
+		n = next
+		if sample, err = c.measure(job(n)); err != nil {
+			return n, sample, err
+		}
+	}
+	return n, sample, nil
+}
+
+// Calibrate generates a level table per workload type, level i aims at Targets[i].
+func (c *Calibrator) Calibrate() (*Calibration, error) {
+	host, _ := os.Hostname()
+	calibration := &Calibration{
+		Version:  CalibrationVersion,
+		Created:  time.Now(),
+		Platform: c.Platform,
+		Host:     fmt.Sprintf("%s (%s/%s, %d cpus)", host, runtime.GOOS, runtime.GOARCH, runtime.NumCPU()),
+		Targets:  c.Targets,
+	}
+
+	//a failing type keeps the levels calibrated so far and doesn't stop the other types
+	failed := make([]string, 0)
+	for _, t := range c.Types {
+		var err error
+		switch t {
+		case "idle":
+			err = c.calibrateIdle(calibration)
+		case "prime":
+			err = c.calibratePrime(calibration)
+		case "memory":
+			err = c.calibrateMemory(calibration)
+		case "io":
+			err = c.calibrateIO(calibration)
+		default:
+			err = fmt.Errorf("can't calibrate workload type %s", t)
+		}
+		if err != nil {
+			log.Errorf("failed to calibrate %s: %v", t, err)
+			failed = append(failed, fmt.Sprintf("%s (%v)", t, err))
+		}
+	}
+	if len(failed) > 0 {
+		return calibration, fmt.Errorf("failed to calibrate %s", strings.Join(failed, ", "))
+	}
+	return calibration, nil
+}
+
+func (c *Calibrator) record(calibration *Calibration, t string, level int, target CalibrationTarget, sample calibrationSample) {
+	m := CalibrationMeasurement{
+		Type:     t,
+		Level:    byte(level),
+		Target:   target.Duration,
+		Duration: sample.duration,
+		Memory:   sample.memory,
+		Reached:  reached(target.Duration, sample.duration),
+	}
+	if !m.Reached {
+		log.Warnf("%s level %d reached %s instead of %s", t, level, m.Duration, m.Target)
+	} else {
+		log.Infof("%s level %d reached %s (target %s)", t, level, m.Duration, m.Target)
+	}
+	calibration.Measurements = append(calibration.Measurements, m)
+}
+
+func (c *Calibrator) calibrateIdle(calibration *Calibration) error {
+	calibration.Idle = make(map[byte]float64)
+	for level, target := range c.Targets {
+		sleep := target.Duration.Seconds()
+		sample, err := c.measure(Job{Idle: &sleep})
+		if err != nil {
+			return err
+		}
+		calibration.Idle[byte(level)] = sleep
+		c.record(calibration, "idle", level, target, sample)
+	}
+	return nil
+}
+
+func (c *Calibrator) calibratePrime(calibration *Calibration) error {
+	//the test time only depends on the magnitude of the candidate, so we measure the presets and pick the closest
+	magnitudes := make([]int32, 0, len(primeLevel))
+	for _, m := range primeLevel {
+		magnitudes = append(magnitudes, m)
+	}
+	sort.Slice(magnitudes, func(i, j int) bool {
+		return magnitudes[i] < magnitudes[j]
+	})
+
+	samples := make([]calibrationSample, len(magnitudes))
+	for i, m := range magnitudes {
+		candidate := uint32(m - 1)
+		sample, err := c.measure(Job{Prime: &candidate})
+		if err != nil {
+			return err
+		}
+		samples[i] = sample
+	}
+
+	calibration.Prime = make(map[byte]int32)
+	for level, target := range c.Targets {
+		magnitude, sample, err := c.searchPrime(target.Duration, magnitudes, samples)
+		if err != nil {
+			return err
+		}
+		calibration.Prime[byte(level)] = magnitude
+		c.record(calibration, "prime", level, target, sample)
+	}
+	return nil
+}
+
+// searchPrime starts at the closest preset and bisects between the presets around the target, on a log scale
+func (c *Calibrator) searchPrime(target time.Duration, magnitudes []int32, samples []calibrationSample) (int32, calibrationSample, error) {
+	best := 0
+	for i := range samples {
+		if distance(target, samples[i].duration) < distance(target, samples[best].duration) {
+			best = i
+		}
+	}
+	magnitude, sample := magnitudes[best], samples[best]
+
+	//the last preset below the target, targets outside of the presets keep the closest one
+	below := -1
+	for i := range samples {
+		if samples[i].duration < target {
+			below = i
+		}
+	}
+	if below < 0 || below == len(samples)-1 {
+		return magnitude, sample, nil
+	}
+	low, high := float64(magnitudes[below]), float64(magnitudes[below+1])
+	for round := 0; round < 8 && !reached(target, sample.duration); round++ {
+		next := int32(math.Round(math.Sqrt(low * high)))
+		if float64(next) <= low || float64(next) >= high {
+			break
+		}
+		candidate := uint32(next - 1)
+		measured, err := c.measure(Job{Prime: &candidate})
+		if err != nil {
+			return magnitude, sample, err
+		}
+		if distance(target, measured.duration) < distance(target, sample.duration) {
+			magnitude, sample = next, measured
+		}
+		if measured.duration < target {
+			low = float64(next)
+		} else {
+			high = float64(next)
+		}
+	}
+	return magnitude, sample, nil
+}
+
+func (c *Calibrator) calibrateMemory(calibration *Calibration) error {
+	calibration.Memory = make(map[byte]MemoryTask)
+	for level, target := range c.Targets {
+		task := MemoryTask{
+			OperatorSize:   1000,
+			RecursionDepth: 20,
+		}
+		if target.Memory > 0 {
+			//two operator arrays of float64
+			task.OperatorSize = uint32(target.Memory / 16)
+		}
+
+		n, sample, err := c.scaleIterations(target.Duration, func(n int64) Job {
+			task.Iteration = uint32(n)
+			return Job{Memory: &task}
+		})
+		if err != nil {
+			return err
+		}
+		task.Iteration = uint32(n)
+		calibration.Memory[byte(level)] = task
+		c.record(calibration, "memory", level, target, sample)
+	}
+	return nil
+}
+
+func (c *Calibrator) calibrateIO(calibration *Calibration) error {
+	storage := c.Storage
+	if storage == nil {
+		if c.Platform != "local" {
+			return fmt.Errorf("io calibration of %s needs a storage reachable by the function", c.Platform)
+		}
+		//the stand-in ignores credentials, but the clients refuse to work without any
+		storage = &PerformanceWorkload{
+			Name:            "calibration",
+			Bucket:          "set-calibration",
+			LocalS3:         "127.0.0.1:0",
+			AccessKeyID:     "set",
+			AccessKeySecret: "set",
+		}
+		store, err := storage.StartLocalS3()
+		if err != nil {
+			return err
+		}
+		defer store.Stop()
+
+		//the in-process function resolves its credentials like a deployed one
+		for env, value := range storage.FunctionSecrets() {
+			if os.Getenv(env) == "" {
+				os.Setenv(env, value.Value())
+			}
+		}
+	}
+
+	template := IOTask{
+		ReadWrite:    0.5,
+		ChunkSize:    int64(64 * kiB),
+		ObjectNumber: 2,
+		ObjectSize:   int64(1 * MiB),
+	}
+	io := *storage
+	io.Type = "io"
+	io.calibration = &Calibration{IO: map[byte]IOTask{io.Level: template}}
+	io.Keys = make([]string, template.ObjectNumber)
+	for i := range io.Keys {
+		io.Keys[i] = fmt.Sprintf("in_%s_%d.bin", io.Name, i)
+	}
+	io.GenerateIObjects()
+
+	calibration.IO = make(map[byte]IOTask)
+	for level, target := range c.Targets {
+		n, sample, err := c.scaleIterations(target.Duration, func(n int64) Job {
+			task := io.ioJob(template)
+			task.Iteration = int(n)
+			return Job{IO: &task}
+		})
+		if err != nil {
+			return err
+		}
+		task := template
+		task.Iteration = int(n)
+		calibration.IO[byte(level)] = task
+		c.record(calibration, "io", level, target, sample)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package set
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrateLocal(t *testing.T) {
+	targets := []CalibrationTarget{{Duration: 20 * time.Millisecond, Memory: 8 * MiB}}
+	c := NewLocalCalibrator(targets, []string{"idle", "memory", "prime", "unknown"})
+	c.Repetitions = 1
+
+	calibration, err := c.Calibrate()
+	if err == nil {
+		t.Fatal("the unknown type was calibrated")
+	}
+	//the other types are kept
+	if sleep := calibration.Idle[0]; sleep != 0.02 {
+		t.Errorf("expected a sleep of 0.02s, got %f", sleep)
+	}
+	if task, ok := calibration.Memory[0]; !ok || task.Iteration == 0 || task.OperatorSize != uint32(8*MiB/16) {
+		t.Errorf("unexpected memory level %+v", task)
+	}
+	if magnitude, ok := calibration.Prime[0]; !ok || magnitude <= 0 {
+		t.Errorf("unexpected prime level %d", magnitude)
+	}
+
+	for _, m := range calibration.Measurements {
+		switch m.Type {
+		case "idle":
+			if !m.Reached {
+				t.Errorf("the idle level slept %s instead of %s", m.Duration, m.Target)
+			}
+		case "memory":
+			//two operator arrays of 4MiB each
+			if m.Memory < 4*MiB {
+				t.Errorf("expected a footprint of about 8MiB, got %d bytes", m.Memory)
+			}
+		}
+	}
+}
+
+func TestCalibrationTarget(t *testing.T) {
+	w := PerformanceWorkload{Target: "https://example.com/bench"}
+	if target, err := w.CalibrationTarget(); err != nil || target != w.Target {
+		t.Errorf("expected the configured url, got %q %v", target, err)
+	}
+
+	w = PerformanceWorkload{Target: "bencher", Deployed: &DeploymentResult{Function: "bencher", URL: "https://ow.example.com/api/v1/web/guest/default/bencher"}}
+	if target, err := w.CalibrationTarget(); err != nil || target != w.Deployed.URL {
+		t.Errorf("expected the deployed url, got %q %v", target, err)
+	}
+
+	//an action that is only invoked by name
+	w = PerformanceWorkload{Target: "bencher", Deployed: &DeploymentResult{Function: "bencher"}}
+	if _, err := w.CalibrationTarget(); err == nil {
+		t.Error("calibrating against a function without url was accepted")
+	}
+}
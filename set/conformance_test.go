@@ -0,0 +1,154 @@
+package set
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	workload "github.com/ISE-SMILE/SET/workloads/go"
+)
+
+// workloadRuntime runs the workload of one language outside of a function, see execute.* in the workload folders
+type workloadRuntime struct {
+	name string
+	args []string
+}
+
+// availableRuntimes returns the runtimes whose interpreter is on the path.
+// The java workload runs as single source file and needs its dependencies in SET_JAVA_CLASSPATH,
+// e.g. the output of mvn dependency:build-classpath in functions/aws/java.
+func availableRuntimes() []workloadRuntime {
+	runtimes := make([]workloadRuntime, 0)
+	if python, err := exec.LookPath("python3"); err == nil {
+		runtimes = append(runtimes, workloadRuntime{"python", []string{python, "-B", "execute.py"}})
+	}
+	if node, err := exec.LookPath("node"); err == nil {
+		runtimes = append(runtimes, workloadRuntime{"node", []string{node, "execute.js"}})
+	}
+	if java, err := exec.LookPath("java"); err == nil && os.Getenv("SET_JAVA_CLASSPATH") != "" {
+		runtimes = append(runtimes, workloadRuntime{"java", []string{java, "-cp", os.Getenv("SET_JAVA_CLASSPATH"), "Bencher.java"}})
+	}
+	return runtimes
+}
+
+func (r workloadRuntime) command(payload []byte) *exec.Cmd {
+	cmd := exec.Command(r.args[0], r.args[1:]...)
+	cmd.Dir = filepath.Join("..", "workloads", r.name)
+	cmd.Stdin = bytes.NewReader(payload)
+	return cmd
+}
+
+// execute runs a payload with the workload, like a deployed function of the runtime would
+func (r workloadRuntime) execute(t *testing.T, payload []byte) map[string]string {
+	cmd := r.command(payload)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s failed %v: %s %s", r.name, err, out, stderr.String())
+	}
+	tags := make(map[string]string)
+	if err := json.Unmarshal(out, &tags); err != nil {
+		t.Fatalf("%s returned %s: %v", r.name, out, err)
+	}
+	return tags
+}
+
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestConformance feeds the same payloads to the go workload and the other runtimes and compares the result tags.
+func TestConformance(t *testing.T) {
+	runtimes := availableRuntimes()
+	if len(runtimes) == 0 {
+		t.Skip("neither python3, node nor java is available")
+	}
+
+	seed := int64(1)
+	small := func(v int) *int { return &v }
+	small64 := func(v int64) *int64 { return &v }
+	rw := float32(0.5)
+
+	cases := []struct {
+		name string
+		w    PerformanceWorkload
+		//tags that have to be identical, all others only have to exist in both
+		exact []string
+	}{
+		{"idle", PerformanceWorkload{Type: "idle", Level: 0}, []string{"job"}},
+		{"prime", PerformanceWorkload{Type: "prime", Level: 1}, []string{"job"}},
+		{"memory", PerformanceWorkload{Type: "memory", MemoryParams: &MemoryTask{OperatorSize: 100, Iteration: 100, RecursionDepth: 2}}, []string{"job"}},
+		{"matrix", PerformanceWorkload{Type: "matrix", Level: 0}, []string{"job", "matrix.size"}},
+		{"sha256", PerformanceWorkload{Type: "sha256", Level: 0}, []string{"job"}},
+		{"gzip", PerformanceWorkload{Type: "gzip", Level: 0}, []string{"job"}},
+		{"json", PerformanceWorkload{Type: "json", Level: 0}, []string{"job"}},
+		{"alloc", PerformanceWorkload{Type: "alloc", AllocParams: &AllocParameters{Size: 4, Pattern: "random"}}, []string{"job", "mib"}},
+		{"disk", PerformanceWorkload{Type: "disk", Level: 0}, []string{"job", "written", "read"}},
+		{"net", PerformanceWorkload{Type: "net", Level: 0, NetSink: "127.0.0.1:0"}, []string{"job", "requests", "errors", "sent"}},
+		{"io", PerformanceWorkload{
+			Type: "io", Backend: "fs", Endpoint: t.TempDir(), Bucket: "conformance", Keys: []string{"in_0.bin", "in_1.bin"},
+			IOParams: &IOParameters{Iteration: small(20), ReadWrite: &rw, ChunkSize: small64(512), ObjectSize: small64(4096)},
+		}, []string{"job", "errors", "cached"}},
+		{"mix", PerformanceWorkload{Mix: []MixEntry{{Type: "idle", Level: 0, Weight: 1}}}, []string{"job", "class"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := c.w
+			w.Seed = &seed
+			if w.NetSink != "" {
+				sink, err := w.StartNetSink()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer sink.Stop()
+			}
+			payload := w.Payload()(nil)
+
+			var job workload.Job
+			if err := json.Unmarshal(payload, &job); err != nil {
+				t.Fatal(err)
+			}
+			goTags, err := workload.Execute(job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range runtimes {
+				tags := r.execute(t, payload)
+
+				if g, o := strings.Join(sortedKeys(goTags), ","), strings.Join(sortedKeys(tags), ","); g != o {
+					t.Errorf("result fields differ\ngo:     %s\n%s: %s", g, r.name, o)
+				}
+				for _, k := range c.exact {
+					if goTags[k] != tags[k] {
+						t.Errorf("%s differs, go %q %s %q", k, goTags[k], r.name, tags[k])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConformance_SchemaVersion(t *testing.T) {
+	payload := []byte(`{"version": 999, "idle": 0}`)
+	if _, err := workload.Execute(workload.Job{Version: 999}); err == nil {
+		t.Error("go accepted a newer schema version")
+	}
+	for _, r := range availableRuntimes() {
+		if err := r.command(payload).Run(); err == nil {
+			t.Errorf("%s accepted a newer schema version", r.name)
+		}
+	}
+}
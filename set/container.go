@@ -0,0 +1,464 @@
+package set
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ContainerConfig describes a deployment as container image to a Knative or OpenFaaS cluster.
+type ContainerConfig struct {
+	//knative or openfaas
+	Platform string `json:"platform" yaml:"platform"`
+	//kubernetes api server (knative) or gateway (openfaas)
+	API       string `json:"api" yaml:"api"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace"`
+	//name of the service or function, defaults to bencher
+	Name string `json:"name,omitempty" yaml:"name"`
+
+	//registry the built image is pushed to, the image stays local if empty (e.g. kind with a loaded image)
+	Registry string `json:"registry,omitempty" yaml:"registry"`
+	//prebuilt image, skips the build
+	Image string `json:"image,omitempty" yaml:"image"`
+
+	//bearer token (knative) or basic auth user and password (openfaas) as env:NAME or file:PATH reference
+	User        string `json:"user,omitempty" yaml:"user"`
+	PasswordRef string `json:"passwordRef,omitempty" yaml:"passwordRef"`
+	TokenRef    string `json:"tokenRef,omitempty" yaml:"tokenRef"`
+}
+
+func (c ContainerConfig) name() string {
+	if c.Name == "" {
+		return "bencher"
+	}
+	return c.Name
+}
+
+func (c ContainerConfig) namespace() string {
+	if c.Namespace == "" {
+		return "default"
+	}
+	return c.Namespace
+}
+
+// tag names the image built from the artifact sources
+func (c ContainerConfig) tag(artifact Artifact) string {
+	image := fmt.Sprintf("%s:%s", c.name(), artifact.SourceHash[:12])
+	if c.Registry != "" {
+		image = strings.TrimSuffix(c.Registry, "/") + "/" + image
+	}
+	return image
+}
+
+// ImageBuilder builds the function image from the packaged source folder.
+type ImageBuilder interface {
+	Build(source, image string) error
+	Push(image string) error
+}
+
+// DockerBuilder builds and pushes images with the docker cli.
+type DockerBuilder struct{}
+
+func (DockerBuilder) Build(source, image string) error {
+	//images are tagged by the source hash, an existing image is up to date
+	if exec.Command("docker", "image", "inspect", image).Run() == nil {
+		log.Infof("using existing image %s", image)
+		return nil
+	}
+	out, err := exec.Command("docker", "build", "-t", image, source).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker build failed %w: %s", err, out)
+	}
+	return nil
+}
+
+func (DockerBuilder) Push(image string) error {
+	out, err := exec.Command("docker", "push", image).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker push failed %w: %s", err, out)
+	}
+	return nil
+}
+
+// ContainerDeployment packages the deployment source as container image and deploys it through the cluster api.
+// The source folder needs a Dockerfile next to its manifest.yml, see functions/container/go.
+type ContainerDeployment struct {
+	//directory of the packaged artifacts, DefaultArtifactCache if empty
+	Cache   string
+	Builder ImageBuilder
+	Client  *http.Client
+	//how long Deploy waits for the function to become ready
+	ReadyTimeout time.Duration
+
+	deployedArtifacts
+}
+
+// NewContainerDeployment returns a container platform that builds with docker.
+func NewContainerDeployment(cache string) *ContainerDeployment {
+	return &ContainerDeployment{
+		Cache:        cache,
+		Builder:      DockerBuilder{},
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		ReadyTimeout: 5 * time.Minute,
+	}
+}
+
+func (c *ContainerDeployment) Deploy(d Deployment) (DeploymentResult, error) {
+	result := DeploymentResult{Region: d.FunctionRegion}
+	api, err := c.api(d)
+	if err != nil {
+		return result, err
+	}
+	image, err := c.image(d)
+	if err != nil {
+		return result, err
+	}
+	if err := api.apply(d, image); err != nil {
+		return result, err
+	}
+
+	result.URL, err = api.await(d, c.ReadyTimeout)
+	if err != nil {
+		return result, err
+	}
+	result.Function = d.Container.name()
+	result.Version = image
+	log.Infof("deployed %s to %s", image, result.URL)
+	return result, nil
+}
+
+func (c *ContainerDeployment) Change(d Deployment) error {
+	api, err := c.api(d)
+	if err != nil {
+		return err
+	}
+	image, err := c.image(d)
+	if err != nil {
+		return err
+	}
+	return api.apply(d, image)
+}
+
+func (c *ContainerDeployment) Remove(d Deployment) error {
+	api, err := c.api(d)
+	if err != nil {
+		return err
+	}
+	return api.remove(d)
+}
+
+func (c *ContainerDeployment) Plan(d Deployment) (DeploymentPlan, error) {
+	if d.Container == nil {
+		return DeploymentPlan{}, fmt.Errorf("the deployment of %s has no container settings", d.Source)
+	}
+	config := d.Container
+	platform := strings.ToLower(config.Platform)
+	if platform != "knative" && platform != "openfaas" {
+		return DeploymentPlan{}, fmt.Errorf("unknown container platform %s", config.Platform)
+	}
+
+	var plan DeploymentPlan
+	image := config.Image
+	if image != "" {
+		plan = DeploymentPlan{
+			Platform:  platform,
+			Source:    d.Source,
+			Runtime:   d.FunctionRuntime,
+			MemoryMiB: memoryMiB(d.FunctionMemory),
+			Timeout:   d.FunctionTimeout,
+			Region:    d.FunctionRegion,
+			Artifact:  Artifact{Path: image},
+		}
+		plan.add("use the prebuilt image %s", image)
+	} else {
+		var err error
+		plan, _, err = planPackage(platform, d, c.Cache)
+		if err != nil {
+			return plan, err
+		}
+		image = config.tag(plan.Artifact)
+		plan.add("build the image %s from %s", image, d.Source)
+		if config.Registry != "" {
+			plan.add("push %s", image)
+		}
+	}
+
+	if platform == "knative" {
+		plan.add("create or update the knative service %s/%s at %s (%dMi, timeout %ds)",
+			config.namespace(), config.name(), config.API, plan.MemoryMiB, timeoutSeconds(d))
+	} else {
+		plan.add("create or update the openfaas function %s at %s (%dMi, timeout %ds)",
+			config.name(), config.API, plan.MemoryMiB, timeoutSeconds(d))
+	}
+	return plan, nil
+}
+
+// image packages the source and builds its image, unless the deployment names a prebuilt one
+func (c *ContainerDeployment) image(d Deployment) (string, error) {
+	config := d.Container
+	if config.Image != "" {
+		c.deployed(d.Source, Artifact{Path: config.Image})
+		return config.Image, nil
+	}
+
+	artifact, err := Package(d, cacheDir(c.Cache))
+	if err != nil {
+		return "", err
+	}
+
+	image := config.tag(artifact)
+	if err := c.Builder.Build(d.Source, image); err != nil {
+		return "", err
+	}
+	if config.Registry != "" {
+		if err := c.Builder.Push(image); err != nil {
+			return "", err
+		}
+	}
+
+	artifact.Path = image
+	c.deployed(d.Source, artifact)
+	return image, nil
+}
+
+// clusterAPI is the part that differs between Knative and OpenFaaS
+type clusterAPI interface {
+	//apply creates or updates the function
+	apply(d Deployment, image string) error
+	//await waits until the function serves requests and returns its url
+	await(d Deployment, timeout time.Duration) (string, error)
+	remove(d Deployment) error
+}
+
+func (c *ContainerDeployment) api(d Deployment) (clusterAPI, error) {
+	if d.Container == nil {
+		return nil, fmt.Errorf("the deployment of %s has no container settings", d.Source)
+	}
+	rest := newRestClient(c.Client, d.Container.API)
+
+	switch strings.ToLower(d.Container.Platform) {
+	case "knative":
+		token, err := resolveSecretRef(d.Container.TokenRef)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			rest.auth = func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+		}
+		return knative{rest}, nil
+	case "openfaas":
+		password, err := resolveSecretRef(d.Container.PasswordRef)
+		if err != nil {
+			return nil, err
+		}
+		if password != "" {
+			user := d.Container.User
+			if user == "" {
+				user = "admin"
+			}
+			rest.auth = func(r *http.Request) { r.SetBasicAuth(user, password) }
+		}
+		return openFaaS{rest}, nil
+	}
+	return nil, fmt.Errorf("unknown container platform %s", d.Container.Platform)
+}
+
+// knative deploys a serving.knative.dev/v1 Service through the kubernetes api
+type knative struct {
+	restClient
+}
+
+type knativeService struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Spec       map[string]interface{} `json:"spec"`
+	Status     struct {
+		URL string `json:"url"`
+		//generation of the spec the status describes, older than metadata.generation while an update rolls out
+		ObservedGeneration        int64  `json:"observedGeneration"`
+		LatestCreatedRevisionName string `json:"latestCreatedRevisionName"`
+		LatestReadyRevisionName   string `json:"latestReadyRevisionName"`
+		Traffic                   []struct {
+			RevisionName string `json:"revisionName"`
+			Percent      int64  `json:"percent"`
+		} `json:"traffic"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status,omitempty"`
+}
+
+func (k knative) path(d Deployment) string {
+	return fmt.Sprintf("/apis/serving.knative.dev/v1/namespaces/%s/services", d.Container.namespace())
+}
+
+func (k knative) apply(d Deployment, image string) error {
+	values := functionEnv(d)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	//sorted, so an unchanged deployment gives an unchanged spec
+	sort.Strings(names)
+	env := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, map[string]string{"name": name, "value": values[name]})
+	}
+	memory := fmt.Sprintf("%dMi", memoryMiB(d.FunctionMemory))
+	container := map[string]interface{}{
+		"image": image,
+		"env":   env,
+		"resources": map[string]interface{}{
+			"limits":   map[string]string{"memory": memory},
+			"requests": map[string]string{"memory": memory},
+		},
+	}
+	//the function shares a single trace per process, see functions/container/go/main.go
+	template := map[string]interface{}{"containers": []interface{}{container}, "containerConcurrency": 1}
+	if timeout := timeoutSeconds(d); timeout > 0 {
+		template["timeoutSeconds"] = timeout
+	}
+
+	service := knativeService{
+		APIVersion: "serving.knative.dev/v1",
+		Kind:       "Service",
+		Metadata:   map[string]interface{}{"name": d.Container.name(), "namespace": d.Container.namespace()},
+		Spec:       map[string]interface{}{"template": map[string]interface{}{"spec": template}},
+	}
+
+	existing := knativeService{}
+	status, err := k.do(http.MethodGet, k.path(d)+"/"+d.Container.name(), nil, &existing)
+	if status == http.StatusNotFound {
+		_, err = k.do(http.MethodPost, k.path(d), service, nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	//updates have to carry the version we replace
+	service.Metadata["resourceVersion"] = existing.Metadata["resourceVersion"]
+	_, err = k.do(http.MethodPut, k.path(d)+"/"+d.Container.name(), service, nil)
+	return err
+}
+
+func (k knative) await(d Deployment, timeout time.Duration) (string, error) {
+	url := ""
+	err := poll(timeout, func() (bool, error) {
+		service := knativeService{}
+		if _, err := k.do(http.MethodGet, k.path(d)+"/"+d.Container.name(), nil, &service); err != nil {
+			return false, err
+		}
+		//right after an update the status still describes the previous revision
+		generation, _ := service.Metadata["generation"].(float64)
+		if service.Status.ObservedGeneration < int64(generation) {
+			return false, nil
+		}
+		for _, condition := range service.Status.Conditions {
+			if condition.Type != "Ready" {
+				continue
+			}
+			if condition.Status == "False" {
+				return false, fmt.Errorf("service %s failed: %s", d.Container.name(), condition.Message)
+			}
+			url = service.Status.URL
+			return condition.Status == "True" && url != "" && service.serving(), nil
+		}
+		return false, nil
+	})
+	return url, err
+}
+
+// serving reports if the latest revision is ready and receives the traffic of the service
+func (s knativeService) serving() bool {
+	latest := s.Status.LatestCreatedRevisionName
+	if latest == "" || latest != s.Status.LatestReadyRevisionName {
+		return false
+	}
+	for _, target := range s.Status.Traffic {
+		if target.RevisionName == latest && target.Percent > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (k knative) remove(d Deployment) error {
+	_, err := k.do(http.MethodDelete, k.path(d)+"/"+d.Container.name(), nil, nil)
+	return err
+}
+
+// openFaaS deploys a function through the gateway api
+type openFaaS struct {
+	restClient
+}
+
+type openFaaSFunction struct {
+	Service   string            `json:"service"`
+	Image     string            `json:"image"`
+	Namespace string            `json:"namespace,omitempty"`
+	EnvVars   map[string]string `json:"envVars,omitempty"`
+	Limits    map[string]string `json:"limits,omitempty"`
+	Requests  map[string]string `json:"requests,omitempty"`
+}
+
+func (o openFaaS) apply(d Deployment, image string) error {
+	env := functionEnv(d)
+	//one request per replica like containerConcurrency of knative, the function shares a single trace per process
+	env["max_inflight"] = "1"
+	//the watchdog kills requests after these timeouts
+	if timeout := timeoutSeconds(d); timeout > 0 {
+		for _, key := range []string{"read_timeout", "write_timeout", "exec_timeout"} {
+			env[key] = strconv.FormatInt(timeout, 10) + "s"
+		}
+	}
+	memory := fmt.Sprintf("%dMi", memoryMiB(d.FunctionMemory))
+	function := openFaaSFunction{
+		Service:   d.Container.name(),
+		Image:     image,
+		Namespace: d.Container.Namespace,
+		EnvVars:   env,
+		Limits:    map[string]string{"memory": memory},
+		Requests:  map[string]string{"memory": memory},
+	}
+
+	status, err := o.do(http.MethodPut, "/system/functions", function, nil)
+	if status == http.StatusNotFound {
+		_, err = o.do(http.MethodPost, "/system/functions", function, nil)
+	}
+	return err
+}
+
+func (o openFaaS) await(d Deployment, timeout time.Duration) (string, error) {
+	path := "/system/function/" + d.Container.name()
+	if d.Container.Namespace != "" {
+		path += "?namespace=" + d.Container.Namespace
+	}
+	err := poll(timeout, func() (bool, error) {
+		status := struct {
+			AvailableReplicas int `json:"availableReplicas"`
+		}{}
+		if _, err := o.do(http.MethodGet, path, nil, &status); err != nil {
+			return false, err
+		}
+		return status.AvailableReplicas > 0, nil
+	})
+	url := o.base + "/function/" + d.Container.name()
+	if d.Container.Namespace != "" {
+		url += "." + d.Container.Namespace
+	}
+	return url, err
+}
+
+func (o openFaaS) remove(d Deployment) error {
+	_, err := o.do(http.MethodDelete, "/system/functions", map[string]string{"functionName": d.Container.name()}, nil)
+	return err
+}
@@ -0,0 +1,247 @@
+package set
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBuilder struct {
+	built, pushed []string
+}
+
+func (b *fakeBuilder) Build(source, image string) error {
+	b.built = append(b.built, image)
+	return nil
+}
+
+func (b *fakeBuilder) Push(image string) error {
+	b.pushed = append(b.pushed, image)
+	return nil
+}
+
+// mockAPI records the requests and keeps the last written object per path
+type mockAPI struct {
+	lock     sync.Mutex
+	requests []string
+	objects  map[string]map[string]interface{}
+	auth     string
+	reads    int
+}
+
+func (m *mockAPI) record(r *http.Request) map[string]interface{} {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests = append(m.requests, r.Method+" "+r.URL.Path)
+	m.auth = r.Header.Get("Authorization")
+	body := make(map[string]interface{})
+	json.NewDecoder(r.Body).Decode(&body)
+	return body
+}
+
+func containerSource(t *testing.T) string {
+	source := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(source, "manifest.yml"), []byte("sources:\n  - Dockerfile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestContainerDeployment_Knative(t *testing.T) {
+	api := &mockAPI{objects: make(map[string]map[string]interface{})}
+	services := "/apis/serving.knative.dev/v1/namespaces/bench/services"
+	//the first status read after a write still describes the previous generation
+	generation, stale := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := api.record(r)
+		api.lock.Lock()
+		defer api.lock.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == services:
+			body["metadata"].(map[string]interface{})["resourceVersion"] = "1"
+			generation, stale = generation+1, true
+			api.objects[services+"/bencher"] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut:
+			generation, stale = generation+1, true
+			api.objects[r.URL.Path] = body
+		case r.Method == http.MethodGet:
+			service, ok := api.objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			observed := generation
+			if stale {
+				observed, stale = generation-1, false
+			}
+			api.reads++
+			revision := fmt.Sprintf("bencher-%05d", observed)
+			service["metadata"].(map[string]interface{})["generation"] = generation
+			service["status"] = map[string]interface{}{
+				"url":                       "http://bencher.bench.example.com",
+				"observedGeneration":        observed,
+				"latestCreatedRevisionName": revision,
+				"latestReadyRevisionName":   revision,
+				"traffic":                   []interface{}{map[string]interface{}{"revisionName": revision, "percent": 100}},
+				"conditions":                []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+			}
+			json.NewEncoder(w).Encode(service)
+		case r.Method == http.MethodDelete:
+			delete(api.objects, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	builder := &fakeBuilder{}
+	platform := &ContainerDeployment{Cache: t.TempDir(), Builder: builder, ReadyTimeout: time.Second}
+	d := Deployment{
+		Source:          containerSource(t),
+		FunctionMemory:  512,
+		FunctionTimeout: time.Minute,
+		Environment:     map[string]string{"MODE": "bench"},
+		Container: &ContainerConfig{
+			Platform:  "knative",
+			API:       server.URL,
+			Namespace: "bench",
+			Registry:  "registry.local:5000/",
+			TokenRef:  "env:SET_TEST_KUBE_TOKEN",
+		},
+	}
+	os.Setenv("SET_TEST_KUBE_TOKEN", "abc")
+	defer os.Unsetenv("SET_TEST_KUBE_TOKEN")
+
+	result, err := platform.Deploy(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.URL != "http://bencher.bench.example.com" || result.Function != "bencher" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	//await skips the stale status of the previous generation
+	if api.reads != 2 {
+		t.Errorf("expected 2 reads of the service, got %d", api.reads)
+	}
+	if len(builder.built) != 1 || len(builder.pushed) != 1 || !strings.HasPrefix(builder.built[0], "registry.local:5000/bencher:") {
+		t.Errorf("unexpected builds %v, pushes %v", builder.built, builder.pushed)
+	}
+	if api.auth != "Bearer abc" {
+		t.Errorf("unexpected authorization %q", api.auth)
+	}
+	artifact, ok := platform.Artifact(d.Source)
+	if !ok || artifact.Path != builder.built[0] {
+		t.Errorf("unexpected artifact %+v", artifact)
+	}
+
+	spec := api.objects[services+"/bencher"]["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	limits := container["resources"].(map[string]interface{})["limits"].(map[string]interface{})
+	if limits["memory"] != "512Mi" || spec["timeoutSeconds"] != float64(60) || spec["containerConcurrency"] != float64(1) || container["image"] != builder.built[0] {
+		t.Errorf("unexpected service spec %v", spec)
+	}
+
+	d.FunctionMemory = 1 * GiB
+	if err := platform.Change(d); err != nil {
+		t.Fatal(err)
+	}
+	service := api.objects[services+"/bencher"]
+	if service["metadata"].(map[string]interface{})["resourceVersion"] != "1" {
+		t.Errorf("the update did not carry the resource version %v", service["metadata"])
+	}
+	if !strings.Contains(toJSON(service), `"memory":"1024Mi"`) {
+		t.Errorf("the update did not change the memory %v", service)
+	}
+
+	if err := platform.Remove(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := api.objects[services+"/bencher"]; ok {
+		t.Error("the service was not removed")
+	}
+}
+
+func TestContainerDeployment_OpenFaaS(t *testing.T) {
+	api := &mockAPI{objects: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := api.record(r)
+		api.lock.Lock()
+		defer api.lock.Unlock()
+		switch {
+		case r.URL.Path == "/system/functions" && r.Method == http.MethodPut:
+			if _, ok := api.objects["bencher"]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			api.objects["bencher"] = body
+		case r.URL.Path == "/system/functions" && r.Method == http.MethodPost:
+			api.objects[body["service"].(string)] = body
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/system/functions" && r.Method == http.MethodDelete:
+			delete(api.objects, body["functionName"].(string))
+		case r.URL.Path == "/system/function/bencher":
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "bencher", "availableReplicas": 1})
+		}
+	}))
+	defer server.Close()
+
+	platform := &ContainerDeployment{Builder: &fakeBuilder{}, ReadyTimeout: time.Second}
+	d := Deployment{
+		Source:          containerSource(t),
+		FunctionMemory:  256,
+		FunctionTimeout: 30 * time.Second,
+		Container: &ContainerConfig{
+			Platform:    "openfaas",
+			API:         server.URL,
+			Image:       "ghcr.io/example/bencher:latest",
+			PasswordRef: "env:SET_TEST_FAAS_PASSWORD",
+		},
+	}
+	os.Setenv("SET_TEST_FAAS_PASSWORD", "pw")
+	defer os.Unsetenv("SET_TEST_FAAS_PASSWORD")
+
+	result, err := platform.Deploy(d.WithSecrets(map[string]Secret{"SET_IO_SECRET": "s3cret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.URL != server.URL+"/function/bencher" || result.Version != d.Container.Image {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if !strings.HasPrefix(api.auth, "Basic ") {
+		t.Errorf("unexpected authorization %q", api.auth)
+	}
+	if strings.Join(api.requests[:2], ",") != "PUT /system/functions,POST /system/functions" {
+		t.Errorf("expected a create after the failed update, got %v", api.requests)
+	}
+
+	function := api.objects["bencher"]
+	env := function["envVars"].(map[string]interface{})
+	if function["image"] != d.Container.Image || env["exec_timeout"] != "30s" || env["max_inflight"] != "1" || env["SET_IO_SECRET"] != "s3cret" {
+		t.Errorf("unexpected function %v", function)
+	}
+	if function["limits"].(map[string]interface{})["memory"] != "256Mi" {
+		t.Errorf("unexpected limits %v", function["limits"])
+	}
+
+	if err := platform.Remove(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := api.objects["bencher"]; ok {
+		t.Error("the function was not removed")
+	}
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
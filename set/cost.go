@@ -0,0 +1,427 @@
+package set
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Pricing holds the prices of the platforms and storage backends. List prices change and differ
+// between regions and contracts, so they are read from a local file, see example/pricing.yml.
+type Pricing struct {
+	Currency string `json:"currency" yaml:"currency"`
+	//prices by platform, see Deployment.PricingKey
+	Platforms map[string]PlatformPricing `json:"platforms" yaml:"platforms"`
+	//prices by io backend (s3, http, redis, fs)
+	Storage map[string]StoragePricing `json:"storage,omitempty" yaml:"storage"`
+}
+
+// PlatformPricing is the pay-per-use price of a function platform.
+type PlatformPricing struct {
+	//fee per invocation
+	Request float64 `json:"request" yaml:"request"`
+	//price of running one second with 1GiB of memory
+	GBSecond float64 `json:"gbSecond" yaml:"gbSecond"`
+	//execution times are billed in multiples of Granularity, and at least MinDuration
+	Granularity time.Duration `json:"granularity,omitempty" yaml:"granularity"`
+	MinDuration time.Duration `json:"minDuration,omitempty" yaml:"minDuration"`
+	//memory is billed in multiples of MemoryStep MiB, and DefaultMemory MiB if the deployment sets none
+	MemoryStep    int64 `json:"memoryStep,omitempty" yaml:"memoryStep"`
+	DefaultMemory int64 `json:"defaultMemory,omitempty" yaml:"defaultMemory"`
+	//timeout of the platform if the deployment sets none, the upper bound of unknown execution times
+	DefaultTimeout time.Duration `json:"defaultTimeout,omitempty" yaml:"defaultTimeout"`
+}
+
+// StoragePricing is the price of the storage operations of the io job.
+type StoragePricing struct {
+	//price per read and per write operation
+	Read  float64 `json:"read" yaml:"read"`
+	Write float64 `json:"write" yaml:"write"`
+}
+
+// LoadPricing reads a pricing file.
+func LoadPricing(path string) (*Pricing, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pricing := &Pricing{}
+	if err := yaml.Unmarshal(data, pricing); err != nil {
+		return nil, fmt.Errorf("failed to read pricing %s: %w", path, err)
+	}
+	return pricing, nil
+}
+
+// billedSeconds applies the rounding of the platform to an execution time
+func (p PlatformPricing) billedSeconds(duration time.Duration) float64 {
+	if duration < p.MinDuration {
+		duration = p.MinDuration
+	}
+	if p.Granularity > 0 && duration%p.Granularity != 0 {
+		duration += p.Granularity - duration%p.Granularity
+	}
+	return duration.Seconds()
+}
+
+// billedGiB applies the rounding of the platform to the memory in MiB
+func (p PlatformPricing) billedGiB(memory int64) float64 {
+	if memory <= 0 {
+		memory = p.DefaultMemory
+	}
+	if p.MemoryStep > 0 && memory%p.MemoryStep != 0 {
+		memory += p.MemoryStep - memory%p.MemoryStep
+	}
+	return float64(memory) / 1024
+}
+
+// PricingKey names the pricing of the deployment, the platform folder of Makefile deployments (functions/<platform>/<runtime>) if not set.
+func (d Deployment) PricingKey() string {
+	switch {
+	case d.Pricing != "":
+		return d.Pricing
+	case d.Container != nil:
+		return strings.ToLower(d.Container.Platform)
+	case d.GCF != nil:
+		return "gcf"
+	case d.Azure != nil:
+		return "azure"
+	}
+	return filepath.Base(filepath.Dir(filepath.Clean(d.Source)))
+}
+
+// Cost is the cost of an experiment, estimated from its plan or computed from its results.
+type Cost struct {
+	//true if the cost is an estimate from the plan
+	Estimated bool   `json:"estimated" yaml:"estimated"`
+	Currency  string `json:"currency,omitempty" yaml:"currency,omitempty"`
+
+	Invocations   int64   `json:"invocations" yaml:"invocations"`
+	GBSeconds     float64 `json:"gbSeconds" yaml:"gbSeconds"`
+	StorageReads  int64   `json:"storageReads,omitempty" yaml:"storageReads,omitempty"`
+	StorageWrites int64   `json:"storageWrites,omitempty" yaml:"storageWrites,omitempty"`
+	//requests of the results without execution time (e.g. timeouts), billed at the timeout of the deployment
+	Unmeasured int64 `json:"unmeasured,omitempty" yaml:"unmeasured,omitempty"`
+
+	RequestCost float64 `json:"requestCost" yaml:"requestCost"`
+	ComputeCost float64 `json:"computeCost" yaml:"computeCost"`
+	StorageCost float64 `json:"storageCost,omitempty" yaml:"storageCost,omitempty"`
+	Total       float64 `json:"total" yaml:"total"`
+
+	//breakdown by request class, workflow steps are listed as step.<name>
+	Classes map[string]*ClassCost `json:"classes" yaml:"classes"`
+}
+
+// ClassCost is the share of a request class in the cost of an experiment.
+type ClassCost struct {
+	Invocations int64 `json:"invocations" yaml:"invocations"`
+	//mean execution time, for estimates the assumed one
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	//where an estimated duration comes from: calibration, idle or timeout (an upper bound)
+	Basis string  `json:"basis,omitempty" yaml:"basis,omitempty"`
+	Cost  float64 `json:"cost" yaml:"cost"`
+}
+
+// costModel sums up the invocations and storage operations of an experiment
+type costModel struct {
+	pricing *Pricing
+	cost    Cost
+	//summed execution time per class, for the mean durations
+	durations map[string]time.Duration
+}
+
+func newCostModel(pricing *Pricing, estimated bool) *costModel {
+	return &costModel{
+		pricing:   pricing,
+		cost:      Cost{Estimated: estimated, Currency: pricing.Currency, Classes: make(map[string]*ClassCost)},
+		durations: make(map[string]time.Duration),
+	}
+}
+
+// invoke adds invocations of the deployed function that each ran for duration
+func (m *costModel) invoke(class string, d Deployment, invocations int64, duration time.Duration) error {
+	key := d.PricingKey()
+	price, ok := m.pricing.Platforms[key]
+	if !ok {
+		return fmt.Errorf("the pricing has no platform %s", key)
+	}
+	memory := memoryMiB(d.FunctionMemory)
+	//the plan fixes the memory of azure functions, the deployment can't set it, see AzureDeployment.apply
+	if d.Azure != nil {
+		memory = 0
+	}
+	gbSeconds := float64(invocations) * price.billedSeconds(duration) * price.billedGiB(memory)
+	cost := float64(invocations)*price.Request + gbSeconds*price.GBSecond
+
+	m.cost.Invocations += invocations
+	m.cost.GBSeconds += gbSeconds
+	m.cost.RequestCost += float64(invocations) * price.Request
+	m.cost.ComputeCost += gbSeconds * price.GBSecond
+
+	c := m.class(class)
+	c.Invocations += invocations
+	c.Cost += cost
+	m.durations[class] += time.Duration(invocations) * duration
+	return nil
+}
+
+// timeout returns the timeout of the deployment, or the default of its platform if it sets none
+func (m *costModel) timeout(d Deployment) (time.Duration, error) {
+	if d.FunctionTimeout > 0 {
+		return d.FunctionTimeout, nil
+	}
+	key := d.PricingKey()
+	if price, ok := m.pricing.Platforms[key]; ok && price.DefaultTimeout > 0 {
+		return price.DefaultTimeout, nil
+	}
+	return 0, fmt.Errorf("the deployment of %s sets no timeout and the pricing of %s no defaultTimeout", d.Source, key)
+}
+
+// storage adds the operations of a class on the io backend, backends without pricing are free
+func (m *costModel) storage(class, backend string, reads, writes int64) {
+	if backend == "" {
+		backend = "s3"
+	}
+	price, ok := m.pricing.Storage[strings.ToLower(backend)]
+	if !ok {
+		return
+	}
+	cost := float64(reads)*price.Read + float64(writes)*price.Write
+	m.cost.StorageReads += reads
+	m.cost.StorageWrites += writes
+	m.cost.StorageCost += cost
+	m.class(class).Cost += cost
+}
+
+func (m *costModel) class(name string) *ClassCost {
+	c, ok := m.cost.Classes[name]
+	if !ok {
+		c = &ClassCost{}
+		m.cost.Classes[name] = c
+	}
+	return c
+}
+
+func (m *costModel) total() Cost {
+	for name, c := range m.cost.Classes {
+		if c.Invocations > 0 {
+			c.Duration = m.durations[name] / time.Duration(c.Invocations)
+		}
+	}
+	m.cost.Total = m.cost.RequestCost + m.cost.ComputeCost + m.cost.StorageCost
+	return m.cost
+}
+
+// ioOperations returns the storage reads and writes of one io job
+func (w PerformanceWorkload) ioOperations() (int64, int64) {
+	task, ok := w.ioTask()
+	if !ok {
+		return 0, 0
+	}
+	//rw is the share of reads, like in the functions
+	reads := int64(math.Round(float64(task.Iteration) * float64(task.ReadWrite)))
+	return reads, int64(task.Iteration) - reads
+}
+
+// expectedDuration guesses the execution time of a job on d from the calibration, the idle time or, as upper bound, the timeout
+func (w PerformanceWorkload) expectedDuration(model *costModel, d Deployment) (time.Duration, string, error) {
+	if w.calibration != nil {
+		for _, m := range w.calibration.Measurements {
+			if m.Type == w.Type && m.Level == w.Level {
+				return m.Duration, "calibration", nil
+			}
+		}
+	}
+	if w.Type == "idle" {
+		if sleep, ok := w.idleTask(); ok {
+			return time.Duration(sleep * float64(time.Second)), "idle", nil
+		}
+	}
+	timeout, err := model.timeout(d)
+	return timeout, "timeout", err
+}
+
+// stepDeployment is the function a workflow step runs on
+func (w PerformanceWorkload) stepDeployment(step WorkflowStep) Deployment {
+	if step.Deployment != nil {
+		return *step.Deployment
+	}
+	return w.Deployment
+}
+
+// EstimateCost estimates the cost of the planned experiment. Execution times come from the calibration
+// where it measured the level, idle jobs sleep a known time, all other jobs are assumed to run until the timeout.
+// The operational change is not taken into account.
+func (w PerformanceWorkload) EstimateCost(pricing *Pricing, plan ExperimentPlan) (Cost, error) {
+	model := newCostModel(pricing, true)
+
+	//the entry function waits for its steps
+	var stepsDuration time.Duration
+	if w.Workflow != nil {
+		for _, step := range w.Workflow.Steps {
+			if step.Target != "" {
+				continue
+			}
+			d := w.stepDeployment(step)
+			single := w.mixed(MixEntry{Type: step.Type, Level: step.Level})
+			duration, basis, err := single.expectedDuration(model, d)
+			if err != nil {
+				return model.cost, fmt.Errorf("can't estimate step %s: %w", step.Name, err)
+			}
+			if err := model.invoke("step."+step.Name, d, plan.Invocations, duration); err != nil {
+				return model.cost, err
+			}
+			model.class("step." + step.Name).Basis = basis
+			if single.Type == "io" {
+				reads, writes := single.ioOperations()
+				model.storage("step."+step.Name, w.Backend, reads*plan.Invocations, writes*plan.Invocations)
+			}
+			if strings.ToLower(w.Workflow.Mode) == "fanout" {
+				if duration > stepsDuration {
+					stepsDuration = duration
+				}
+			} else {
+				stepsDuration += duration
+			}
+		}
+	}
+
+	entries := w.Mix
+	invocations := plan.Classes
+	if len(entries) == 0 {
+		entries = []MixEntry{{Type: w.Type, Level: w.Level}}
+		invocations = map[string]int64{entries[0].Class(): plan.Invocations}
+	}
+	for _, entry := range entries {
+		class := entry.Class()
+		single := w.mixed(entry)
+		duration, basis, err := single.expectedDuration(model, w.Deployment)
+		if err != nil {
+			return model.cost, fmt.Errorf("can't estimate %s: %w", class, err)
+		}
+		if err := model.invoke(class, w.Deployment, invocations[class], duration+stepsDuration); err != nil {
+			return model.cost, err
+		}
+		model.class(class).Basis = basis
+		if single.Type == "io" {
+			reads, writes := single.ioOperations()
+			model.storage(class, w.Backend, reads*invocations[class], writes*invocations[class])
+		}
+	}
+
+	//the generated input objects
+	if plan.IO != nil && !plan.IO.Generated {
+		model.storage("io-objects", w.Backend, 0, int64(plan.IO.Objects))
+	}
+	return model.total(), nil
+}
+
+// ActualCost computes the cost of an experiment from its result file, billing the recorded execution time
+// of every request with the deployed memory. Workflow steps are billed with the execution time the entry function recorded for them.
+func (w PerformanceWorkload) ActualCost(pricing *Pricing, results string) (Cost, error) {
+	model := newCostModel(pricing, false)
+	file, err := os.Open(results)
+	if err != nil {
+		return model.cost, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	var columns map[string]int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return model.cost, fmt.Errorf("failed to read %s: %w", results, err)
+		}
+		//the writer repeats the header if later traces add tags
+		if len(record) > 0 && record[0] == "ID" {
+			columns = make(map[string]int, len(record))
+			for i, name := range record {
+				columns[name] = i
+			}
+			continue
+		}
+		if columns == nil {
+			return model.cost, fmt.Errorf("%s has no header", results)
+		}
+		if err := w.bill(model, columns, record); err != nil {
+			return model.cost, err
+		}
+	}
+
+	if w.Uses("io") && strings.ToLower(w.Backend) != "fs" {
+		model.storage("io-objects", w.Backend, 0, int64(len(w.Keys)))
+	}
+	return model.total(), nil
+}
+
+// bill adds a result row, see fact.CSVWriter for the columns
+func (w PerformanceWorkload) bill(model *costModel, columns map[string]int, record []string) error {
+	value := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	//execution latency in nanoseconds, requests without one (e.g. timeouts) are billed at the timeout
+	latency, err := strconv.ParseInt(value("ELat"), 10, 64)
+	if err != nil {
+		timeout, terr := model.timeout(w.Deployment)
+		if terr != nil {
+			return fmt.Errorf("can't bill the request %s without execution time: %w", value("ID"), terr)
+		}
+		log.Debugf("billing a request without execution time %q at the timeout %s", value("ELat"), timeout)
+		latency = int64(timeout)
+		model.cost.Unmeasured++
+	}
+
+	entry := MixEntry{Type: w.Type, Level: w.Level}
+	for _, e := range w.Mix {
+		if e.Class() == value("T_class") {
+			entry = e
+		}
+	}
+	class := entry.Class()
+	if err := model.invoke(class, w.Deployment, 1, time.Duration(latency)); err != nil {
+		return err
+	}
+	if single := w.mixed(entry); single.Type == "io" {
+		reads, writes := single.ioOperations()
+		model.storage(class, w.Backend, reads, writes)
+	}
+
+	if w.Workflow == nil {
+		return nil
+	}
+	for _, step := range w.Workflow.Steps {
+		execution := value("T_step." + step.Name + ".execution")
+		if execution == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(execution, 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := model.invoke("step."+step.Name, w.stepDeployment(step), 1, time.Duration(ms)*time.Millisecond); err != nil {
+			return err
+		}
+		if single := w.mixed(MixEntry{Type: step.Type, Level: step.Level}); single.Type == "io" {
+			reads, writes := single.ioOperations()
+			model.storage("step."+step.Name, w.Backend, reads, writes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package set
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testPricing = &Pricing{
+	Currency: "USD",
+	Platforms: map[string]PlatformPricing{
+		"aws":   {Request: 0.0000002, GBSecond: 0.0000166667, Granularity: time.Millisecond, DefaultTimeout: 3 * time.Second},
+		"azure": {Request: 0.0000002, GBSecond: 0.000016, MinDuration: 100 * time.Millisecond, MemoryStep: 128, DefaultMemory: 256},
+	},
+	Storage: map[string]StoragePricing{"s3": {Read: 0.0000004, Write: 0.000005}},
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEstimateCost(t *testing.T) {
+	w := PerformanceWorkload{
+		Mix:        []MixEntry{{Type: "idle", Level: 1, Weight: 1}, {Type: "io", Level: 0, Weight: 1}},
+		Deployment: Deployment{Source: "functions/aws/go", FunctionMemory: 512, FunctionTimeout: 10 * time.Second},
+	}
+	plan := ExperimentPlan{
+		Invocations: 2000,
+		Classes:     map[string]int64{"idle-1": 1000, "io-0": 1000},
+		IO:          &IOPlan{Objects: 10},
+	}
+	cost, err := w.EstimateCost(testPricing, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//idle sleeps 2s, io has no calibration and runs until the 10s timeout, both at 0.5GiB
+	if idle := cost.Classes["idle-1"]; idle.Basis != "idle" || idle.Duration != 2*time.Second {
+		t.Errorf("unexpected idle estimate %+v", idle)
+	}
+	if io := cost.Classes["io-0"]; io.Basis != "timeout" {
+		t.Errorf("unexpected io estimate %+v", io)
+	}
+	if !near(cost.GBSeconds, 1000*2*0.5+1000*10*0.5) {
+		t.Errorf("expected 6000 GB-seconds, got %f", cost.GBSeconds)
+	}
+	//io level 0 has no reads (rw 0) and writes 1000 times per job, plus the upload of 10 objects
+	if cost.StorageReads != 0 || cost.StorageWrites != 1000*1000+10 {
+		t.Errorf("unexpected storage operations %d/%d", cost.StorageReads, cost.StorageWrites)
+	}
+	expected := 2000*0.0000002 + 6000*0.0000166667 + (1e6+10)*0.000005
+	if !near(cost.Total, expected) || !cost.Estimated {
+		t.Errorf("expected an estimate of %f, got %f", expected, cost.Total)
+	}
+
+	//without a timeout io runs until the 3s default of aws
+	w.Deployment.FunctionTimeout = 0
+	cost, err = w.EstimateCost(testPricing, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if io := cost.Classes["io-0"]; io.Duration != 3*time.Second {
+		t.Errorf("expected the default timeout, got %+v", io)
+	}
+
+	w.Deployment.Source = "functions/azf/go"
+	if _, err := w.EstimateCost(testPricing, plan); err == nil {
+		t.Error("a deployment without any timeout was estimated")
+	}
+
+	//azure bills the memory of its plan, whatever the deployment asks for
+	w.Deployment = Deployment{Source: "functions/azf/go", FunctionMemory: 2048, FunctionTimeout: 10 * time.Second, Azure: &AzureConfig{}}
+	cost, err = w.EstimateCost(testPricing, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(cost.GBSeconds, 1000*2*0.25+1000*10*0.25) {
+		t.Errorf("expected 3000 GB-seconds at the default 256MiB, got %f", cost.GBSeconds)
+	}
+	w.Deployment = Deployment{Source: "functions/ibm/go", FunctionTimeout: 10 * time.Second}
+	if _, err := w.EstimateCost(testPricing, plan); err == nil {
+		t.Error("a platform without pricing was estimated")
+	}
+}
+
+func TestActualCost(t *testing.T) {
+	results := filepath.Join(t.TempDir(), "results.csv")
+	//ELat is in nanoseconds, the header is repeated once the step tags show up
+	csv := "ID,ChildOf,Timestamp,ELat,T_class\n" +
+		"a,,0,40000000,prime-1\n" +
+		"b,,0,150000000,prime-1\n" +
+		"ID,ChildOf,Timestamp,ELat,T_class,T_step.resize.execution\n" +
+		"c,,0,20000000,prime-1,30\n"
+	if err := ioutil.WriteFile(results, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	step := Deployment{Source: "functions/azf/go", Azure: &AzureConfig{}}
+	w := PerformanceWorkload{
+		Type:       "prime",
+		Level:      1,
+		Workflow:   &Workflow{Steps: []WorkflowStep{{Name: "resize", Type: "prime", Level: 1, Deployment: &step}}},
+		Deployment: Deployment{Source: "functions/aws/go", FunctionMemory: 1024},
+	}
+	cost, err := w.ActualCost(testPricing, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Estimated || cost.Invocations != 4 || cost.Classes["prime-1"].Invocations != 3 {
+		t.Fatalf("unexpected cost %+v", cost)
+	}
+	//the step is billed 100ms at the default 256MiB of azure
+	if mean := cost.Classes["prime-1"].Duration; mean != 70*time.Millisecond {
+		t.Errorf("expected a mean of 70ms, got %s", mean)
+	}
+	if !near(cost.GBSeconds, 0.21+0.1*0.25) {
+		t.Errorf("expected 0.235 GB-seconds, got %f", cost.GBSeconds)
+	}
+
+	//a request that timed out has no execution time, it is billed at the timeout
+	if err := ioutil.WriteFile(results, []byte(csv+"d,,0,,prime-1,\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.Deployment.FunctionTimeout = 2 * time.Second
+	cost, err = w.ActualCost(testPricing, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Unmeasured != 1 || !near(cost.GBSeconds, 0.21+0.1*0.25+2) {
+		t.Errorf("expected the timed out request billed for 2s, got %+v", cost)
+	}
+	w.Deployment = Deployment{Source: "functions/azf/go", Azure: &AzureConfig{}}
+	if _, err := w.ActualCost(testPricing, results); err == nil {
+		t.Error("a request without execution time was billed without any timeout")
+	}
+}
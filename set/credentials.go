@@ -0,0 +1,149 @@
+package set
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+// environment variables used to hand the IO credentials to the deployed functions
+const (
+	KeyIDEnv  = "SET_IO_KEY_ID"
+	SecretEnv = "SET_IO_SECRET"
+)
+
+const redacted = "[redacted]"
+
+// Secret holds a credential that must never end up in logs, payloads or result files.
+// Printing or serializing a Secret yields a placeholder, use Value to access the actual secret.
+type Secret string
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// Credentials describes where SET finds the credentials for the IO storage.
+// If nothing is configured we fall back to SET_IO_KEY_ID/SET_IO_SECRET and then AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY.
+type Credentials struct {
+	//shared credentials file in the AWS ini format and the profile to use
+	File    string `json:"file,omitempty" yaml:"file"`
+	Profile string `json:"profile,omitempty" yaml:"profile"`
+
+	//secret references in the form env:NAME or file:/path/to/secret
+	KeyIDRef  string `json:"keyIdRef,omitempty" yaml:"keyIdRef"`
+	SecretRef string `json:"secretRef,omitempty" yaml:"secretRef"`
+}
+
+// ResolveCredentials fills AccessKeyID and AccessKeySecret from the configured credential source.
+func (w *PerformanceWorkload) ResolveCredentials() error {
+	if w.AccessKeyID != "" || w.AccessKeySecret != "" {
+		log.Warn("plain text credentials in the workload file are deprecated, use credentials or SET_IO_KEY_ID/SET_IO_SECRET")
+		return nil
+	}
+
+	if c := w.Credentials; c != nil {
+		if c.KeyIDRef != "" || c.SecretRef != "" {
+			keyID, err := resolveSecretRef(c.KeyIDRef)
+			if err != nil {
+				return err
+			}
+			secret, err := resolveSecretRef(c.SecretRef)
+			if err != nil {
+				return err
+			}
+			w.AccessKeyID = keyID
+			w.AccessKeySecret = Secret(secret)
+			return nil
+		}
+
+		if c.File != "" || c.Profile != "" {
+			value, err := credentials.NewSharedCredentials(expandHome(c.File), c.Profile).Get()
+			if err != nil {
+				return fmt.Errorf("failed to read credentials file %s %+v", c.File, err)
+			}
+			w.AccessKeyID = value.AccessKeyID
+			w.AccessKeySecret = Secret(value.SecretAccessKey)
+			return nil
+		}
+	}
+
+	if keyID, ok := os.LookupEnv(KeyIDEnv); ok {
+		w.AccessKeyID = keyID
+		w.AccessKeySecret = Secret(os.Getenv(SecretEnv))
+	} else {
+		w.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		w.AccessKeySecret = Secret(os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	}
+	return nil
+}
+
+// FunctionSecrets returns the environment the deployed functions need to access the IO storage.
+func (w *PerformanceWorkload) FunctionSecrets() map[string]Secret {
+	if w.AccessKeyID == "" && w.AccessKeySecret == "" {
+		return nil
+	}
+	return map[string]Secret{
+		KeyIDEnv:  Secret(w.AccessKeyID),
+		SecretEnv: w.AccessKeySecret,
+	}
+}
+
+func resolveSecretRef(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("secret reference %s must be env:NAME or file:PATH", ref)
+	}
+
+	switch parts[0] {
+	case "env":
+		value, ok := os.LookupEnv(parts[1])
+		if !ok {
+			return "", fmt.Errorf("secret reference %s is not set", ref)
+		}
+		return value, nil
+	case "file":
+		data, err := ioutil.ReadFile(expandHome(parts[1]))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret reference %s %+v", ref, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", fmt.Errorf("unknown secret reference type %s", parts[0])
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
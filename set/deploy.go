@@ -3,60 +3,136 @@ package set
 import (
 	"fmt"
 	"github.com/google/martian/log"
+	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 )
 
 //Assumptions:
-//1.) we have a folders workloads/{go,python}/ containing the base function files
-//2.) we have a folders functions/{aws,ow,gcf,azf}/{go,python}/ containg a Makefile with three rules: deploy, remove, update,info
+//1.) we have a folders workloads/{go,python,node,java}/ containing the base function files and a manifest.yml listing them
+//2.) the deployment source functions/<platform>/<runtime>/ has a manifest.yml (see package.go) and a Makefile with the rules: deploy, remove, update, info
+//3.) info prints the deployed function as json line, see DeploymentResult
+//4.) deploy and update deploy the packaged artifact passed as ARTIFACT
+
+// workloadManifest lists the files of a workload runtime that are copied into the function folders
+type workloadManifest struct {
+	//folder inside functions/<platform>/<runtime> the files are copied to
+	Prefix string   `yaml:"prefix"`
+	Files  []string `yaml:"files"`
+}
 
-const goFiles = "function.go"
-const pyFiles = "bencher.py Pipfile"
+func readWorkloadManifest(runtime string) (workloadManifest, error) {
+	var manifest workloadManifest
+	path := filepath.Join("workloads", runtime, "manifest.yml")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return manifest, nil
+}
 
-const targets = "aws ow gcf azf"
+// DefaultArtifactCache is the directory packaged functions are kept in if no other is configured
+var DefaultArtifactCache = filepath.Join(".set", "artifacts")
 
+// MakefileDeployment packages the deployment source and deploys it with the rules of its Makefile.
 type MakefileDeployment struct {
+	//directory of the packaged artifacts, DefaultArtifactCache if empty
+	Cache string
+
+	deployedArtifacts
 }
 
-func (m MakefileDeployment) Deploy(d Deployment) (string, error) {
-	err := copyBase()
+func (m *MakefileDeployment) Deploy(d Deployment) (DeploymentResult, error) {
+	artifact, err := Package(d, cacheDir(m.Cache))
 	if err != nil {
-		return "", err
+		return DeploymentResult{}, err
 	}
-	msg, err := run(d, "deploy")
+	msg, err := run(d, "deploy", artifactEnv(artifact)...)
 	if err != nil {
-		return "", err
+		return DeploymentResult{}, err
 	}
+	m.deployed(d.Source, artifact)
 
 	log.Infof("deployed %s", msg)
 
+	result, err := m.Info(d)
+	if err != nil {
+		return result, err
+	}
+	if result.Version == "" {
+		result.Version = artifact.Hash
+	}
+	return result, nil
+}
+
+// Info reads the deployed function from the info rule, without deploying anything.
+func (m *MakefileDeployment) Info(d Deployment) (DeploymentResult, error) {
 	out, err := run(d, "info")
 	if err != nil {
-		return "", err
+		return DeploymentResult{}, err
 	}
-	return string(out), nil
+	result, err := ParseDeploymentResult(out)
+	if err != nil {
+		return result, fmt.Errorf("failed to read the info of %s: %w", d.Source, err)
+	}
+	if result.Region == "" {
+		result.Region = d.FunctionRegion
+	}
+	return result, nil
 }
 
-func (m MakefileDeployment) Remove(d Deployment) error {
+func (m *MakefileDeployment) Remove(d Deployment) error {
 	_, err := run(d, "remove")
 	return err
 }
 
-func (m MakefileDeployment) Change(d Deployment) error {
-	_, err := run(d, "update")
+func (m *MakefileDeployment) Change(d Deployment) error {
+	artifact, err := Package(d, cacheDir(m.Cache))
+	if err != nil {
+		return err
+	}
+	_, err = run(d, "update", artifactEnv(artifact)...)
+	if err == nil {
+		m.deployed(d.Source, artifact)
+	}
 	return err
 }
 
-func run(d Deployment, rule string) ([]byte, error) {
+func (m *MakefileDeployment) Plan(d Deployment) (DeploymentPlan, error) {
+	plan, _, err := planPackage("makefile", d, m.Cache)
+	if err != nil {
+		return plan, err
+	}
+	if _, err := os.Stat(filepath.Join(d.Source, "Makefile")); err != nil {
+		return plan, fmt.Errorf("the Makefile is missing at %s", d.Source)
+	}
+	plan.add("run make deploy in %s with MEM=%d TIMEOUT=%d REGION=%s",
+		d.Source, d.FunctionMemory, int(math.Ceil(d.FunctionTimeout.Seconds())), d.FunctionRegion)
+	plan.add("run make info in %s", d.Source)
+	return plan, nil
+}
+
+// artifactEnv hands the artifact to the Makefile, as absolute path since make runs in the source folder
+func artifactEnv(artifact Artifact) []string {
+	path, err := filepath.Abs(artifact.Path)
+	if err != nil {
+		path = artifact.Path
+	}
+	return []string{"ARTIFACT=" + path, "ARTIFACT_HASH=" + artifact.Hash}
+}
+
+func run(d Deployment, rule string, env ...string) ([]byte, error) {
 	cmd, err := makeCmd(d, rule)
 	if err != nil {
 		return nil, err
 	}
+	cmd.Env = append(cmd.Env, env...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -77,45 +153,13 @@ func makeCmd(d Deployment, rule string) (*exec.Cmd, error) {
 	cmd.Env = append(cmd.Env, fmt.Sprintf("MEM=%d", d.FunctionMemory))
 	cmd.Env = append(cmd.Env, fmt.Sprintf("TIMEOUT=%d", int(math.Ceil(d.FunctionTimeout.Seconds()))))
 	cmd.Env = append(cmd.Env, fmt.Sprintf("REGION=%s", d.FunctionRegion))
-	return cmd, nil
-}
-
-func copyBase() error {
-	err := copyFiles(
-		strings.Split(goFiles, " "),
-		strings.Split(targets, " "),
-		"go",
-		"bencher",
-	)
-	if err != nil {
-		return err
+	for k, v := range d.Environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
-
-	err = copyFiles(
-		strings.Split(pyFiles, " "),
-		strings.Split(targets, " "),
-		"python",
-		"",
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func copyFiles(files, targets []string, runtime, prefix string) error {
-	for _, f := range files {
-		for _, t := range targets {
-			src := filepath.Join("workloads", runtime, f)
-			dest := filepath.Join("functions", t, runtime, prefix, f)
-			err := copy(src, dest)
-			if err != nil {
-				return err
-			}
-		}
+	for k, v := range d.secrets {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v.Value()))
 	}
-	return nil
+	return cmd, nil
 }
 
 func copy(src, dst string) error {
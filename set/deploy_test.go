@@ -0,0 +1,125 @@
+package set
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestReadWorkloadManifest checks that the manifests of all workload runtimes list existing files
+func TestReadWorkloadManifest(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the driver resolves workloads/ from the repository root
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, runtime := range []string{"go", "python", "node", "java"} {
+		manifest, err := readWorkloadManifest(runtime)
+		if err != nil {
+			t.Errorf("missing manifest for %s: %v", runtime, err)
+			continue
+		}
+		for _, f := range manifest.Files {
+			if _, err := os.Stat(filepath.Join("workloads", runtime, f)); err != nil {
+				t.Errorf("%s manifest lists %s: %v", runtime, f, err)
+			}
+		}
+	}
+
+	functions, err := filepath.Glob(filepath.Join("functions", "*", "*", "manifest.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range functions {
+		manifest, err := readFunctionManifest(filepath.Dir(path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if _, err := readWorkloadManifest(manifest.Runtime); err != nil {
+			t.Errorf("%s uses unknown runtime %s", path, manifest.Runtime)
+		}
+	}
+}
+
+func TestPackage_Cache(t *testing.T) {
+	source := t.TempDir()
+	cache := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(source, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("manifest.yml", "sources:\n  - handler.js\n  - '*.json'\n")
+	write("handler.js", "exports.main = () => ({})")
+	write("package.json", "{}")
+
+	d := Deployment{Source: source}
+	first, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cached || first.Hash == "" {
+		t.Errorf("expected a fresh artifact, got %+v", first)
+	}
+	data, err := ioutil.ReadFile(first.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//neither timestamps nor the cache may change the artifact
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(source, "handler.js"), later, later)
+	os.Remove(first.Path)
+	rebuilt, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ioutil.ReadFile(rebuilt.Path)
+	if rebuilt.Hash != first.Hash || !bytes.Equal(data, again) {
+		t.Error("packaging the same sources twice gave different artifacts")
+	}
+
+	cached, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Cached || cached.Hash != first.Hash {
+		t.Errorf("expected the cached artifact, got %+v", cached)
+	}
+
+	write("handler.js", "exports.main = () => ({changed: true})")
+	changed, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Cached || changed.SourceHash == first.SourceHash {
+		t.Errorf("changed sources reused the artifact %+v", changed)
+	}
+
+	//the build rules change the artifact as much as the sources do
+	write("Makefile", "build:\n\ttrue\n")
+	rules, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Cached || rules.SourceHash == changed.SourceHash {
+		t.Errorf("a changed Makefile reused the artifact %+v", rules)
+	}
+	write("manifest.yml", "sources:\n  - handler.js\n")
+	manifest, err := Package(d, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Cached || manifest.SourceHash == rules.SourceHash {
+		t.Errorf("a changed manifest reused the artifact %+v", manifest)
+	}
+}
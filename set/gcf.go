@@ -0,0 +1,325 @@
+package set
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GCFConfig describes a deployment to Google Cloud Functions (1st gen).
+type GCFConfig struct {
+	Project string `json:"project" yaml:"project"`
+	//name of the function, defaults to bencher
+	Name string `json:"name,omitempty" yaml:"name"`
+	//function called by the trigger, defaults to the entry point of the function folder runtime
+	EntryPoint string `json:"entryPoint,omitempty" yaml:"entryPoint"`
+	//allow unauthenticated invocations, the invoker sends no credentials
+	Public bool `json:"public,omitempty" yaml:"public"`
+
+	//access token (e.g. of gcloud auth print-access-token) as env:NAME or file:PATH reference
+	TokenRef string `json:"tokenRef,omitempty" yaml:"tokenRef"`
+	//cloud functions api, only changed for tests
+	API string `json:"api,omitempty" yaml:"api"`
+}
+
+func (c GCFConfig) name() string {
+	if c.Name == "" {
+		return "bencher"
+	}
+	return c.Name
+}
+
+// gcfRuntimes are the runtimes and entry points of the function folders by workload runtime
+var gcfRuntimes = map[string][2]string{
+	"go":     {"go116", "Bench"},
+	"python": {"python38", "bench"},
+}
+
+// gcfRuntime returns the runtime and entry point of the deployment, the defaults of the function folder fill in what it doesn't set
+func gcfRuntime(d Deployment, manifest FunctionManifest) (string, string, error) {
+	runtime, entryPoint := d.FunctionRuntime, d.GCF.EntryPoint
+	defaults, ok := gcfRuntimes[manifest.Runtime]
+	if !ok && (runtime == "" || entryPoint == "") {
+		return "", "", fmt.Errorf("no gcf runtime for %s, set runtime and entryPoint", manifest.Runtime)
+	}
+	if runtime == "" {
+		runtime = defaults[0]
+	}
+	if entryPoint == "" {
+		entryPoint = defaults[1]
+	}
+	return runtime, entryPoint, nil
+}
+
+const gcfAPI = "https://cloudfunctions.googleapis.com/v1"
+
+// GCFDeployment deploys the packaged source through the Cloud Functions api.
+// The deployment region selects the location, the runtime defaults to the one of the function folder.
+type GCFDeployment struct {
+	//directory of the packaged artifacts, DefaultArtifactCache if empty
+	Cache  string
+	Client *http.Client
+	//how long a deployment operation may take
+	ReadyTimeout time.Duration
+
+	deployedArtifacts
+}
+
+// NewGCFDeployment returns a Cloud Functions platform.
+func NewGCFDeployment(cache string) *GCFDeployment {
+	return &GCFDeployment{
+		Cache:        cache,
+		Client:       &http.Client{Timeout: 5 * time.Minute},
+		ReadyTimeout: 10 * time.Minute,
+	}
+}
+
+type gcfFunction struct {
+	Name                 string            `json:"name"`
+	EntryPoint           string            `json:"entryPoint,omitempty"`
+	Runtime              string            `json:"runtime,omitempty"`
+	AvailableMemoryMb    int64             `json:"availableMemoryMb,omitempty"`
+	Timeout              string            `json:"timeout,omitempty"`
+	SourceUploadURL      string            `json:"sourceUploadUrl,omitempty"`
+	EnvironmentVariables map[string]string `json:"environmentVariables,omitempty"`
+	HTTPSTrigger         *gcfTrigger       `json:"httpsTrigger,omitempty"`
+	Status               string            `json:"status,omitempty"`
+	VersionID            string            `json:"versionId,omitempty"`
+}
+
+type gcfTrigger struct {
+	URL string `json:"url,omitempty"`
+}
+
+type gcfOperation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (g *GCFDeployment) Deploy(d Deployment) (DeploymentResult, error) {
+	api, err := g.api(d)
+	if err != nil {
+		return DeploymentResult{}, err
+	}
+	if err := g.apply(api, d); err != nil {
+		return DeploymentResult{}, err
+	}
+
+	if d.GCF.Public {
+		policy := map[string]interface{}{
+			"policy": map[string]interface{}{
+				"bindings": []interface{}{map[string]interface{}{
+					"role":    "roles/cloudfunctions.invoker",
+					"members": []string{"allUsers"},
+				}},
+			},
+		}
+		if _, err := api.do(http.MethodPost, g.function(d)+":setIamPolicy", policy, nil); err != nil {
+			return DeploymentResult{}, err
+		}
+	}
+
+	function := gcfFunction{}
+	if _, err := api.do(http.MethodGet, g.function(d), nil, &function); err != nil {
+		return DeploymentResult{}, err
+	}
+	if function.HTTPSTrigger == nil || function.HTTPSTrigger.URL == "" {
+		return DeploymentResult{}, fmt.Errorf("function %s has no https trigger", d.GCF.name())
+	}
+	log.Infof("deployed %s to %s", d.Source, function.HTTPSTrigger.URL)
+	return DeploymentResult{
+		URL:      function.HTTPSTrigger.URL,
+		Function: d.GCF.name(),
+		Region:   g.region(d),
+		Version:  function.VersionID,
+	}, nil
+}
+
+func (g *GCFDeployment) Change(d Deployment) error {
+	api, err := g.api(d)
+	if err != nil {
+		return err
+	}
+	return g.apply(api, d)
+}
+
+func (g *GCFDeployment) Remove(d Deployment) error {
+	api, err := g.api(d)
+	if err != nil {
+		return err
+	}
+	operation := gcfOperation{}
+	if _, err := api.do(http.MethodDelete, g.function(d), nil, &operation); err != nil {
+		return err
+	}
+	return g.await(api, operation)
+}
+
+func (g *GCFDeployment) Plan(d Deployment) (DeploymentPlan, error) {
+	if d.GCF == nil || d.GCF.Project == "" {
+		return DeploymentPlan{}, fmt.Errorf("the deployment of %s has no gcf project", d.Source)
+	}
+	plan, manifest, err := planPackage("gcf", d, g.Cache)
+	if err != nil {
+		return plan, err
+	}
+	runtime, entryPoint, err := gcfRuntime(d, manifest)
+	if err != nil {
+		return plan, err
+	}
+	plan.Runtime = runtime
+	plan.Region = g.region(d)
+
+	//the source is kept if the deployed artifact is the cached one
+	if last, ok := g.Artifact(d.Source); !ok || !plan.Artifact.Cached || last.Hash != plan.Artifact.Hash {
+		plan.add("upload the artifact to a signed upload url of %s", g.location(d))
+	}
+	plan.add("create or update the function %s (%s, entry point %s, %dMB, timeout %ds)",
+		strings.TrimPrefix(g.function(d), "/"), plan.Runtime, entryPoint, plan.MemoryMiB, timeoutSeconds(d))
+	if d.GCF.Public {
+		plan.add("allow unauthenticated invocations of %s", d.GCF.name())
+	}
+	return plan, nil
+}
+
+func (g *GCFDeployment) api(d Deployment) (restClient, error) {
+	if d.GCF == nil {
+		return restClient{}, fmt.Errorf("the deployment of %s has no gcf settings", d.Source)
+	}
+	if d.GCF.Project == "" {
+		return restClient{}, fmt.Errorf("the deployment of %s has no gcf project", d.Source)
+	}
+	base := d.GCF.API
+	if base == "" {
+		base = gcfAPI
+	}
+	rest := newRestClient(g.Client, base)
+	token, err := resolveSecretRef(d.GCF.TokenRef)
+	if err != nil {
+		return rest, err
+	}
+	if token != "" {
+		rest.auth = func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	return rest, nil
+}
+
+func (g *GCFDeployment) region(d Deployment) string {
+	if d.FunctionRegion == "" {
+		return "us-central1"
+	}
+	return d.FunctionRegion
+}
+
+func (g *GCFDeployment) location(d Deployment) string {
+	return fmt.Sprintf("/projects/%s/locations/%s", d.GCF.Project, g.region(d))
+}
+
+func (g *GCFDeployment) function(d Deployment) string {
+	return g.location(d) + "/functions/" + d.GCF.name()
+}
+
+// apply creates or updates the function, the source is only uploaded if the artifact changed
+func (g *GCFDeployment) apply(api restClient, d Deployment) error {
+	manifest, err := readFunctionManifest(d.Source)
+	if err != nil {
+		return err
+	}
+	//checked before anything is built or uploaded
+	runtime, entryPoint, err := gcfRuntime(d, manifest)
+	if err != nil {
+		return err
+	}
+	artifact, err := Package(d, cacheDir(g.Cache))
+	if err != nil {
+		return err
+	}
+
+	function := gcfFunction{
+		Name:                 strings.TrimPrefix(g.function(d), "/"),
+		EntryPoint:           entryPoint,
+		Runtime:              runtime,
+		AvailableMemoryMb:    memoryMiB(d.FunctionMemory),
+		EnvironmentVariables: functionEnv(d),
+	}
+	if timeout := timeoutSeconds(d); timeout > 0 {
+		function.Timeout = fmt.Sprintf("%ds", timeout)
+	}
+
+	status, err := api.do(http.MethodGet, g.function(d), nil, nil)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	exists := status != http.StatusNotFound
+
+	mask := []string{"entryPoint", "runtime", "availableMemoryMb", "timeout", "environmentVariables"}
+	last, ok := g.Artifact(d.Source)
+	if !exists || !ok || last.Hash != artifact.Hash {
+		if function.SourceUploadURL, err = g.upload(api, d, artifact); err != nil {
+			return err
+		}
+		mask = append(mask, "sourceUploadUrl")
+	}
+
+	operation := gcfOperation{}
+	if exists {
+		_, err = api.do(http.MethodPatch, g.function(d)+"?updateMask="+strings.Join(mask, ","), function, &operation)
+	} else {
+		function.HTTPSTrigger = &gcfTrigger{}
+		_, err = api.do(http.MethodPost, g.location(d)+"/functions", function, &operation)
+	}
+	if err != nil {
+		return err
+	}
+	if err := g.await(api, operation); err != nil {
+		return err
+	}
+	g.deployed(d.Source, artifact)
+	return nil
+}
+
+// upload puts the artifact to a signed upload url, which must not get the api credentials
+func (g *GCFDeployment) upload(api restClient, d Deployment, artifact Artifact) (string, error) {
+	target := struct {
+		UploadURL string `json:"uploadUrl"`
+	}{}
+	if _, err := api.do(http.MethodPost, g.location(d)+"/functions:generateUploadUrl", struct{}{}, &target); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(artifact.Path)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/zip")
+	header.Set("X-Goog-Content-Length-Range", "0,104857600")
+	anonymous := newRestClient(api.client, "")
+	if _, _, err := anonymous.send(http.MethodPut, target.UploadURL, header, data, nil); err != nil {
+		return "", err
+	}
+	return target.UploadURL, nil
+}
+
+// await polls the long running operation until it is done
+func (g *GCFDeployment) await(api restClient, operation gcfOperation) error {
+	err := poll(g.ReadyTimeout, func() (bool, error) {
+		if !operation.Done {
+			if _, err := api.do(http.MethodGet, "/"+operation.Name, nil, &operation); err != nil {
+				return false, err
+			}
+		}
+		if operation.Done && operation.Error != nil {
+			return false, fmt.Errorf("operation %s failed: %s", operation.Name, operation.Error.Message)
+		}
+		return operation.Done, nil
+	})
+	return err
+}
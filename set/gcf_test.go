@@ -0,0 +1,254 @@
+package set
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testdata is resolved before the tests change into the repository root
+var testdata, _ = filepath.Abs("testdata")
+
+type fixtureResponse struct {
+	status  int
+	fixture string
+}
+
+// fixtureServer answers "METHOD path" with the fixtures of testdata/, one per call with the last one repeated
+type fixtureServer struct {
+	*httptest.Server
+	t *testing.T
+
+	lock      sync.Mutex
+	routes    map[string][]fixtureResponse
+	requests  map[string][][]byte
+	headers   map[string]http.Header
+	unmatched []string
+}
+
+func newFixtureServer(t *testing.T, routes map[string][]fixtureResponse) *fixtureServer {
+	s := &fixtureServer{t: t, routes: routes, requests: make(map[string][][]byte), headers: make(map[string]http.Header)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		key := r.Method + " " + r.URL.Path
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.requests[key] = append(s.requests[key], body)
+		s.headers[key] = r.Header
+		responses, ok := s.routes[key]
+		if !ok {
+			s.unmatched = append(s.unmatched, key)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		response := responses[0]
+		if len(responses) > 1 {
+			s.routes[key] = responses[1:]
+		}
+		if response.fixture != "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		for k, v := range s.header(key) {
+			w.Header().Set(k, v)
+		}
+		status := response.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		if response.fixture != "" {
+			w.Write(fixture(t, response.fixture, s.URL))
+		}
+	}))
+	return s
+}
+
+// header returns the response headers of a route, only the kudu deployment needs one
+func (s *fixtureServer) header(key string) map[string]string {
+	if key == "POST /api/zipdeploy" {
+		return map[string]string{"Location": s.URL + "/api/deployments/latest"}
+	}
+	return nil
+}
+
+func (s *fixtureServer) request(key string, i int) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests[key]) <= i {
+		s.t.Fatalf("expected %d calls of %s, got %d", i+1, key, len(s.requests[key]))
+	}
+	return s.requests[key][i]
+}
+
+func (s *fixtureServer) calls(key string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.requests[key])
+}
+
+// fixture reads a file of testdata/ and replaces {{server}} with the url of the mock server
+func fixture(t *testing.T, name, server string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(testdata, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.ReplaceAll(data, []byte("{{server}}"), []byte(server))
+}
+
+func assertJSON(t *testing.T, name string, expected, actual []byte) {
+	var e, a interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		t.Fatalf("%s: %v in %s", name, err, actual)
+	}
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("%s: expected %s, got %s", name, expected, actual)
+	}
+}
+
+// functionSource writes a function folder of the go workload, the test runs in the repository root to find workloads/
+func functionSource(t *testing.T, manifest string, files ...string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	source := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(source, "manifest.yml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(source, f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(source, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return source
+}
+
+func TestGCFDeployment(t *testing.T) {
+	api := newFixtureServer(t, map[string][]fixtureResponse{
+		"POST /projects/set-bench/locations/europe-west3/functions:generateUploadUrl": {{fixture: "gcf/generateUploadUrl.json"}},
+		"PUT /upload/bencher.zip": {{}},
+		"GET /projects/set-bench/locations/europe-west3/functions/bencher": {
+			{status: http.StatusNotFound},
+			{fixture: "gcf/function.json"},
+		},
+		"POST /projects/set-bench/locations/europe-west3/functions":                      {{fixture: "gcf/operation.json"}},
+		"PATCH /projects/set-bench/locations/europe-west3/functions/bencher":             {{fixture: "gcf/operation.json"}},
+		"GET /operations/c2V0LWJlbmNoL3VzLWNlbnRyYWwxL2JlbmNoZXIvYWJj":                   {{fixture: "gcf/operation_done.json"}},
+		"POST /projects/set-bench/locations/europe-west3/functions/bencher:setIamPolicy": {{fixture: "gcf/function.json"}},
+		"DELETE /projects/set-bench/locations/europe-west3/functions/bencher":            {{fixture: "gcf/operation_done.json"}},
+	})
+	defer api.Close()
+
+	source := functionSource(t, "runtime: go\nsources:\n  - function.go\n  - go.mod\n", "function.go", "go.mod")
+	os.Setenv("SET_TEST_GCF_TOKEN", "ya29.token")
+	defer os.Unsetenv("SET_TEST_GCF_TOKEN")
+
+	platform := &GCFDeployment{Cache: t.TempDir(), ReadyTimeout: 5 * time.Second}
+	d := Deployment{
+		Source:          source,
+		FunctionMemory:  512,
+		FunctionTimeout: time.Minute,
+		FunctionRegion:  "europe-west3",
+		GCF:             &GCFConfig{Project: "set-bench", Public: true, TokenRef: "env:SET_TEST_GCF_TOKEN", API: api.URL},
+	}.WithSecrets(map[string]Secret{"SET_IO_SECRET": "s3cret"})
+
+	result, err := platform.Deploy(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DeploymentResult{
+		URL:      "https://europe-west3-set-bench.cloudfunctions.net/bencher",
+		Function: "bencher",
+		Region:   "europe-west3",
+		Version:  "1",
+	}
+	if result != expected {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(api.unmatched) > 0 {
+		t.Errorf("unexpected calls %v", api.unmatched)
+	}
+	assertJSON(t, "create", fixture(t, "gcf/create_request.json", api.URL), api.request("POST /projects/set-bench/locations/europe-west3/functions", 0))
+
+	//the signed upload url must not get the api token
+	if auth := api.headers["PUT /upload/bencher.zip"].Get("Authorization"); auth != "" {
+		t.Errorf("the upload was sent with credentials %s", auth)
+	}
+	if auth := api.headers["GET /projects/set-bench/locations/europe-west3/functions/bencher"].Get("Authorization"); auth != "Bearer ya29.token" {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+	upload := api.request("PUT /upload/bencher.zip", 0)
+	archive, err := zip.NewReader(bytes.NewReader(upload), int64(len(upload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	if !strings.Contains(strings.Join(names, ","), "bencher/function.go") {
+		t.Errorf("the upload lacks the workload: %v", names)
+	}
+
+	//an unchanged source is not uploaded again
+	d.FunctionMemory = 1024
+	if err := platform.Change(d); err != nil {
+		t.Fatal(err)
+	}
+	if api.calls("PUT /upload/bencher.zip") != 1 {
+		t.Error("the unchanged source was uploaded again")
+	}
+	assertJSON(t, "update", fixture(t, "gcf/update_request.json", api.URL), api.request("PATCH /projects/set-bench/locations/europe-west3/functions/bencher", 0))
+
+	if err := platform.Remove(d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGCFRuntime(t *testing.T) {
+	source := functionSource(t, "runtime: node\nsources:\n  - index.js\n", "index.js")
+	d := Deployment{Source: source, GCF: &GCFConfig{Project: "set-bench"}}
+	platform := &GCFDeployment{Cache: t.TempDir()}
+
+	//node has no defaults, nothing may be uploaded with an empty runtime
+	if _, err := platform.Plan(d); err == nil || !strings.Contains(err.Error(), "no gcf runtime for node") {
+		t.Errorf("expected the missing runtime to fail the plan, got %v", err)
+	}
+
+	d.FunctionRuntime = "nodejs16"
+	d.GCF.EntryPoint = "bench"
+	plan, err := platform.Plan(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Runtime != "nodejs16" {
+		t.Errorf("unexpected runtime %s", plan.Runtime)
+	}
+
+	runtime, entryPoint, err := gcfRuntime(Deployment{GCF: &GCFConfig{}}, FunctionManifest{Runtime: "go"})
+	if err != nil || runtime != "go116" || entryPoint != "Bench" {
+		t.Errorf("unexpected go defaults %s %s: %v", runtime, entryPoint, err)
+	}
+}
@@ -0,0 +1,127 @@
+package set
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/faas-facts/bench/bencher"
+)
+
+// MixEntry is one request class of a mixed workload.
+type MixEntry struct {
+	Type   string  `json:"type" yaml:"type"`
+	Level  byte    `json:"complexity" yaml:"complexity"`
+	Weight float64 `json:"weight" yaml:"weight"`
+}
+
+// Class names the request class, e.g. prime-1, it is recorded with every request of the class.
+func (e MixEntry) Class() string {
+	return fmt.Sprintf("%s-%d", e.Type, e.Level)
+}
+
+// mixed returns the single type workload of a mix entry or workflow step, sharing everything else with w.
+func (w PerformanceWorkload) mixed(entry MixEntry) PerformanceWorkload {
+	single := w
+	single.Type = entry.Type
+	single.Level = entry.Level
+	single.Mix = nil
+	single.Workflow = nil
+	return single
+}
+
+// singles lists the single type workloads of all requests, including the steps of a workflow.
+func (w PerformanceWorkload) singles() []PerformanceWorkload {
+	singles := make([]PerformanceWorkload, 0, len(w.Mix)+1)
+	if len(w.Mix) == 0 {
+		singles = append(singles, w.mixed(MixEntry{Type: w.Type, Level: w.Level}))
+	}
+	for _, entry := range w.Mix {
+		singles = append(singles, w.mixed(entry))
+	}
+	if w.Workflow != nil {
+		for _, step := range w.Workflow.Steps {
+			singles = append(singles, w.mixed(MixEntry{Type: step.Type, Level: step.Level}))
+		}
+	}
+	return singles
+}
+
+// Uses reports if any of the requests run the job type, e.g. io requests need credentials and input objects.
+func (w PerformanceWorkload) Uses(jobType string) bool {
+	for _, single := range w.singles() {
+		if single.Type == jobType {
+			return true
+		}
+	}
+	return false
+}
+
+// ioObjects returns the size and number of input objects, all io classes share the largest ones.
+func (w PerformanceWorkload) ioObjects() (int64, int) {
+	size, number := int64(0), 0
+	for _, single := range w.singles() {
+		if single.Type != "io" {
+			continue
+		}
+		task, _ := single.ioTask()
+		if task.ObjectSize > size {
+			size = task.ObjectSize
+		}
+		if task.ObjectNumber > number {
+			number = task.ObjectNumber
+		}
+	}
+	return size, number
+}
+
+// classWorkload is mixed with the input objects pinned to the ones shared by all io classes.
+func (w PerformanceWorkload) classWorkload(entry MixEntry) PerformanceWorkload {
+	single := w.mixed(entry)
+	if entry.Type == "io" {
+		params := IOParameters{}
+		if w.IOParams != nil {
+			params = *w.IOParams
+		}
+		size, number := w.ioObjects()
+		params.ObjectSize, params.ObjectNumber = &size, &number
+		single.IOParams = &params
+	}
+	return single
+}
+
+// mixPayload picks the class of every request by its weight.
+func (w PerformanceWorkload) mixPayload(seeds seedFunc) bencher.PayloadFunc {
+	total := 0.0
+	payloads := make([]bencher.PayloadFunc, len(w.Mix))
+	for i, entry := range w.Mix {
+		if entry.Weight <= 0 {
+			panic(fmt.Sprintf("mix entry %s needs a positive weight", entry.Class()))
+		}
+		total += entry.Weight
+		payloads[i] = w.classWorkload(entry).payload(entry.Class(), seeds)
+	}
+
+	//the choice of classes is reproducible for seeded workloads
+	seed := time.Now().UnixNano()
+	if w.Seed != nil {
+		seed = *w.Seed
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	lock := sync.Mutex{}
+
+	return func(invoker bencher.Invoker) []byte {
+		lock.Lock()
+		pick := rnd.Float64() * total
+		lock.Unlock()
+
+		for i, entry := range w.Mix {
+			if pick < entry.Weight {
+				return payloads[i](invoker)
+			}
+			pick -= entry.Weight
+		}
+		return payloads[len(payloads)-1](invoker)
+	}
+}
@@ -0,0 +1,53 @@
+package set
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestMixPayload_Weights(t *testing.T) {
+	seed := int64(7)
+	w := PerformanceWorkload{
+		Seed: &seed,
+		Mix: []MixEntry{
+			{Type: "prime", Level: 1, Weight: 70},
+			{Type: "memory", Level: 3, Weight: 20},
+			{Type: "idle", Level: 0, Weight: 10},
+		},
+	}
+
+	payload := w.Payload()
+	counts := make(map[string]int)
+	n := 10000
+	for i := 0; i < n; i++ {
+		job := Job{}
+		if err := json.Unmarshal(payload(nil), &job); err != nil {
+			t.Fatal(err)
+		}
+		switch job.Class {
+		case "prime-1":
+			if job.Prime == nil {
+				t.Fatalf("class %s without prime job", job.Class)
+			}
+		case "memory-3":
+			if job.Memory == nil {
+				t.Fatalf("class %s without memory job", job.Class)
+			}
+		case "idle-0":
+			if job.Idle == nil {
+				t.Fatalf("class %s without idle job", job.Class)
+			}
+		default:
+			t.Fatalf("unexpected class %q", job.Class)
+		}
+		counts[job.Class]++
+	}
+
+	for _, entry := range w.Mix {
+		share := float64(counts[entry.Class()]) / float64(n) * 100
+		if math.Abs(share-entry.Weight) > 2 {
+			t.Errorf("%s got %.1f%% of the requests, expected %.0f%%", entry.Class(), share, entry.Weight)
+		}
+	}
+}
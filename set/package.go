@@ -0,0 +1,392 @@
+package set
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+//Each function folder functions/<platform>/<runtime>/ has a manifest.yml describing how it is packaged:
+//which workload it embeds, which files it is built from, the Makefile rule that builds it and what ends up in the artifact.
+
+// FunctionManifest describes how a function folder is packaged.
+type FunctionManifest struct {
+	//workload runtime copied into the function, see workloads/<runtime>/manifest.yml
+	Runtime string `yaml:"runtime"`
+	//files (or globs) of the function folder the artifact is built from, the workload files are added automatically
+	Sources []string `yaml:"sources"`
+	//rule of the Makefile that builds the artifact content, empty if the sources are deployed as they are
+	Build string `yaml:"build"`
+	//files (or globs) packaged into the zip, defaults to the sources
+	Package []string `yaml:"package"`
+	//a build output that already is the artifact (e.g. a jar), used instead of a zip of the package files
+	Artifact string `yaml:"artifact"`
+}
+
+// Artifact is a packaged function, ready to be deployed by the rules of its Makefile.
+type Artifact struct {
+	Path string `json:"path" yaml:"path"`
+	//sha256 of the artifact file
+	Hash string `json:"hash" yaml:"hash"`
+	//sha256 over the sources the artifact was built from, key of the cache
+	SourceHash string `json:"sourceHash" yaml:"sourceHash"`
+	//true if the artifact was taken from the cache
+	Cached bool `json:"cached" yaml:"cached"`
+}
+
+// deployedArtifacts remembers the artifact last deployed per source, it is embedded by the platforms.
+type deployedArtifacts struct {
+	lock      sync.Mutex
+	artifacts map[string]Artifact
+}
+
+// Artifact returns the artifact last deployed from the source.
+func (a *deployedArtifacts) Artifact(source string) (Artifact, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	artifact, ok := a.artifacts[source]
+	return artifact, ok
+}
+
+func (a *deployedArtifacts) deployed(source string, artifact Artifact) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.artifacts == nil {
+		a.artifacts = make(map[string]Artifact)
+	}
+	a.artifacts[source] = artifact
+}
+
+// cacheDir returns the configured artifact cache or DefaultArtifactCache
+func cacheDir(cache string) string {
+	if cache == "" {
+		return DefaultArtifactCache
+	}
+	return cache
+}
+
+// zipTime is the modification time of all zip entries, so equal sources give byte-identical zips
+var zipTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func readFunctionManifest(source string) (FunctionManifest, error) {
+	var manifest FunctionManifest
+	path := filepath.Join(source, "manifest.yml")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("the manifest is missing at %s", source)
+	}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Package builds the artifact of the deployment source into the cache directory.
+// If an artifact of the same sources is already cached, the build is skipped.
+func Package(d Deployment, cache string) (Artifact, error) {
+	artifact := Artifact{}
+	manifest, err := readFunctionManifest(d.Source)
+	if err != nil {
+		return artifact, err
+	}
+
+	patterns := manifest.Sources
+	if manifest.Runtime != "" {
+		workload, err := copyWorkload(manifest.Runtime, d.Source)
+		if err != nil {
+			return artifact, err
+		}
+		patterns = append(workload, patterns...)
+	}
+
+	sources, err := expand(d.Source, patterns)
+	if err != nil {
+		return artifact, err
+	}
+	if len(sources) == 0 {
+		return artifact, fmt.Errorf("the manifest of %s lists no sources", d.Source)
+	}
+	//the folder is part of the key, functions of different platforms may share their sources
+	artifact.SourceHash, err = hashFiles(d.Source, filepath.ToSlash(filepath.Clean(d.Source)), withBuildFiles(d.Source, sources))
+	if err != nil {
+		return artifact, err
+	}
+
+	ext := ".zip"
+	if manifest.Artifact != "" {
+		ext = filepath.Ext(manifest.Artifact)
+	}
+	artifact.Path = filepath.Join(cache, artifact.SourceHash+ext)
+
+	if _, err := os.Stat(artifact.Path); err == nil {
+		log.Infof("using cached artifact %s for %s", artifact.Path, d.Source)
+		artifact.Cached = true
+		artifact.Hash, err = hashFile(artifact.Path)
+		return artifact, err
+	}
+
+	if manifest.Build != "" {
+		if _, err := run(d, manifest.Build); err != nil {
+			return artifact, fmt.Errorf("failed to build %s: %w", d.Source, err)
+		}
+	}
+
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return artifact, err
+	}
+	//write to a temp file first, an interrupted build must not end up in the cache
+	tmp, err := ioutil.TempFile(cache, "artifact-*"+ext)
+	if err != nil {
+		return artifact, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if manifest.Artifact != "" {
+		err = copyTo(tmp, filepath.Join(d.Source, manifest.Artifact))
+	} else {
+		files := sources
+		if len(manifest.Package) > 0 {
+			files, err = expand(d.Source, manifest.Package)
+			if err != nil {
+				tmp.Close()
+				return artifact, err
+			}
+		}
+		err = writeZip(tmp, d.Source, files)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return artifact, err
+	}
+
+	if err := os.Rename(tmp.Name(), artifact.Path); err != nil {
+		return artifact, err
+	}
+	artifact.Hash, err = hashFile(artifact.Path)
+	log.Infof("packaged %s into %s", d.Source, artifact.Path)
+	return artifact, err
+}
+
+// planArtifact predicts the artifact Package builds, without copying the workload or building anything.
+// Hash is only known if the artifact is cached already.
+func planArtifact(d Deployment, cache string) (Artifact, FunctionManifest, error) {
+	artifact := Artifact{}
+	manifest, err := readFunctionManifest(d.Source)
+	if err != nil {
+		return artifact, manifest, err
+	}
+
+	//the workload files are hashed where Package copies them from
+	paths := make(map[string]string)
+	if manifest.Runtime != "" {
+		workload, err := readWorkloadManifest(manifest.Runtime)
+		if err != nil {
+			return artifact, manifest, err
+		}
+		for _, f := range workload.Files {
+			paths[filepath.ToSlash(filepath.Join(workload.Prefix, f))] = filepath.Join("workloads", manifest.Runtime, f)
+		}
+	}
+	sources, err := expand(d.Source, manifest.Sources)
+	if err != nil {
+		return artifact, manifest, err
+	}
+	for _, f := range withBuildFiles(d.Source, sources) {
+		if _, ok := paths[f]; !ok {
+			paths[f] = filepath.Join(d.Source, filepath.FromSlash(f))
+		}
+	}
+	names := make([]string, 0, len(paths))
+	for f := range paths {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return artifact, manifest, fmt.Errorf("the manifest of %s lists no sources", d.Source)
+	}
+
+	artifact.SourceHash, err = hashSources(filepath.ToSlash(filepath.Clean(d.Source)), names, func(f string) string { return paths[f] })
+	if err != nil {
+		return artifact, manifest, err
+	}
+	ext := ".zip"
+	if manifest.Artifact != "" {
+		ext = filepath.Ext(manifest.Artifact)
+	}
+	artifact.Path = filepath.Join(cache, artifact.SourceHash+ext)
+	if _, err := os.Stat(artifact.Path); err == nil {
+		artifact.Cached = true
+		artifact.Hash, err = hashFile(artifact.Path)
+	}
+	return artifact, manifest, err
+}
+
+// buildFiles of a function folder decide how the artifact is built and packaged, so they are part of its key
+var buildFiles = []string{"manifest.yml", "Makefile"}
+
+// withBuildFiles adds the build files found in the function folder to the sorted sources
+func withBuildFiles(source string, sources []string) []string {
+	files := append([]string(nil), sources...)
+	for _, f := range buildFiles {
+		if _, err := os.Stat(filepath.Join(source, f)); err != nil {
+			continue
+		}
+		listed := false
+		for _, s := range sources {
+			listed = listed || s == f
+		}
+		if !listed {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// copyWorkload copies the files of the workload runtime into the function folder and returns their paths inside it
+func copyWorkload(runtime, source string) ([]string, error) {
+	manifest, err := readWorkloadManifest(runtime)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(source, manifest.Prefix)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if err := copy(filepath.Join("workloads", runtime, f), filepath.Join(dir, f)); err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.Join(manifest.Prefix, f))
+	}
+	return files, nil
+}
+
+// expand resolves the patterns relative to dir and returns the sorted, unique relative paths of the matched files
+func expand(dir string, patterns []string) ([]string, error) {
+	unique := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s matches no file in %s", pattern, dir)
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			unique[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	files := make([]string, 0, len(unique))
+	for f := range unique {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// hashFiles hashes the names and contents of the files, in the given order
+func hashFiles(dir, salt string, files []string) (string, error) {
+	return hashSources(salt, files, func(f string) string {
+		return filepath.Join(dir, filepath.FromSlash(f))
+	})
+}
+
+// hashSources hashes the names and the contents of the files found at path(name), in the given order
+func hashSources(salt string, names []string, path func(string) string) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, salt)
+	for _, f := range names {
+		fmt.Fprintf(hash, "\x00%s\x00", f)
+		file, err := os.Open(path(f))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeZip zips the files in the given order with fixed timestamps and permissions
+func writeZip(out io.Writer, dir string, files []string) error {
+	archive := zip.NewWriter(out)
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+
+		header := &zip.FileHeader{Name: f, Method: zip.Deflate, Modified: zipTime}
+		//only the executable bit matters to the platforms
+		if info.Mode()&0111 != 0 {
+			header.SetMode(0755)
+		} else {
+			header.SetMode(0644)
+		}
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func copyTo(out io.Writer, src string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(out, file)
+	return err
+}
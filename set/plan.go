@@ -0,0 +1,244 @@
+package set
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faas-facts/bench/bencher"
+)
+
+// DeploymentPlan describes what a platform would do to deploy a source, see Platform.Plan.
+// Planning builds, uploads and creates nothing, the artifact is predicted from the sources.
+type DeploymentPlan struct {
+	Platform string `json:"platform" yaml:"platform"`
+	Source   string `json:"source" yaml:"source"`
+	Runtime  string `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	//memory and timeout of the function, zero keeps the default of the platform
+	MemoryMiB int64         `json:"memoryMiB,omitempty" yaml:"memoryMiB,omitempty"`
+	Timeout   time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Region    string        `json:"region,omitempty" yaml:"region,omitempty"`
+	//names of the variables set in the function environment, the values may be secrets
+	Environment []string `json:"environment,omitempty" yaml:"environment,omitempty"`
+
+	//the artifact the deployment would build, its hash is only known if it is cached already
+	Artifact Artifact `json:"artifact" yaml:"artifact"`
+	//what the deployment would build, create and change, in order
+	Actions []string `json:"actions" yaml:"actions"`
+}
+
+func (p *DeploymentPlan) add(format string, args ...interface{}) {
+	p.Actions = append(p.Actions, fmt.Sprintf(format, args...))
+}
+
+// planPackage plans the packaging of the source, the first part of the plan of every platform
+func planPackage(platform string, d Deployment, cache string) (DeploymentPlan, FunctionManifest, error) {
+	plan := DeploymentPlan{
+		Platform:  platform,
+		Source:    d.Source,
+		Runtime:   d.FunctionRuntime,
+		MemoryMiB: memoryMiB(d.FunctionMemory),
+		Timeout:   d.FunctionTimeout,
+		Region:    d.FunctionRegion,
+	}
+	for name := range functionEnv(d) {
+		plan.Environment = append(plan.Environment, name)
+	}
+	sort.Strings(plan.Environment)
+
+	artifact, manifest, err := planArtifact(d, cacheDir(cache))
+	if err != nil {
+		return plan, manifest, err
+	}
+	plan.Artifact = artifact
+	if plan.Runtime == "" {
+		plan.Runtime = manifest.Runtime
+	}
+
+	if artifact.Cached {
+		plan.add("reuse the cached artifact %s", artifact.Path)
+		return plan, manifest, nil
+	}
+	if manifest.Runtime != "" {
+		plan.add("copy the %s workload into %s", manifest.Runtime, d.Source)
+	}
+	if manifest.Build != "" {
+		plan.add("run make %s in %s", manifest.Build, d.Source)
+	}
+	plan.add("package %s into %s", d.Source, artifact.Path)
+	return plan, manifest, nil
+}
+
+// PhasePlan is a load phase with the number of invocations its hatch rate produces.
+type PhasePlan struct {
+	Name     string        `json:"name" yaml:"name"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	Threads  int           `json:"threads" yaml:"threads"`
+	//requests per second at the start and the end of the phase
+	StartRPS float64 `json:"startRps" yaml:"startRps"`
+	EndRPS   float64 `json:"endRps" yaml:"endRps"`
+	//expected invocations, assuming the invoker keeps up with the hatch rate
+	Invocations int64 `json:"invocations" yaml:"invocations"`
+}
+
+// IOPlan lists the input objects generated before the run.
+type IOPlan struct {
+	Backend  string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Bucket   string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	//listen address of the built-in S3 stand-in, if it replaces the endpoint
+	LocalS3 string `json:"localS3,omitempty" yaml:"localS3,omitempty"`
+
+	Objects    int   `json:"objects" yaml:"objects"`
+	ObjectSize int64 `json:"objectSize" yaml:"objectSize"`
+	TotalSize  int64 `json:"totalSize" yaml:"totalSize"`
+	//the fs backend generates its objects inside the function on first access
+	Generated bool `json:"generated,omitempty" yaml:"generated,omitempty"`
+}
+
+// StepPlan is a workflow step, invoked by the entry function once per request.
+type StepPlan struct {
+	Name string `json:"name" yaml:"name"`
+	//configured target of the step, empty if it is deployed or reuses the entry function
+	Target      string          `json:"target,omitempty" yaml:"target,omitempty"`
+	Deployment  *DeploymentPlan `json:"deployment,omitempty" yaml:"deployment,omitempty"`
+	Invocations int64           `json:"invocations" yaml:"invocations"`
+}
+
+// ExperimentPlan describes a run of the workload, see PerformanceWorkload.Plan.
+type ExperimentPlan struct {
+	Name string `json:"name" yaml:"name"`
+	//configured target, empty if the deployment reports it
+	Target  string `json:"target,omitempty" yaml:"target,omitempty"`
+	Invoker string `json:"invoker,omitempty" yaml:"invoker,omitempty"`
+
+	Deployment DeploymentPlan `json:"deployment" yaml:"deployment"`
+	Steps      []StepPlan     `json:"steps,omitempty" yaml:"steps,omitempty"`
+	//the operational change and when it is applied, counted from the start of the load
+	Operation   *DeploymentPlan `json:"operation,omitempty" yaml:"operation,omitempty"`
+	OperationAt time.Duration   `json:"operationAt,omitempty" yaml:"operationAt,omitempty"`
+
+	IO *IOPlan `json:"io,omitempty" yaml:"io,omitempty"`
+
+	Phases      []PhasePlan `json:"phases" yaml:"phases"`
+	Invocations int64       `json:"invocations" yaml:"invocations"`
+	//expected invocations per request class of a mix
+	Classes map[string]int64 `json:"classes,omitempty" yaml:"classes,omitempty"`
+
+	//estimated cost, if a pricing is configured
+	Cost *Cost `json:"cost,omitempty" yaml:"cost,omitempty"`
+}
+
+// Plan reports what a run of the workload would deploy, upload and invoke, without doing any of it.
+// The platform has to be set, local services like the S3 stand-in are not started.
+func (w *PerformanceWorkload) Plan() (ExperimentPlan, error) {
+	plan := ExperimentPlan{
+		Name:    w.Name,
+		Target:  w.Target,
+		Invoker: w.Invoker.Type,
+	}
+	if w.Platform == nil {
+		return plan, fmt.Errorf("the workload %s has no platform to plan with", w.Name)
+	}
+
+	var err error
+	plan.Deployment, err = w.Platform.Plan(w.Deployment)
+	if err != nil {
+		return plan, fmt.Errorf("failed to plan the deployment of %s: %w", w.Deployment.Source, err)
+	}
+
+	for _, phase := range w.phases() {
+		phasePlan, err := planPhase(phase)
+		if err != nil {
+			return plan, err
+		}
+		plan.Phases = append(plan.Phases, phasePlan)
+		plan.Invocations += phasePlan.Invocations
+	}
+
+	if w.Workflow != nil {
+		for _, step := range w.Workflow.Steps {
+			stepPlan := StepPlan{Name: step.Name, Target: step.Target, Invocations: plan.Invocations}
+			if step.Target == "" && step.Deployment != nil {
+				deployment, err := w.Platform.Plan(step.Deployment.WithSecrets(w.FunctionSecrets()))
+				if err != nil {
+					return plan, fmt.Errorf("failed to plan step %s: %w", step.Name, err)
+				}
+				stepPlan.Deployment = &deployment
+			}
+			plan.Steps = append(plan.Steps, stepPlan)
+		}
+	}
+
+	if w.Operation != nil {
+		operation, err := w.Platform.Plan(w.Operation.WithSecrets(w.FunctionSecrets()))
+		if err != nil {
+			return plan, fmt.Errorf("failed to plan the operational change: %w", err)
+		}
+		plan.Operation = &operation
+		//half way through the scale phase, see Prepare
+		plan.OperationAt = w.PhaseLength + w.PhaseLength/2
+	}
+
+	if len(w.Mix) > 0 {
+		total := 0.0
+		for _, entry := range w.Mix {
+			total += entry.Weight
+		}
+		if total <= 0 {
+			return plan, fmt.Errorf("the mix of %s has no positive weight", w.Name)
+		}
+		plan.Classes = make(map[string]int64, len(w.Mix))
+		for _, entry := range w.Mix {
+			plan.Classes[entry.Class()] += int64(math.Round(float64(plan.Invocations) * entry.Weight / total))
+		}
+	}
+
+	if w.Uses("io") {
+		size, objects := w.ioObjects()
+		plan.IO = &IOPlan{
+			Backend:    w.Backend,
+			Bucket:     w.Bucket,
+			Endpoint:   w.Endpoint,
+			LocalS3:    w.LocalS3,
+			Objects:    objects,
+			ObjectSize: size,
+			TotalSize:  size * int64(objects),
+			Generated:  strings.ToLower(w.Backend) == "fs",
+		}
+	}
+	return plan, nil
+}
+
+// planPhase estimates the invocations of a phase, fixed rates send trps requests per second
+// and slopes start at start and add rate requests per second every second
+func planPhase(phase bencher.PhaseConfig) (PhasePlan, error) {
+	plan := PhasePlan{Name: phase.Name, Duration: phase.Timeout, Threads: phase.Threads}
+	seconds := phase.Timeout.Seconds()
+	switch phase.HatchRate.Type {
+	case "fixed":
+		plan.StartRPS = option(phase.HatchRate.Options, "trps")
+		plan.EndRPS = plan.StartRPS
+	case "slope":
+		plan.StartRPS = option(phase.HatchRate.Options, "start")
+		plan.EndRPS = plan.StartRPS + option(phase.HatchRate.Options, "rate")*seconds
+	default:
+		return plan, fmt.Errorf("can't plan the %s hatch rate of phase %s", phase.HatchRate.Type, phase.Name)
+	}
+	plan.Invocations = int64(math.Round((plan.StartRPS + plan.EndRPS) / 2 * seconds))
+	return plan, nil
+}
+
+func option(options map[string]interface{}, key string) float64 {
+	switch v := options[key].(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
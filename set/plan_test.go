@@ -0,0 +1,68 @@
+package set
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	source := functionSource(t, "runtime: go\nsources:\n  - handler.go\n  - go.mod\n", "handler.go", "go.mod", "Makefile")
+	cache := filepath.Join(t.TempDir(), "artifacts")
+
+	w := PerformanceWorkload{
+		Name:        "planned",
+		Warmup:      10,
+		Scaling:     0.5,
+		PhaseLength: time.Minute,
+		Mix:         []MixEntry{{Type: "prime", Level: 1, Weight: 3}, {Type: "io", Level: 0, Weight: 1}},
+		Deployment:  Deployment{Source: source, FunctionMemory: 256, FunctionTimeout: 30 * time.Second},
+		Platform:    &MakefileDeployment{Cache: cache},
+	}
+	plan, err := w.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//warmup 10rps, scale from 10 to 40rps, settle at 40rps
+	expected := []int64{600, 1500, 2400}
+	for i, phase := range plan.Phases {
+		if phase.Invocations != expected[i] {
+			t.Errorf("expected %d invocations in %s, got %d", expected[i], phase.Name, phase.Invocations)
+		}
+	}
+	if plan.Invocations != 4500 || plan.Classes["prime-1"] != 3375 || plan.Classes["io-0"] != 1125 {
+		t.Errorf("unexpected invocations %d of %v", plan.Invocations, plan.Classes)
+	}
+	if plan.IO == nil || plan.IO.Objects != 10 || plan.IO.TotalSize != int64(50*MiB) {
+		t.Errorf("unexpected io objects %+v", plan.IO)
+	}
+	if plan.Deployment.MemoryMiB != 256 || plan.Deployment.Artifact.Cached || len(plan.Deployment.Actions) == 0 {
+		t.Errorf("unexpected deployment plan %+v", plan.Deployment)
+	}
+
+	//planning touches nothing
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("the plan created the cache %s", cache)
+	}
+	if entries, _ := os.ReadDir(source); len(entries) != 4 {
+		t.Errorf("the plan copied the workload into %s", source)
+	}
+
+	//and predicts the artifact Package builds
+	artifact, err := Package(w.Deployment, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.SourceHash != plan.Deployment.Artifact.SourceHash || artifact.Path != plan.Deployment.Artifact.Path {
+		t.Errorf("planned %+v, packaged %+v", plan.Deployment.Artifact, artifact)
+	}
+	cached, err := w.Platform.Plan(w.Deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Artifact.Cached || cached.Artifact.Hash != artifact.Hash {
+		t.Errorf("the packaged artifact was not found by the plan %+v", cached.Artifact)
+	}
+}
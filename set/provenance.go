@@ -0,0 +1,183 @@
+package set
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Provenance describes how the results of an experiment were produced, it is written next to the result file.
+// Workload and Deployment are stored as their serialized, redacted form.
+type Provenance struct {
+	Results string `json:"results"`
+	//experiment and target of a run with several targets, see PerformanceWorkload.Split
+	Experiment string                 `json:"experiment,omitempty"`
+	TargetName string                 `json:"targetName,omitempty"`
+	Workload   map[string]interface{} `json:"workload"`
+	//the deployment of the function under test, also part of Workload but kept at the top for quick lookups
+	Deployment map[string]interface{} `json:"deployment"`
+	Artifact   *Artifact              `json:"artifact,omitempty"`
+	//the function the deployment reported
+	Target *DeploymentResult `json:"target,omitempty"`
+	//estimated before and computed after the run, if a pricing is configured
+	EstimatedCost *Cost `json:"estimatedCost,omitempty"`
+	Cost          *Cost `json:"cost,omitempty"`
+
+	//build of the driver, set at link time (see Makefile)
+	Build string `json:"build"`
+	//commit of the SET checkout the driver ran in, Dirty if it had local changes
+	Commit string `json:"commit,omitempty"`
+	Dirty  bool   `json:"dirty,omitempty"`
+
+	Host HostInfo `json:"host"`
+
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// HostInfo describes the machine the driver ran on.
+type HostInfo struct {
+	Hostname  string `json:"hostname,omitempty"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPU       string `json:"cpu,omitempty"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"go"`
+}
+
+// sensitive matches keys whose values must not be recorded, Secret fields are redacted by themselves.
+// This also covers free-form settings such as the invoker token or the deployment environment.
+var sensitive = regexp.MustCompile(`(?i)(secret|password|token|auth|credential|^key$|key_?id)`)
+
+// NewProvenance records the workload, its deployment and the driver environment at the start of an experiment.
+func NewProvenance(w PerformanceWorkload, build string) (*Provenance, error) {
+	p := &Provenance{
+		Results:    w.ResultFile(),
+		Experiment: w.experiment,
+		TargetName: w.TargetName,
+		Target:     w.Deployed,
+		Build:      build,
+		Host:       readHostInfo(),
+		Start:      time.Now(),
+	}
+	var err error
+	if p.Workload, err = redactedTree(w); err != nil {
+		return nil, err
+	}
+	if p.Deployment, err = redactedTree(w.Deployment); err != nil {
+		return nil, err
+	}
+	p.Commit, p.Dirty = gitCommit()
+	return p, nil
+}
+
+// Finish marks the end of the experiment.
+func (p *Provenance) Finish() {
+	end := time.Now()
+	p.End = &end
+}
+
+// File is the path of the sidecar, the result file with a .provenance.json extension.
+func (p *Provenance) File() string {
+	return strings.TrimSuffix(p.Results, filepath.Ext(p.Results)) + ".provenance.json"
+}
+
+// Write (over)writes the sidecar, so an interrupted experiment still has one without End.
+func (p *Provenance) Write() error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.File()), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.File(), data, 0644)
+}
+
+// redactedTree serializes v and replaces the values of all sensitive keys
+func redactedTree(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	redact(tree)
+	return tree, nil
+}
+
+func redact(node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				redact(v)
+			default:
+				//references (keyIdRef, secretRef) only name where a secret is kept
+				if v != nil && v != "" && sensitive.MatchString(k) && !strings.HasSuffix(k, "Ref") {
+					n[k] = redacted
+				}
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			redact(v)
+		}
+	}
+}
+
+func readHostInfo() HostInfo {
+	host := HostInfo{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		CPU:       cpuModel(),
+	}
+	host.Hostname, _ = os.Hostname()
+	return host
+}
+
+// cpuModel returns the model name of the first cpu, empty if /proc/cpuinfo is not available
+func cpuModel() string {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "model name" {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+	return ""
+}
+
+// gitCommit returns the checked out commit and if the work tree has local changes, empty outside of a git checkout
+func gitCommit() (string, bool) {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output()
+	return strings.TrimSpace(string(out)), err == nil && len(strings.TrimSpace(string(status))) > 0
+}
+
+// resultFile names the result file of an experiment started at start
+func resultFile(name string, start time.Time) string {
+	return filepath.Join("data", fmt.Sprintf("%s_%s.csv", name, start.Format("2006-01-02T15-04-05")))
+}
@@ -0,0 +1,62 @@
+package set
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProvenance_Redacted(t *testing.T) {
+	w := PerformanceWorkload{
+		Name:            "provenance",
+		AccessKeyID:     "AKIAEXAMPLE",
+		AccessKeySecret: Secret("very-secret"),
+		Deployment: Deployment{
+			Source:      "functions/ow/go",
+			Environment: map[string]string{"API_TOKEN": "token-value", "STAGE": "test"},
+		},
+	}
+	w.Credentials = &Credentials{KeyIDRef: "env:MINIO_KEY", SecretRef: "file:/secret"}
+	w.resultFile = filepath.Join(t.TempDir(), "provenance_run.csv")
+
+	p, err := NewProvenance(w, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Finish()
+	if err := p.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(p.File(), "provenance_run.provenance.json") {
+		t.Errorf("unexpected sidecar %s", p.File())
+	}
+
+	data, err := ioutil.ReadFile(p.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"AKIAEXAMPLE", "very-secret", "token-value"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("sidecar contains %s", secret)
+		}
+	}
+
+	var read Provenance
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	environment := read.Deployment["environment"].(map[string]interface{})
+	credentials := read.Workload["credentials"].(map[string]interface{})
+	if environment["STAGE"] != "test" || read.Workload["name"] != "provenance" || credentials["keyIdRef"] != "env:MINIO_KEY" {
+		t.Error("sidecar lost non-sensitive settings")
+	}
+	if read.End == nil || read.Host.CPUs == 0 || read.Build != "test" {
+		t.Errorf("incomplete sidecar %+v", read)
+	}
+	//the caller's workload must stay usable for the run
+	if w.Deployment.Environment["API_TOKEN"] != "token-value" {
+		t.Error("redaction changed the workload")
+	}
+}
@@ -0,0 +1,248 @@
+package set
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadinessCheck sends a job of the workload to the deployed function until it returns a valid trace.
+// Platforms report a deployment as done before the function serves requests (cold DNS, gateways, image pulls),
+// starting the load before would only record errors.
+type ReadinessCheck struct {
+	//overall time the function gets to become ready
+	Timeout time.Duration
+	//first delay between attempts, doubled up to MaxDelay
+	Delay    time.Duration
+	MaxDelay time.Duration
+	Client   *http.Client
+	//OpenWhisk cli that invokes action targets, wsk if empty
+	Wsk string
+}
+
+// NewReadinessCheck returns a check that gives the function timeout to become ready.
+func NewReadinessCheck(timeout time.Duration) *ReadinessCheck {
+	return &ReadinessCheck{
+		Timeout:  timeout,
+		Delay:    time.Second,
+		MaxDelay: 15 * time.Second,
+		Client:   &http.Client{Timeout: time.Minute},
+		//like the Makefiles of functions/ow
+		Wsk: os.Getenv("WSK"),
+	}
+}
+
+// ReadinessError describes why a target did not become ready.
+type ReadinessError struct {
+	Target   string
+	Attempts int
+	Elapsed  time.Duration
+	//status and (truncated) body of the last response, if there was one
+	Status int
+	Body   string
+	Err    error
+}
+
+func (e *ReadinessError) Error() string {
+	msg := fmt.Sprintf("%s is not ready after %d attempts in %s: %v", e.Target, e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (last response %d: %s)", e.Status, e.Body)
+	}
+	return msg
+}
+
+func (e *ReadinessError) Unwrap() error {
+	return e.Err
+}
+
+// readinessTrace is the part of a trace that is validated, see fact.Trace
+type readinessTrace struct {
+	Tags             map[string]string `json:"Tags"`
+	Logs             map[string]string `json:"Logs"`
+	ExecutionLatency *struct {
+		Seconds int64 `json:"seconds"`
+		Nanos   int64 `json:"nanos"`
+	} `json:"ExecutionLatency"`
+	//set by the wrappers if the job could not be run at all
+	Error string `json:"error"`
+}
+
+// retryable failures are expected while a deployment settles, all others fail the check right away
+type retryable struct {
+	error
+}
+
+func (r retryable) Unwrap() error {
+	return r.error
+}
+
+// Check posts the job to the target and returns the tags of the first valid trace.
+// The target must accept the job as json POST body, like the calibration against a target.
+func (r *ReadinessCheck) Check(target string, job []byte) (map[string]string, error) {
+	return r.await(target, func(result *ReadinessError) (map[string]string, error) {
+		return r.attempt(target, job, result)
+	})
+}
+
+// CheckAction invokes the OpenWhisk action with the job through the wsk cli and returns the tags of the first valid trace.
+// The cli has to be configured for the namespace of the action, like for the deployment.
+func (r *ReadinessCheck) CheckAction(action string, job []byte) (map[string]string, error) {
+	params, err := ioutil.TempFile("", "set-readiness-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(params.Name())
+	_, err = params.Write(job)
+	if cerr := params.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.await(action, func(result *ReadinessError) (map[string]string, error) {
+		return r.invoke(action, params.Name(), result)
+	})
+}
+
+// await repeats the attempt until it succeeds, fails for good or the timeout is used up
+func (r *ReadinessCheck) await(target string, attempt func(*ReadinessError) (map[string]string, error)) (map[string]string, error) {
+	start := time.Now()
+	delay := r.Delay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	result := &ReadinessError{Target: target}
+	for {
+		result.Attempts++
+		tags, err := attempt(result)
+		if err == nil {
+			log.Infof("%s is ready after %d attempts in %s", target, result.Attempts, time.Since(start).Round(time.Millisecond))
+			return tags, nil
+		}
+		result.Err = err
+		result.Elapsed = time.Since(start)
+		if _, ok := err.(retryable); !ok || result.Elapsed+delay > r.Timeout {
+			return nil, result
+		}
+
+		log.Infof("waiting for %s: %v", target, err)
+		time.Sleep(delay)
+		delay *= 2
+		if r.MaxDelay > 0 && delay > r.MaxDelay {
+			delay = r.MaxDelay
+		}
+	}
+}
+
+func (r *ReadinessCheck) attempt(target string, job []byte, result *ReadinessError) (map[string]string, error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(job))
+	if err != nil {
+		return nil, retryable{err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	result.Status = resp.StatusCode
+	result.Body = truncate(strings.TrimSpace(string(body)), 512)
+	if err != nil {
+		return nil, retryable{err}
+	}
+
+	switch {
+	//not routed yet, throttled or still starting
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return nil, retryable{fmt.Errorf("status %s", resp.Status)}
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("the function rejected the job with %s", resp.Status)
+	}
+	return validateTrace(body)
+}
+
+func (r *ReadinessCheck) invoke(action, params string, result *ReadinessError) (map[string]string, error) {
+	wsk := r.Wsk
+	if wsk == "" {
+		wsk = "wsk"
+	}
+	stderr := bytes.Buffer{}
+	cmd := exec.Command(wsk, "action", "invoke", action, "--blocking", "--result", "--param-file", params)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err == nil {
+		return validateTrace(out)
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return nil, fmt.Errorf("failed to run %s: %w", wsk, err)
+	}
+	//the action ran and returned something, failed jobs are not retried
+	if trimmed := bytes.TrimSpace(out); bytes.HasPrefix(trimmed, []byte("{")) {
+		result.Body = truncate(string(trimmed), 512)
+		if _, verr := validateTrace(trimmed); verr != nil {
+			return nil, verr
+		}
+	}
+	//missing, throttled or still starting
+	result.Body = truncate(strings.TrimSpace(stderr.String()), 512)
+	return nil, retryable{fmt.Errorf("%s failed: %v", wsk, err)}
+}
+
+// validateTrace checks that the body is a trace of a successfully executed job and returns its tags
+func validateTrace(body []byte) (map[string]string, error) {
+	var trace readinessTrace
+	if err := json.Unmarshal(body, &trace); err != nil {
+		return nil, fmt.Errorf("the response is not a trace: %w", err)
+	}
+	if trace.Error != "" {
+		return nil, fmt.Errorf("the function failed to run the job: %s", trace.Error)
+	}
+	//the go functions log the error of a failed job
+	for _, msg := range trace.Logs {
+		if msg != "" {
+			return nil, fmt.Errorf("the function failed to run the job: %s", msg)
+		}
+	}
+	if len(trace.Tags) == 0 {
+		return nil, fmt.Errorf("the trace has no tags")
+	}
+	if trace.ExecutionLatency != nil && (trace.ExecutionLatency.Seconds < 0 || trace.ExecutionLatency.Nanos < 0) {
+		return nil, fmt.Errorf("the trace has a negative execution latency")
+	}
+	return trace.Tags, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// AwaitTarget checks that the target of the workload runs its jobs.
+// Http targets get the job posted, OpenWhisk actions are invoked with the wsk cli, other targets fail the check.
+func (w *PerformanceWorkload) AwaitTarget(check *ReadinessCheck) error {
+	target := strings.TrimSpace(w.Target)
+	var err error
+	switch {
+	case httpTarget(target):
+		_, err = check.Check(target, w.Payload()(nil))
+	case strings.EqualFold(w.Invoker.Type, "ow") && target != "":
+		_, err = check.CheckAction(target, w.Payload()(nil))
+	default:
+		err = fmt.Errorf("can't check %q, it is neither an http url nor an OpenWhisk action, set --readiness-timeout 0 to skip the check", target)
+	}
+	return err
+}
+
+func httpTarget(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
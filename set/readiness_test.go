@@ -0,0 +1,116 @@
+package set
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessCheck(t *testing.T) {
+	var calls int32
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusBadGateway, "upstream connect error"},
+		{http.StatusNotFound, ""},
+		{http.StatusOK, `{"Tags":{"runtime":"12"},"ExecutionLatency":{"seconds":0,"nanos":12000000}}`},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&calls, 1)) - 1
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		w.WriteHeader(responses[i].status)
+		w.Write([]byte(responses[i].body))
+	}))
+	defer server.Close()
+
+	check := &ReadinessCheck{Timeout: 5 * time.Second, Delay: time.Millisecond, Client: server.Client()}
+	tags, err := check.Check(server.URL, []byte(`{"version":1,"idle":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags["runtime"] != "12" || calls != 3 {
+		t.Errorf("expected the tags of the third attempt, got %v after %d calls", tags, calls)
+	}
+}
+
+func TestReadinessCheck_Failures(t *testing.T) {
+	for name, tc := range map[string]struct {
+		status   int
+		body     string
+		attempts int
+		reason   string
+	}{
+		"job error": {http.StatusOK, `{"Tags":{},"Logs":{"1614600000":"job schema version 2 is newer than the supported 1"}}`, 1, "newer than the supported"},
+		"wrapper":   {http.StatusOK, `{"error":"job not defined correctly"}`, 1, "job not defined correctly"},
+		"no trace":  {http.StatusOK, `<html>Welcome</html>`, 1, "not a trace"},
+		"no tags":   {http.StatusOK, `{"ID":"abc"}`, 1, "no tags"},
+		"rejected":  {http.StatusForbidden, `{"message":"Missing Authentication Token"}`, 1, "403"},
+		"never up":  {http.StatusServiceUnavailable, `starting`, 0, "503"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			check := &ReadinessCheck{Timeout: 50 * time.Millisecond, Delay: 5 * time.Millisecond, Client: server.Client()}
+			_, err := check.Check(server.URL, []byte(`{"version":1}`))
+			var readiness *ReadinessError
+			if !errors.As(err, &readiness) {
+				t.Fatalf("expected a readiness error, got %v", err)
+			}
+			if tc.attempts > 0 && readiness.Attempts != tc.attempts {
+				t.Errorf("expected %d attempts, got %d", tc.attempts, readiness.Attempts)
+			}
+			if tc.attempts == 0 && readiness.Attempts < 2 {
+				t.Errorf("expected retries until the timeout, got %d attempts", readiness.Attempts)
+			}
+			if !strings.Contains(err.Error(), tc.reason) || !strings.Contains(err.Error(), server.URL) {
+				t.Errorf("the diagnostic %q lacks %q", err, tc.reason)
+			}
+		})
+	}
+}
+
+func TestReadinessCheck_Action(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("the fake wsk needs a shell")
+	}
+	//fails like a missing action on the first call, then answers with the trace of the job it was given
+	dir := t.TempDir()
+	wsk := filepath.Join(dir, "wsk")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" >> " + filepath.Join(dir, "args") + "\n" +
+		"if [ ! -f " + filepath.Join(dir, "called") + " ]; then touch " + filepath.Join(dir, "called") + "; echo 'error: The requested resource does not exist.' >&2; exit 148; fi\n" +
+		"grep -q idle \"$7\" && echo '{\"Tags\":{\"job\":\"idle\"}}'\n"
+	if err := ioutil.WriteFile(wsk, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	check := &ReadinessCheck{Timeout: 5 * time.Second, Delay: time.Millisecond, Wsk: wsk}
+	tags, err := check.CheckAction("bencher", []byte(`{"version":2,"idle":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if tags["job"] != "idle" || strings.Count(string(args), "action invoke bencher --blocking --result") != 2 {
+		t.Errorf("expected the tags of the second invocation, got %v after %s", tags, args)
+	}
+
+	w := PerformanceWorkload{Target: "bencher"}
+	w.Invoker.Type = "tcp"
+	if err := w.AwaitTarget(check); err == nil || !strings.Contains(err.Error(), "readiness-timeout") {
+		t.Errorf("expected an unsupported target to fail the check, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package set
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Helpers of the platforms that deploy through a management api instead of a Makefile.
+
+// functionEnv is the environment of the function, including the secrets for the IO storage
+func functionEnv(d Deployment) map[string]string {
+	env := make(map[string]string, len(d.Environment)+len(d.secrets))
+	for k, v := range d.Environment {
+		env[k] = v
+	}
+	for k, v := range d.secrets {
+		env[k] = v.Value()
+	}
+	return env
+}
+
+// memoryMiB maps the deployment memory to MiB, plain numbers are MiB like for the Makefile platforms
+func memoryMiB(memory Unit) int64 {
+	if memory >= MiB {
+		return int64(memory / MiB)
+	}
+	return int64(memory)
+}
+
+func timeoutSeconds(d Deployment) int64 {
+	return int64(d.FunctionTimeout.Round(time.Second) / time.Second)
+}
+
+type restClient struct {
+	client *http.Client
+	base   string
+	auth   func(r *http.Request)
+}
+
+func newRestClient(client *http.Client, base string) restClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return restClient{client: client, base: strings.TrimSuffix(base, "/")}
+}
+
+// do sends the body as json to the path below base and decodes the response into out, it returns the status code
+func (r restClient) do(method, path string, body, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	status, _, err := r.send(method, r.base+path, header, payload, out)
+	return status, err
+}
+
+// send sends the payload to the url and decodes a json response into out, it returns the status code and headers
+func (r restClient) send(method, url string, header http.Header, payload []byte, out interface{}) (int, http.Header, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if r.auth != nil {
+		r.auth(req)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp.Header, err
+	}
+	if resp.StatusCode >= 300 {
+		path := strings.TrimPrefix(url, r.base)
+		return resp.StatusCode, resp.Header, fmt.Errorf("%s %s failed with %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil && len(data) > 0 {
+		return resp.StatusCode, resp.Header, json.Unmarshal(data, out)
+	}
+	return resp.StatusCode, resp.Header, nil
+}
+
+// poll calls ready until it reports done, an error or the timeout passes
+func poll(timeout time.Duration, ready func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	delay := 500 * time.Millisecond
+	for {
+		done, err := ready()
+		if err != nil || done {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s", timeout)
+		}
+		time.Sleep(delay)
+		if delay < 5*time.Second {
+			delay *= 2
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package set
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DeploymentResult describes a deployed function.
+// The info rule of a Makefile prints it as a single json line, e.g.
+//
+//	{"url":"https://abc.execute-api.eu-central-1.amazonaws.com/dev/bench","function":"tester-dev-bench","region":"eu-central-1"}
+//
+// all other output of the rule is ignored.
+type DeploymentResult struct {
+	//http endpoint of the function, empty if it is only invoked by name
+	URL string `json:"url,omitempty" yaml:"url"`
+	//name of the function on its platform
+	Function string `json:"function,omitempty" yaml:"function"`
+	Region   string `json:"region,omitempty" yaml:"region"`
+	//version of the deployed code, the artifact hash if the platform reports none
+	Version string `json:"version,omitempty" yaml:"version"`
+}
+
+var functionName = regexp.MustCompile(`^[A-Za-z0-9_./:@-]+$`)
+
+// Validate checks that the result names a reachable function.
+func (r DeploymentResult) Validate() error {
+	if r.URL == "" && r.Function == "" {
+		return fmt.Errorf("the deployment reported neither url nor function")
+	}
+	if r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return fmt.Errorf("the deployment reported an invalid url %q: %w", r.URL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("the deployment reported %q, which is no http url", r.URL)
+		}
+	}
+	if r.Function != "" && !functionName.MatchString(r.Function) {
+		return fmt.Errorf("the deployment reported an invalid function name %q", r.Function)
+	}
+	if strings.ContainsAny(r.Region, " \t\r\n") {
+		return fmt.Errorf("the deployment reported an invalid region %q", r.Region)
+	}
+	return nil
+}
+
+// Target returns what the invoker of the given type addresses, the url for http invokers and the function name for OpenWhisk.
+func (r DeploymentResult) Target(invoker string) string {
+	if strings.EqualFold(invoker, "ow") && r.Function != "" {
+		return r.Function
+	}
+	if r.URL != "" {
+		return r.URL
+	}
+	return r.Function
+}
+
+// ParseDeploymentResult reads the last json line of the output of a deployment script.
+// Scripts that print no json line are still accepted if their last line is a bare url.
+func ParseDeploymentResult(output []byte) (DeploymentResult, error) {
+	var result DeploymentResult
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(lines[i], "{") {
+			continue
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &result); err != nil {
+			return result, fmt.Errorf("the deployment result %q is no valid json: %w", lines[i], err)
+		}
+		return result, result.Validate()
+	}
+
+	if len(lines) > 0 {
+		if legacy := (DeploymentResult{URL: lines[len(lines)-1]}); legacy.Validate() == nil {
+			log.Warnf("the deployment printed a bare url, print a json result line instead")
+			return legacy, nil
+		}
+	}
+	return result, fmt.Errorf("the deployment printed no result line: %q", truncate(string(bytes.TrimSpace(output)), 512))
+}
+
+// ApplyDeployment points the workload at the deployed function, a target set in the workload takes precedence.
+func (w *PerformanceWorkload) ApplyDeployment(result DeploymentResult) error {
+	if err := result.Validate(); err != nil {
+		return err
+	}
+	w.Deployed = &result
+	target := result.Target(w.Invoker.Type)
+	if w.Target == "" {
+		w.Target = target
+	} else if w.Target != target {
+		log.Warnf("benchmarking the configured target %s instead of the deployed %s", w.Target, target)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package set
+
+import (
+	"testing"
+)
+
+func TestParseDeploymentResult(t *testing.T) {
+	for name, tc := range map[string]struct {
+		output   string
+		expected DeploymentResult
+		fails    bool
+	}{
+		"json": {
+			output:   "make[1]: Entering directory\nServerless: Service Information\n{\"url\":\"https://abc.execute-api.eu-central-1.amazonaws.com/dev/bench\",\"function\":\"tester-dev-bench\",\"region\":\"eu-central-1\"}\nmake[1]: Leaving directory\n",
+			expected: DeploymentResult{URL: "https://abc.execute-api.eu-central-1.amazonaws.com/dev/bench", Function: "tester-dev-bench", Region: "eu-central-1"},
+		},
+		"function only": {
+			output:   "{\"function\":\"bencher\"}\n",
+			expected: DeploymentResult{Function: "bencher"},
+		},
+		"bare url": {
+			output:   "https://abc.execute-api.eu-central-1.amazonaws.com/dev/bench\n\n",
+			expected: DeploymentResult{URL: "https://abc.execute-api.eu-central-1.amazonaws.com/dev/bench"},
+		},
+		"chatter":      {output: "make: sls: Command not found\nmake: *** [info] Error 127\n", fails: true},
+		"empty":        {output: "\n", fails: true},
+		"broken json":  {output: "{\"url\": \"https://abc\"\n", fails: true},
+		"no http url":  {output: "{\"url\":\"arn:aws:lambda:eu-central-1:123:function:bench\"}\n", fails: true},
+		"empty result": {output: "{\"url\":\"\",\"function\":\"\"}\n", fails: true},
+		"bad name":     {output: "{\"function\":\"bencher is deployed\"}\n", fails: true},
+	} {
+		result, err := ParseDeploymentResult([]byte(tc.output))
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", name, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", name, tc.expected, result)
+		}
+	}
+}
+
+func TestApplyDeployment(t *testing.T) {
+	result := DeploymentResult{URL: "https://ow.example.com/api/v1/web/guest/default/bencher", Function: "bencher"}
+
+	w := PerformanceWorkload{}
+	w.Invoker.Type = "ow"
+	if err := w.ApplyDeployment(result); err != nil {
+		t.Fatal(err)
+	}
+	if w.Target != "bencher" || w.Deployed == nil {
+		t.Errorf("the ow invoker should address the action by name, got %s", w.Target)
+	}
+
+	w = PerformanceWorkload{}
+	w.Invoker.Type = "http"
+	if err := w.ApplyDeployment(result); err != nil {
+		t.Fatal(err)
+	}
+	if w.Target != result.URL {
+		t.Errorf("the http invoker should address the url, got %s", w.Target)
+	}
+
+	//an explicit target is kept
+	w = PerformanceWorkload{Target: "https://proxy.example.com/bench"}
+	if err := w.ApplyDeployment(result); err != nil {
+		t.Fatal(err)
+	}
+	if w.Target != "https://proxy.example.com/bench" {
+		t.Errorf("the configured target was replaced by %s", w.Target)
+	}
+
+	if err := w.ApplyDeployment(DeploymentResult{}); err == nil {
+		t.Error("an empty result was accepted")
+	}
+}
@@ -0,0 +1,335 @@
+package set
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LocalS3 is a small in-memory stand-in for an S3-compatible object store.
+// It only understands path-style requests (bucket create/list/delete and object put/get/head/delete with Range)
+// and does not check request signatures, which is all the IO workload needs to run without a real endpoint.
+type LocalS3 struct {
+	lock    sync.RWMutex
+	buckets map[string]map[string]*localObject
+
+	listener net.Listener
+	server   *http.Server
+}
+
+type localObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+}
+
+func NewLocalS3() *LocalS3 {
+	return &LocalS3{
+		buckets: make(map[string]map[string]*localObject),
+	}
+}
+
+// Start listens on addr (e.g. 127.0.0.1:9000 or :0) and returns the endpoint url of the store.
+func (s *LocalS3) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("local s3 stopped %+v", err)
+		}
+	}()
+
+	return s.Endpoint(), nil
+}
+
+// Endpoint returns the url of a started store, unspecified listen addresses are mapped to localhost.
+func (s *LocalS3) Endpoint() string {
+	return listenerEndpoint(s.listener)
+}
+
+// listenerEndpoint returns the http url of a listener, unspecified addresses are mapped to localhost.
+func listenerEndpoint(listener net.Listener) string {
+	if listener == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, port))
+}
+
+func (s *LocalS3) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *LocalS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		s.writeError(w, http.StatusNotImplemented, "NotImplemented", "listing buckets is not supported")
+		return
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	bucket := parts[0]
+	if len(parts) == 1 || parts[1] == "" {
+		s.serveBucket(w, r, bucket)
+	} else {
+		s.serveObject(w, r, bucket, parts[1])
+	}
+}
+
+func (s *LocalS3) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	switch r.Method {
+	case http.MethodPut:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if _, ok := s.buckets[bucket]; ok {
+			s.writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou", bucket)
+			return
+		}
+		s.buckets[bucket] = make(map[string]*localObject)
+		w.Header().Set("Location", "/"+bucket)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		if _, ok := s.buckets[bucket]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		s.list(w, r, bucket)
+	case http.MethodDelete:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		objects, ok := s.buckets[bucket]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+			return
+		}
+		if len(objects) > 0 {
+			s.writeError(w, http.StatusConflict, "BucketNotEmpty", bucket)
+			return
+		}
+		delete(s.buckets, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name        `xml:"ListBucketResult"`
+	Name        string          `xml:"Name"`
+	Prefix      string          `xml:"Prefix"`
+	KeyCount    int             `xml:"KeyCount"`
+	MaxKeys     int             `xml:"MaxKeys"`
+	IsTruncated bool            `xml:"IsTruncated"`
+	Contents    []listBucketKey `xml:"Contents"`
+}
+
+type listBucketKey struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+func (s *LocalS3) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	result := listBucketResult{
+		Name:    bucket,
+		Prefix:  prefix,
+		MaxKeys: 1000,
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		object := objects[key]
+		result.Contents = append(result.Contents, listBucketKey{
+			Key:          key,
+			LastModified: object.modified.UTC().Format(time.RFC3339),
+			ETag:         object.etag,
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func (s *LocalS3) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		sum := md5.Sum(data)
+		object := &localObject{
+			data:     data,
+			etag:     fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:])),
+			modified: time.Now(),
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		objects, ok := s.buckets[bucket]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+			return
+		}
+		objects[key] = object
+		w.Header().Set("ETag", object.etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		objects, ok := s.buckets[bucket]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+			return
+		}
+		object, ok := objects[key]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+
+		size := int64(len(object.data))
+		start, end := int64(0), size-1
+		status := http.StatusOK
+		if header := r.Header.Get("Range"); header != "" && r.Method == http.MethodGet {
+			start, end, ok = parseRange(header, size)
+			if !ok {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				s.writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", header)
+				return
+			}
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet && size > 0 {
+			_, _ = w.Write(object.data[start : end+1])
+		}
+	case http.MethodDelete:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if objects, ok := s.buckets[bucket]; ok {
+			delete(objects, key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// parseRange understands a single range in the forms bytes=a-b, bytes=a- and bytes=-n, the end is clamped to the object size.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(strings.TrimSpace(header), "bytes=")
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 || size == 0 {
+		return 0, 0, false
+	}
+
+	if bounds[0] == "" {
+		suffix, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if bounds[1] != "" {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func (s *LocalS3) writeError(w http.ResponseWriter, status int, code, resource string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(s3Error{
+		Code:     code,
+		Message:  code,
+		Resource: resource,
+	})
+}
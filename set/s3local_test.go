@@ -0,0 +1,118 @@
+package set
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	workload "github.com/ISE-SMILE/SET/workloads/go"
+)
+
+func startLocalS3(t *testing.T) (*PerformanceWorkload, *s3.S3) {
+	w := &PerformanceWorkload{
+		Name:            "local",
+		Type:            "io",
+		Bucket:          "set-test",
+		LocalS3:         "127.0.0.1:0",
+		AccessKeyID:     "id",
+		AccessKeySecret: "secret",
+	}
+	store, err := w.StartLocalS3()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = store.Stop()
+	})
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("auto"),
+		Endpoint:         aws.String(w.Endpoint),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		DisableSSL:       aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+	return w, s3.New(sess)
+}
+
+func TestLocalS3_GenerateIObjects(t *testing.T) {
+	w, client := startLocalS3(t)
+	w.Keys = []string{"in_local_0.bin", "in_local_1.bin"}
+	w.GenerateIObjects()
+
+	list, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: &w.Bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Contents) != len(w.Keys) {
+		t.Fatalf("expected %d objects, got %d", len(w.Keys), len(list.Contents))
+	}
+
+	size := ioLevel[w.Level].ObjectSize
+	for _, object := range list.Contents {
+		if *object.Size != size {
+			t.Errorf("%s has size %d, expected %d", *object.Key, *object.Size, size)
+		}
+	}
+
+	rangeString := "bytes=10-19"
+	object, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: &w.Bucket,
+		Key:    &w.Keys[0],
+		Range:  &rangeString,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 10 {
+		t.Errorf("expected 10 bytes from range read, got %d", len(data))
+	}
+}
+
+func TestLocalS3_IO(t *testing.T) {
+	w, client := startLocalS3(t)
+	w.Keys = []string{"in_local_0.bin"}
+	w.GenerateIObjects()
+
+	task := &workload.IOTask{
+		Iteration:       20,
+		ReadWrite:       0.5,
+		ChunkSize:       512,
+		Bucket:          w.Bucket,
+		Keys:            w.Keys,
+		Endpoint:        w.Endpoint,
+		AccessKeyID:     w.AccessKeyID,
+		AccessKeySecret: w.AccessKeySecret.Value(),
+		Args: map[string]string{
+			"DisableSSL":  "true",
+			"S3PathStyle": "true",
+		},
+	}
+	reads, writes, errors, err := workload.IO(task, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors != 0 {
+		t.Errorf("io reported %d errors", errors)
+	}
+	if reads+writes != int64(task.Iteration)*task.ChunkSize {
+		t.Errorf("expected %d bytes transferred, got %d read and %d written", int64(task.Iteration)*task.ChunkSize, reads, writes)
+	}
+
+	list, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: &w.Bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(list.Contents)-1)*task.ChunkSize != writes {
+		t.Errorf("expected %d generated objects, found %d", writes/task.ChunkSize, len(list.Contents)-1)
+	}
+}
@@ -0,0 +1,62 @@
+package set
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/faas-facts/bench/bencher"
+	log "github.com/sirupsen/logrus"
+)
+
+// seedFunc returns the seed for the next invocation and a random source initialized with it.
+// The seed is nil for workloads without a configured seed.
+type seedFunc func() (*int64, *rand.Rand)
+
+// seeder derives a distinct, reproducible seed for every invocation from the workload seed.
+// The n-th payload always gets the same seed, the order in which threads send them may still differ.
+func (w PerformanceWorkload) seeder() seedFunc {
+	if w.Seed == nil {
+		return func() (*int64, *rand.Rand) {
+			return nil, rand.New(rand.NewSource(rand.Int63()))
+		}
+	}
+
+	base := uint64(*w.Seed)
+	counter := uint64(0)
+	return func() (*int64, *rand.Rand) {
+		i := atomic.AddUint64(&counter, 1)
+		seed := int64(splitmix64(base + i*0x9E3779B97F4A7C15))
+		return &seed, rand.New(rand.NewSource(seed))
+	}
+}
+
+// splitmix64 scrambles consecutive inputs into well distributed seeds
+func splitmix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+// staticPayload sends the same job with every invocation, only adding the per-invocation seed if configured.
+func staticPayload(job Job, seeds seedFunc) bencher.PayloadFunc {
+	job.Version = SchemaVersion
+	data, err := json.Marshal(job)
+	if err != nil {
+		panic(err)
+	}
+	return func(invoker bencher.Invoker) []byte {
+		seed, _ := seeds()
+		if seed == nil {
+			return data
+		}
+
+		seeded := job
+		seeded.Seed = seed
+		data, err := json.Marshal(seeded)
+		if err != nil {
+			log.Errorf("failed to generate payload %+v", err)
+		}
+		return data
+	}
+}
@@ -0,0 +1,75 @@
+package set
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NetSink is the local target of the net job, /echo returns the request body, every other path discards it.
+type NetSink struct {
+	received int64
+
+	listener net.Listener
+	server   *http.Server
+}
+
+func NewNetSink() *NetSink {
+	return &NetSink{}
+}
+
+// Start listens on addr (e.g. 0.0.0.0:9001 or :0) and returns the endpoint url of the sink.
+func (s *NetSink) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("net sink stopped %+v", err)
+		}
+	}()
+
+	return s.Endpoint(), nil
+}
+
+func (s *NetSink) Endpoint() string {
+	return listenerEndpoint(s.listener)
+}
+
+// Received returns the number of request body bytes the sink got so far.
+func (s *NetSink) Received() int64 {
+	return atomic.LoadInt64(&s.received)
+}
+
+func (s *NetSink) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *NetSink) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var n int64
+	var err error
+	if r.URL.Path == "/echo" {
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		n, err = io.Copy(rw, r.Body)
+	} else {
+		n, err = io.Copy(ioutil.Discard, r.Body)
+		rw.WriteHeader(http.StatusNoContent)
+	}
+	atomic.AddInt64(&s.received, n)
+	if err != nil {
+		log.Debugf("net sink failed to read request %+v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package set
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	workload "github.com/ISE-SMILE/SET/workloads/go"
+)
+
+func TestNetSink_NetJob(t *testing.T) {
+	for _, keepAlive := range []bool{true, false} {
+		keepAlive := keepAlive
+		w := PerformanceWorkload{
+			Type:      "net",
+			Level:     2,
+			NetSink:   "127.0.0.1:0",
+			NetParams: &NetParameters{KeepAlive: &keepAlive},
+		}
+		sink, err := w.StartNetSink()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var job workload.Job
+		if err := json.Unmarshal(w.Payload()(nil), &job); err != nil {
+			t.Fatal(err)
+		}
+		tags, err := workload.Execute(job)
+		_ = sink.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task := netLevel[w.Level]
+		if tags["errors"] != "0" || tags["requests"] != strconv.Itoa(task.Requests) {
+			t.Errorf("keepAlive %v: unexpected result %v", keepAlive, tags)
+		}
+		if expected := int64(task.Requests) * task.PayloadSize; sink.Received() != expected {
+			t.Errorf("keepAlive %v: sink received %d bytes, expected %d", keepAlive, sink.Received(), expected)
+		}
+	}
+}
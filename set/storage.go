@@ -0,0 +1,181 @@
+package set
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// objectUploader seeds the input objects of the IO workload into the selected storage backend.
+type objectUploader interface {
+	Put(key string, body io.ReadSeeker, size int64) error
+	Close() error
+}
+
+func newObjectUploader(w *PerformanceWorkload) (objectUploader, error) {
+	switch strings.ToLower(w.Backend) {
+	case "", "s3":
+		return newS3Uploader(w), nil
+	case "http":
+		return &httpUploader{
+			client: &http.Client{Timeout: 5 * time.Minute},
+			base:   strings.TrimSuffix(w.Endpoint, "/") + "/" + w.Bucket,
+			token:  w.AccessKeySecret.Value(),
+		}, nil
+	case "redis":
+		return newRedisUploader(w)
+	}
+	return nil, fmt.Errorf("can't upload objects to %s backend", w.Backend)
+}
+
+type s3Uploader struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3Uploader(w *PerformanceWorkload) *s3Uploader {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("auto"),
+		Endpoint:         aws.String(w.Endpoint),
+		Credentials:      credentials.NewStaticCredentials(w.AccessKeyID, w.AccessKeySecret.Value(), ""),
+		DisableSSL:       aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+
+	s3Client := s3.New(sess)
+
+	//create a test bucket
+	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{
+		Bucket: &w.Bucket,
+	})
+	if err != nil {
+		//the bucket might already exist
+		log.Debugf("create bucket %s %+v", w.Bucket, err)
+	}
+
+	return &s3Uploader{
+		client: s3Client,
+		bucket: w.Bucket,
+	}
+}
+
+func (u *s3Uploader) Put(key string, body io.ReadSeeker, size int64) error {
+	contentType := "application/octet-stream"
+	_, err := u.client.PutObject(&s3.PutObjectInput{
+		Body:          body,
+		Bucket:        &u.bucket,
+		ContentLength: &size,
+		ContentType:   &contentType,
+		Key:           &key,
+	})
+	return err
+}
+
+func (u *s3Uploader) Close() error {
+	return nil
+}
+
+type httpUploader struct {
+	client *http.Client
+	base   string
+	token  string
+}
+
+func (u *httpUploader) Put(key string, body io.ReadSeeker, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, u.base+"/"+key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("upload of %s failed with %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (u *httpUploader) Close() error {
+	return nil
+}
+
+type redisUploader struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	prefix string
+}
+
+func newRedisUploader(w *PerformanceWorkload) (*redisUploader, error) {
+	conn, err := net.DialTimeout("tcp", strings.TrimPrefix(w.Endpoint, "redis://"), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	u := &redisUploader{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		prefix: w.Bucket + "/",
+	}
+	if w.AccessKeySecret != "" {
+		args := []string{"AUTH", w.AccessKeySecret.Value()}
+		if w.AccessKeyID != "" {
+			args = []string{"AUTH", w.AccessKeyID, w.AccessKeySecret.Value()}
+		}
+		if err := u.command(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func (u *redisUploader) command(args ...string) error {
+	writer := bufio.NewWriter(u.conn)
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	line, err := u.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") {
+		return fmt.Errorf("redis: %s", strings.TrimSpace(line[1:]))
+	}
+	return nil
+}
+
+func (u *redisUploader) Put(key string, body io.ReadSeeker, size int64) error {
+	data, err := ioutil.ReadAll(io.LimitReader(body, size))
+	if err != nil {
+		return err
+	}
+	return u.command("SET", u.prefix+key, string(data))
+}
+
+func (u *redisUploader) Close() error {
+	return u.conn.Close()
+}
@@ -0,0 +1,144 @@
+package set
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/faas-facts/bench/bencher"
+)
+
+// TargetConfig is one of several deployments an experiment benchmarks with the same load profile,
+// e.g. the same function on AWS in two regions and on an OpenWhisk cluster.
+type TargetConfig struct {
+	//names the target in result files and the provenance, letters, digits, - and _
+	Name       string     `json:"name" yaml:"name"`
+	Deployment Deployment `json:"deployment" yaml:"deployment"`
+	//endpoint or function name, defaults to what the deployment reports
+	Target string `json:"target,omitempty" yaml:"target"`
+	//invoker of the target, defaults to the invoker of the workload (e.g. ow for OpenWhisk next to http for AWS)
+	Invoker *bencher.InvokerConfig `json:"invoker,omitempty" yaml:"invoker"`
+	//operational change of the target, the opTask of the workload only fits a single deployment
+	Operation *Deployment `json:"opTask,omitempty" yaml:"opTask"`
+}
+
+// target modes of an experiment with several targets
+const (
+	//all targets are loaded at the same time, so they are compared in the same time window
+	TargetsParallel = "parallel"
+	//one target after the other
+	TargetsSequential = "sequential"
+)
+
+var targetName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Sequential reports if the targets of the workload are benchmarked one after another.
+func (w PerformanceWorkload) Sequential() bool {
+	return strings.ToLower(w.TargetMode) == TargetsSequential
+}
+
+// Split returns one workload per target, each with the load profile of w. Workloads without targets are returned as they are.
+// The workloads are named <name>_<target>, so every target gets its own result file and provenance.
+func (w PerformanceWorkload) Split() ([]PerformanceWorkload, error) {
+	if len(w.Targets) == 0 {
+		return []PerformanceWorkload{w}, nil
+	}
+	switch strings.ToLower(w.TargetMode) {
+	case "", TargetsParallel, TargetsSequential:
+	default:
+		return nil, fmt.Errorf("unknown target mode %s, use %s or %s", w.TargetMode, TargetsParallel, TargetsSequential)
+	}
+	if w.Operation != nil {
+		return nil, fmt.Errorf("the workload %s has several targets, set the opTask per target", w.Name)
+	}
+	if w.Target != "" {
+		return nil, fmt.Errorf("the workload %s has several targets, set the target per target", w.Name)
+	}
+
+	workloads := make([]PerformanceWorkload, 0, len(w.Targets))
+	names := make(map[string]bool, len(w.Targets))
+	for _, t := range w.Targets {
+		if !targetName.MatchString(t.Name) {
+			return nil, fmt.Errorf("invalid target name %q, use letters, digits, - and _", t.Name)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("the target %s is listed twice", t.Name)
+		}
+		names[t.Name] = true
+
+		single := w
+		single.Name = w.Name + "_" + t.Name
+		single.TargetName = t.Name
+		single.experiment = w.Name
+		single.Targets = nil
+		single.Target = t.Target
+		single.Deployment = t.Deployment
+		single.Operation = t.Operation
+		if t.Invoker != nil {
+			single.Invoker = *t.Invoker
+		}
+		//the step targets are resolved per target
+		if w.Workflow != nil {
+			workflow := *w.Workflow
+			workflow.Steps = append([]WorkflowStep(nil), w.Workflow.Steps...)
+			single.Workflow = &workflow
+		}
+		workloads = append(workloads, single)
+	}
+	return workloads, nil
+}
+
+// TagResults adds the target name as T_target column to every row of the result file, like the tags of a trace.
+func TagResults(results, target string) error {
+	in, err := os.Open(results)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	//written next to the results first, an interrupted rewrite must not lose them
+	tmp, err := ioutil.TempFile(filepath.Dir(results), filepath.Base(results)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(tmp)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to read %s: %w", results, err)
+		}
+		//header rows, see fact.CSVWriter
+		if len(record) > 0 && record[0] == "ID" {
+			record = append(record, "T_target")
+		} else {
+			record = append(record, target)
+		}
+		if err := writer.Write(record); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Rename(tmp.Name(), results)
+}
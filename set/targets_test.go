@@ -0,0 +1,76 @@
+package set
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/faas-facts/bench/bencher"
+)
+
+func TestSplit(t *testing.T) {
+	w := PerformanceWorkload{
+		Name:     "cross",
+		Warmup:   10,
+		Invoker:  bencher.InvokerConfig{Type: "http"},
+		Workflow: &Workflow{Steps: []WorkflowStep{{Name: "resize", Type: "prime"}}},
+		Targets: []TargetConfig{
+			{Name: "aws-eu", Deployment: Deployment{Source: "functions/aws/go", FunctionRegion: "eu-central-1"}},
+			{Name: "aws-us", Deployment: Deployment{Source: "functions/aws/go", FunctionRegion: "us-east-1"}},
+			{Name: "ow", Deployment: Deployment{Source: "functions/ow/go"}, Invoker: &bencher.InvokerConfig{Type: "ow"}},
+		},
+	}
+	workloads, err := w.Split()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 3 {
+		t.Fatalf("expected 3 workloads, got %d", len(workloads))
+	}
+	for i, single := range workloads {
+		target := w.Targets[i]
+		if single.Name != "cross_"+target.Name || single.TargetName != target.Name || single.Warmup != 10 || single.Targets != nil {
+			t.Errorf("unexpected workload of %s: %s", target.Name, single.Name)
+		}
+		if single.Deployment.FunctionRegion != target.Deployment.FunctionRegion {
+			t.Errorf("%s has the deployment of another target", target.Name)
+		}
+	}
+	if workloads[0].Invoker.Type != "http" || workloads[2].Invoker.Type != "ow" {
+		t.Error("the invoker of the targets was not applied")
+	}
+	//deploying the steps of one target must not change the others
+	workloads[0].Workflow.Steps[0].Target = "https://eu.example.com/resize"
+	if workloads[1].Workflow.Steps[0].Target != "" || w.Workflow.Steps[0].Target != "" {
+		t.Error("the targets share their workflow steps")
+	}
+
+	for name, targets := range map[string][]TargetConfig{
+		"duplicate": {{Name: "aws"}, {Name: "aws"}},
+		"bad name":  {{Name: "aws eu"}},
+	} {
+		w.Targets = targets
+		if _, err := w.Split(); err == nil {
+			t.Errorf("%s: the targets were accepted", name)
+		}
+	}
+}
+
+func TestTagResults(t *testing.T) {
+	results := filepath.Join(t.TempDir(), "results.csv")
+	csv := "ID,ELat\na,100\nID,ELat,T_class\nb,200,prime-1\n"
+	if err := ioutil.WriteFile(results, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagResults(results, "aws-eu"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ID,ELat,T_target\na,100,aws-eu\nID,ELat,T_class,T_target\nb,200,prime-1,aws-eu\n"
+	if string(data) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, data)
+	}
+}
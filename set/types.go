@@ -9,12 +9,9 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/faas-facts/bench/bencher"
 )
 
@@ -32,6 +29,31 @@ const (
 	TiB      = GiB * 1024
 )
 
+var unitSuffixes = []struct {
+	suffix string
+	unit   Unit
+}{
+	{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"kiB", kiB}, {"KiB", kiB}, {"B", B},
+}
+
+// ParseUnit reads sizes like 512B, 64kiB or 1.5GiB, plain numbers are bytes.
+func ParseUnit(value string) (Unit, error) {
+	value = strings.TrimSpace(value)
+	unit := B
+	for _, s := range unitSuffixes {
+		if strings.HasSuffix(value, s.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, s.suffix))
+			unit = s.unit
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", value)
+	}
+	return Unit(size * float64(unit)), nil
+}
+
 var memoryLevel = map[byte]MemoryTask{
 	0: {
 		OperatorSize:   100,
@@ -75,53 +97,65 @@ var ioLevel = map[byte]IOTask{
 		Iteration:    1000,
 		ReadWrite:    0,
 		ChunkSize:    int64(512 * B),
-		objectNumber: 10,
-		objectSize:   int64(5 * MiB),
+		ObjectNumber: 10,
+		ObjectSize:   int64(5 * MiB),
 	},
 	//write only 512B 1000 times
 	1: {
 		Iteration:    1000,
 		ReadWrite:    1,
 		ChunkSize:    int64(512 * B),
-		objectNumber: 0,
-		objectSize:   int64(5 * MiB),
+		ObjectNumber: 0,
+		ObjectSize:   int64(5 * MiB),
 	},
 	2: {
 		Iteration:    10000,
 		ReadWrite:    0.5,
 		ChunkSize:    int64(1 * MiB),
-		objectNumber: 20,
-		objectSize:   int64(100 * MiB),
+		ObjectNumber: 20,
+		ObjectSize:   int64(100 * MiB),
 	},
 	3: {
 		Iteration:    10000,
 		ReadWrite:    0.5,
 		ChunkSize:    int64(2 * MiB),
-		objectNumber: 20,
-		objectSize:   int64(100 * MiB),
+		ObjectNumber: 20,
+		ObjectSize:   int64(100 * MiB),
 	},
 	4: {
 		Iteration:    100000,
 		ReadWrite:    0.7,
 		ChunkSize:    int64(20 * MiB),
-		objectNumber: 10,
-		objectSize:   int64(100 * MiB),
+		ObjectNumber: 10,
+		ObjectSize:   int64(100 * MiB),
 	},
 	5: {
 		Iteration:    10000,
 		ReadWrite:    0.7,
 		ChunkSize:    int64(50 * MiB),
-		objectNumber: 10,
-		objectSize:   int64(100 * MiB),
+		ObjectNumber: 10,
+		ObjectSize:   int64(100 * MiB),
 	},
+	//chunks have to be smaller than the objects, 1GiB of input like level 4 and 5
 	6: {
 		Iteration:    100,
 		ReadWrite:    0.7,
 		ChunkSize:    int64(100 * MiB),
-		objectNumber: 10,
-		objectSize:   int64(100 * MiB),
+		ObjectNumber: 5,
+		ObjectSize:   int64(200 * MiB),
 	},
 }
+var diskLevel = map[byte]DiskTask{
+	//a single small file, mostly measures fsync and metadata latency
+	0: {Files: 1, FileSize: int64(4 * kiB), BlockSize: int64(4 * kiB)},
+	1: {Files: 100, FileSize: int64(4 * kiB), BlockSize: int64(4 * kiB)},
+	2: {Files: 10, FileSize: int64(1 * MiB), BlockSize: int64(64 * kiB)},
+	3: {Files: 100, FileSize: int64(1 * MiB), BlockSize: int64(64 * kiB)},
+	4: {Files: 10, FileSize: int64(50 * MiB), BlockSize: int64(1 * MiB)},
+	5: {Files: 4, FileSize: int64(100 * MiB), BlockSize: int64(1 * MiB)},
+	//the 400MiB of level 5 in larger blocks, more would not fit the default 512MB /tmp of AWS
+	6: {Files: 4, FileSize: int64(100 * MiB), BlockSize: int64(4 * MiB)},
+}
 var primeLevel = map[byte]int32{
 	0: 1e3,
 	1: 1e4,
@@ -131,7 +165,67 @@ var primeLevel = map[byte]int32{
 	5: 1e8,
 	6: 1e9,
 }
-var idleLevel = map[byte]int{
+var allocLevel = map[byte]AllocTask{
+	0: {Size: 16, Passes: 1},
+	1: {Size: 64, Passes: 1},
+	2: {Size: 128, Passes: 1},
+	3: {Size: 256, Passes: 2},
+	4: {Size: 512, Passes: 2},
+	5: {Size: 1024, Passes: 4},
+	6: {Size: 2048, Passes: 4},
+}
+
+var netLevel = map[byte]NetTask{
+	0: {Requests: 10, PayloadSize: int64(1 * kiB), Concurrency: 1, KeepAlive: true},
+	1: {Requests: 100, PayloadSize: int64(1 * kiB), Concurrency: 1, KeepAlive: true},
+	2: {Requests: 100, PayloadSize: int64(64 * kiB), Concurrency: 4, KeepAlive: true},
+	3: {Requests: 1000, PayloadSize: int64(64 * kiB), Concurrency: 8, KeepAlive: true},
+	4: {Requests: 1000, PayloadSize: int64(1 * MiB), Concurrency: 8, KeepAlive: true},
+	5: {Requests: 10000, PayloadSize: int64(64 * kiB), Concurrency: 32, KeepAlive: true},
+	6: {Requests: 1000, PayloadSize: int64(10 * MiB), Concurrency: 16, KeepAlive: true},
+}
+
+// cpuLevel holds the presets of the cpu kernels, see CPUTask for the meaning of Size
+var cpuLevel = map[string]map[byte]CPUTask{
+	"matrix": {
+		0: {Size: 16, Iteration: 1},
+		1: {Size: 64, Iteration: 1},
+		2: {Size: 128, Iteration: 2},
+		3: {Size: 256, Iteration: 2},
+		4: {Size: 512, Iteration: 2},
+		5: {Size: 768, Iteration: 4},
+		6: {Size: 1024, Iteration: 8},
+	},
+	"sha256": {
+		0: {Size: int(4 * kiB), Iteration: 1},
+		1: {Size: int(1 * MiB), Iteration: 1},
+		2: {Size: int(1 * MiB), Iteration: 16},
+		3: {Size: int(1 * MiB), Iteration: 64},
+		4: {Size: int(1 * MiB), Iteration: 256},
+		5: {Size: int(1 * MiB), Iteration: 1024},
+		6: {Size: int(1 * MiB), Iteration: 4096},
+	},
+	"gzip": {
+		0: {Size: int(4 * kiB), Iteration: 1},
+		1: {Size: int(64 * kiB), Iteration: 1},
+		2: {Size: int(1 * MiB), Iteration: 1},
+		3: {Size: int(1 * MiB), Iteration: 8},
+		4: {Size: int(4 * MiB), Iteration: 16},
+		5: {Size: int(4 * MiB), Iteration: 64},
+		6: {Size: int(16 * MiB), Iteration: 64},
+	},
+	"json": {
+		0: {Size: 10, Iteration: 1},
+		1: {Size: 100, Iteration: 10},
+		2: {Size: 1000, Iteration: 10},
+		3: {Size: 1000, Iteration: 100},
+		4: {Size: 10000, Iteration: 100},
+		5: {Size: 10000, Iteration: 1000},
+		6: {Size: 100000, Iteration: 1000},
+	},
+}
+
+var idleLevel = map[byte]float64{
 	0: 0,
 	1: 2,
 	2: 8,
@@ -155,6 +249,24 @@ type PerformanceWorkload struct {
 	PhaseLength time.Duration `json:"phaseLength" yaml:"phaseLength"`
 	Type        string        `json:"type" yaml:"type"`
 	Level       byte          `json:"complexity" yaml:"complexity"`
+	//weighted request classes, replaces type and complexity if set
+	Mix []MixEntry `json:"mix,omitempty" yaml:"mix"`
+	//downstream functions the target invokes as a chain or fan-out
+	Workflow *Workflow `json:"workflow,omitempty" yaml:"workflow"`
+	//makes the generated payloads and the randomness inside the functions reproducible
+	Seed *int64 `json:"seed,omitempty" yaml:"seed"`
+	//tags the traces with the resources every invocation used, sampling them adds to the execution latency
+	Usage bool `json:"usage,omitempty" yaml:"usage"`
+
+	//explicit task parameters, the complexity level only provides the defaults
+	MemoryParams *MemoryTask      `json:"memory,omitempty" yaml:"memory"`
+	IdleParams   *time.Duration   `json:"idle,omitempty" yaml:"idle"`
+	PrimeParams  *PrimeTask       `json:"prime,omitempty" yaml:"prime"`
+	IOParams     *IOParameters    `json:"io,omitempty" yaml:"io"`
+	CPUParams    *CPUTask         `json:"cpu,omitempty" yaml:"cpu"`
+	NetParams    *NetParameters   `json:"net,omitempty" yaml:"net"`
+	AllocParams  *AllocParameters `json:"alloc,omitempty" yaml:"alloc"`
+	DiskParams   *DiskTask        `json:"disk,omitempty" yaml:"disk"`
 
 	//We trigger this change during the scaleing phase
 	Operation *Deployment `json:"opTask" yaml:"opTask"`
@@ -162,67 +274,65 @@ type PerformanceWorkload struct {
 	//IO Extras
 	Bucket string   `json:"bucket,omitempty" yaml:"bucket"`
 	Keys   []string `json:"keys,omitempty" yaml:"keys"`
+	//storage backend used by the io job, one of s3 (default), http, redis or fs
+	Backend string `json:"backend,omitempty" yaml:"backend"`
+	//disables reusing storage clients and object metadata across warm invocations
+	NoIOCache bool `json:"noIOCache,omitempty" yaml:"noIOCache"`
 
-	Endpoint        string `json:"endpoint,omitempty" yaml:"endpoint"`
-	AccessKeyID     string `json:"key_id,omitempty" yaml:"keyId"`
-	AccessKeySecret string `json:"key,omitempty" yaml:"secret"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint"`
+	//credentials are handed to the functions at deployment time and never sent with the payload
+	Credentials     *Credentials `json:"credentials,omitempty" yaml:"credentials"`
+	AccessKeyID     string       `json:"key_id,omitempty" yaml:"keyId"`
+	AccessKeySecret Secret       `json:"key,omitempty" yaml:"secret"`
 
 	DisableSSL  bool   `json:"disableSSL,omitempty" yaml:"S3disableSSL"`
 	S3PathStyle bool   `json:"S3PathStyle,omitempty" yaml:"S3PathStyle"`
 	S3Region    string `json:"region,omitempty" yaml:"S3Region"`
 
+	//listen address of the built-in S3 stand-in, if set we start it instead of using an external endpoint
+	LocalS3 string `json:"localS3,omitempty" yaml:"localS3"`
+
+	//Net Extras
+	//url the net job sends its requests to, defaults to the built-in sink
+	NetTarget string `json:"netTarget,omitempty" yaml:"netTarget"`
+	//listen address of the built-in sink, functions must be able to reach it (see netTarget)
+	NetSink string `json:"netSink,omitempty" yaml:"netSink"`
+
+	//versioned calibration file whose level tables replace the presets
+	CalibrationFile string `json:"calibration,omitempty" yaml:"calibration"`
+	calibration     *Calibration
+
 	//Invoker
 	Invoker bencher.InvokerConfig `json:"invoker,omitempty" yaml:"invoker"`
 
 	//Deployment
 	Deployment Deployment `json:"deployment,omitempty" yaml:"deployment"`
-
-	Platform Platform
+	//several deployments benchmarked with the same load, replaces deployment, see Split
+	Targets []TargetConfig `json:"targets,omitempty" yaml:"targets"`
+	//parallel (default) or sequential
+	TargetMode string `json:"targetMode,omitempty" yaml:"targetMode"`
+	//the target of a split workload and the experiment it belongs to
+	TargetName string `json:"targetName,omitempty" yaml:"-"`
+	experiment string
+
+	Platform Platform `json:"-" yaml:"-"`
+	//the function the deployment reported, see ApplyDeployment
+	Deployed *DeploymentResult `json:"deployed,omitempty" yaml:"-"`
+
+	//result file of the prepared run, see ResultFile
+	resultFile string
 }
 
 func (w *PerformanceWorkload) Prepare() *bencher.Bencher {
 	//check if keys is set and generate files otherwise...
+	//resolved here instead of by the bencher, the provenance sidecar has to know the name
+	w.resultFile = resultFile(w.Name, time.Now())
 	config := bencher.BenchmarkConfig{
-		OutputFile: "data/$name_$date.csv",
+		OutputFile: w.resultFile,
 		Workload: bencher.WorkloadConfig{
-			Name:   w.Name,
-			Target: w.Target,
-			Phases: []bencher.PhaseConfig{
-				{
-					Name:    "warmup",
-					Threads: w.Threads,
-					HatchRate: bencher.HatchRateConfig{
-						Type: "fixed",
-						Options: map[string]interface{}{
-							"trps": w.Warmup,
-						},
-					},
-					Timeout: w.PhaseLength,
-				},
-				{
-					Name:    "scale",
-					Threads: w.Threads,
-					HatchRate: bencher.HatchRateConfig{
-						Type: "slope",
-						Options: map[string]interface{}{
-							"start": w.Warmup,
-							"rate":  w.Scaling,
-						},
-					},
-					Timeout: w.PhaseLength,
-				},
-				{
-					Name:    "settle",
-					Threads: w.Threads,
-					HatchRate: bencher.HatchRateConfig{
-						Type: "fixed",
-						Options: map[string]interface{}{
-							"trps": int(math.Ceil(float64(w.Warmup) + w.PhaseLength.Seconds()*w.Scaling)),
-						},
-					},
-					Timeout: w.PhaseLength,
-				},
-			},
+			Name:       w.Name,
+			Target:     w.Target,
+			Phases:     w.phases(),
 			Invocation: w.Invoker,
 		},
 	}
@@ -233,8 +343,9 @@ func (w *PerformanceWorkload) Prepare() *bencher.Bencher {
 		panic(err)
 	}
 
-	if w.Type == "io" {
-		w.Keys = make([]string, ioLevel[w.Level].objectNumber)
+	if w.Uses("io") {
+		_, objects := w.ioObjects()
+		w.Keys = make([]string, objects)
 		for i := 0; i < len(w.Keys); i++ {
 			w.Keys[i] = fmt.Sprintf("in_%s_%d.bin", w.Name, i)
 		}
@@ -248,7 +359,7 @@ func (w *PerformanceWorkload) Prepare() *bencher.Bencher {
 			go func() {
 				time.Sleep(delay)
 				log.Info("trigger operational change")
-				err := w.Platform.Change(*w.Operation)
+				err := w.Platform.Change(w.Operation.WithSecrets(w.FunctionSecrets()))
 				if err != nil {
 					log.Errorf("failed to apply OpTask %+v", err)
 				}
@@ -260,103 +371,382 @@ func (w *PerformanceWorkload) Prepare() *bencher.Bencher {
 	return runner
 }
 
-func (w *PerformanceWorkload) GenerateIObjects() {
-	//connect
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region:           aws.String("auto"),
-		Endpoint:         aws.String(w.Endpoint),
-		Credentials:      credentials.NewStaticCredentials(w.AccessKeyID, w.AccessKeySecret, ""),
-		DisableSSL:       aws.Bool(true),
-		S3ForcePathStyle: aws.Bool(true),
-	}))
+// phases are the load phases of a run: warmup at a fixed rate, a linear scale-up and a settle phase at the reached rate
+func (w PerformanceWorkload) phases() []bencher.PhaseConfig {
+	return []bencher.PhaseConfig{
+		{
+			Name:    "warmup",
+			Threads: w.Threads,
+			HatchRate: bencher.HatchRateConfig{
+				Type: "fixed",
+				Options: map[string]interface{}{
+					"trps": w.Warmup,
+				},
+			},
+			Timeout: w.PhaseLength,
+		},
+		{
+			Name:    "scale",
+			Threads: w.Threads,
+			HatchRate: bencher.HatchRateConfig{
+				Type: "slope",
+				Options: map[string]interface{}{
+					"start": w.Warmup,
+					"rate":  w.Scaling,
+				},
+			},
+			Timeout: w.PhaseLength,
+		},
+		{
+			Name:    "settle",
+			Threads: w.Threads,
+			HatchRate: bencher.HatchRateConfig{
+				Type: "fixed",
+				Options: map[string]interface{}{
+					"trps": int(math.Ceil(float64(w.Warmup) + w.PhaseLength.Seconds()*w.Scaling)),
+				},
+			},
+			Timeout: w.PhaseLength,
+		},
+	}
+}
+
+// ResultFile returns the file the prepared run writes its results to.
+func (w *PerformanceWorkload) ResultFile() string {
+	return w.resultFile
+}
 
-	s3Client := s3.New(sess)
+// StartLocalS3 starts the built-in S3 stand-in and points the IO payload at it.
+// An explicitly configured Endpoint is kept, e.g. if functions reach the driver through a different address.
+func (w *PerformanceWorkload) StartLocalS3() (*LocalS3, error) {
+	store := NewLocalS3()
+	endpoint, err := store.Start(w.LocalS3)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("started local s3 at %s", endpoint)
 
-	//create a test bucket
-	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{
-		Bucket: &w.Bucket,
-	})
+	if w.Endpoint == "" {
+		w.Endpoint = endpoint
+	}
+	w.DisableSSL = true
+	w.S3PathStyle = true
+	return store, nil
+}
 
+// StartNetSink starts the built-in sink and points the net job at it, unless netTarget is set explicitly.
+func (w *PerformanceWorkload) StartNetSink() (*NetSink, error) {
+	sink := NewNetSink()
+	endpoint, err := sink.Start(w.NetSink)
 	if err != nil {
-		//Mhh
+		return nil, err
+	}
+	log.Infof("started net sink at %s", endpoint)
+
+	if w.NetTarget == "" {
+		w.NetTarget = endpoint + "/sink"
+	}
+	return sink, nil
+}
+
+func (w *PerformanceWorkload) GenerateIObjects() {
+	if strings.ToLower(w.Backend) == "fs" {
+		log.Info("fs objects are generated by the function on first access")
+		return
 	}
 
-	task := ioLevel[w.Level]
+	//connect
+	uploader, err := newObjectUploader(w)
+	if err != nil {
+		log.Errorf("failed to connect to %s storage %+v", w.Backend, err)
+		return
+	}
+	defer uploader.Close()
+
+	objectSize, _ := w.ioObjects()
 	//create #keys files
 	for i := 0; i < len(w.Keys); i++ {
 		key := w.Keys[i]
-		body, size := generateRandomFile(task.objectSize)
-		w.Keys[i] = key
-
-		contentType := "application/octet-stream"
-		_, err := s3Client.PutObject(&s3.PutObjectInput{
-			Body:          body,
-			Bucket:        &w.Bucket,
-			ContentLength: &size,
-			ContentType:   &contentType,
-			Key:           &key,
-		})
+		body, size := generateRandomFile(objectSize)
 
+		err := uploader.Put(key, body, size)
 		if err != nil {
-			//Panic
+			log.Errorf("failed to upload %s %+v", key, err)
+		}
+	}
+}
+
+// maxPrime keeps the prime candidates, drawn below 2*max, within 32 bits
+const maxPrime = math.MaxInt32 / 2
+
+// Validate checks the explicit task parameters of the workload, before anything is deployed.
+func (w PerformanceWorkload) Validate() error {
+	if p := w.PrimeParams; p != nil && (p.Max < 0 || p.Max > maxPrime) {
+		return fmt.Errorf("prime max %d is out of range, candidates are drawn below 2*max and the max can be at most %d", p.Max, maxPrime)
+	}
+	if w.Uses("net") && w.NetTarget == "" && w.NetSink == "" {
+		return fmt.Errorf("net requests need a netTarget or a netSink to send to")
+	}
+	//the function reads chunks at random offsets inside the objects
+	for _, single := range w.singles() {
+		if single.Type != "io" {
+			continue
+		}
+		task, ok := single.ioTask()
+		if !ok {
+			continue
+		}
+		if task.ChunkSize <= 0 {
+			return fmt.Errorf("io level %d has a chunk size of %d, it has to be positive", single.Level, task.ChunkSize)
+		}
+		//rw is the share of reads, jobs without reads never touch the objects
+		if task.ReadWrite > 0 && task.ChunkSize >= task.ObjectSize {
+			return fmt.Errorf("io level %d reads chunks of %d bytes, they have to be smaller than the objects of %d bytes", single.Level, task.ChunkSize, task.ObjectSize)
+		}
+	}
+	return nil
+}
+
+// the task lookups prefer a loaded calibration over the preset level tables,
+// explicit parameters of the workload are applied on top of the level
+
+func (w PerformanceWorkload) idleTask() (float64, bool) {
+	sleep, ok := idleLevel[w.Level]
+	if w.calibration != nil {
+		if calibrated, found := w.calibration.Idle[w.Level]; found {
+			sleep, ok = calibrated, true
+		}
+	}
+	if w.IdleParams != nil {
+		sleep, ok = w.IdleParams.Seconds(), true
+	}
+	return sleep, ok
+}
+
+func (w PerformanceWorkload) memoryTask() (MemoryTask, bool) {
+	task, ok := memoryLevel[w.Level]
+	if w.calibration != nil {
+		if calibrated, found := w.calibration.Memory[w.Level]; found {
+			task, ok = calibrated, true
+		}
+	}
+	if p := w.MemoryParams; p != nil {
+		if p.OperatorSize > 0 {
+			task.OperatorSize = p.OperatorSize
+		}
+		if p.Iteration > 0 {
+			task.Iteration = p.Iteration
+		}
+		if p.RecursionDepth > 0 {
+			task.RecursionDepth = p.RecursionDepth
+		}
+		ok = ok || (task.OperatorSize > 0 && task.Iteration > 0)
+	}
+	return task, ok
+}
+
+func (w PerformanceWorkload) ioTask() (IOTask, bool) {
+	task, ok := ioLevel[w.Level]
+	if w.calibration != nil {
+		if calibrated, found := w.calibration.IO[w.Level]; found {
+			task, ok = calibrated, true
+		}
+	}
+	if p := w.IOParams; p != nil {
+		if p.Iteration != nil {
+			task.Iteration = *p.Iteration
+		}
+		if p.ReadWrite != nil {
+			task.ReadWrite = *p.ReadWrite
 		}
+		if p.ChunkSize != nil {
+			task.ChunkSize = *p.ChunkSize
+		}
+		if p.ObjectSize != nil {
+			task.ObjectSize = *p.ObjectSize
+		}
+		if p.ObjectNumber != nil {
+			task.ObjectNumber = *p.ObjectNumber
+		}
+		ok = ok || (task.Iteration > 0 && task.ChunkSize > 0)
+	}
+	return task, ok
+}
 
+func (w PerformanceWorkload) primeTask() (int32, bool) {
+	level, ok := primeLevel[w.Level]
+	if w.calibration != nil {
+		if calibrated, found := w.calibration.Prime[w.Level]; found {
+			level, ok = calibrated, true
+		}
+	}
+	if w.PrimeParams != nil && w.PrimeParams.Max > 0 {
+		level, ok = w.PrimeParams.Max, true
+	}
+	return level, ok
+}
+
+func (w PerformanceWorkload) cpuTask() (CPUTask, bool) {
+	task, ok := cpuLevel[w.Type][w.Level]
+	task.Kernel = w.Type
+	if p := w.CPUParams; p != nil {
+		if p.Size > 0 {
+			task.Size = p.Size
+		}
+		if p.Iteration > 0 {
+			task.Iteration = p.Iteration
+		}
+		ok = ok || (task.Size > 0 && task.Iteration > 0)
 	}
+	return task, ok
+}
+
+func (w PerformanceWorkload) netTask() (NetTask, bool) {
+	task, ok := netLevel[w.Level]
+	if p := w.NetParams; p != nil {
+		if p.Requests != nil {
+			task.Requests = *p.Requests
+		}
+		if p.PayloadSize != nil {
+			task.PayloadSize = *p.PayloadSize
+		}
+		if p.Concurrency != nil {
+			task.Concurrency = *p.Concurrency
+		}
+		if p.KeepAlive != nil {
+			task.KeepAlive = *p.KeepAlive
+		}
+		ok = ok || task.Requests > 0
+	}
+	task.Target = w.NetTarget
+	return task, ok
+}
+
+func (w PerformanceWorkload) diskTask() (DiskTask, bool) {
+	task, ok := diskLevel[w.Level]
+	if p := w.DiskParams; p != nil {
+		if p.Files > 0 {
+			task.Files = p.Files
+		}
+		if p.FileSize > 0 {
+			task.FileSize = p.FileSize
+		}
+		if p.BlockSize > 0 {
+			task.BlockSize = p.BlockSize
+		}
+		if p.Dir != "" {
+			task.Dir = p.Dir
+		}
+		ok = ok || (task.Files > 0 && task.FileSize > 0)
+	}
+	return task, ok
+}
+
+func (w PerformanceWorkload) allocTask() (AllocTask, bool) {
+	task, ok := allocLevel[w.Level]
+	if p := w.AllocParams; p != nil {
+		if p.Size > 0 {
+			task.Size = p.Size
+		}
+		if p.Pattern != "" {
+			task.Pattern = p.Pattern
+		}
+		if p.Stride > 0 {
+			task.Stride = p.Stride
+		}
+		if p.Passes > 0 {
+			task.Passes = p.Passes
+		}
+		if p.Hold > 0 {
+			task.Hold = p.Hold.Milliseconds()
+		}
+		ok = ok || task.Size > 0
+	}
+	return task, ok
 }
 
 func (w PerformanceWorkload) Payload() bencher.PayloadFunc {
-	if w.Level < 0 && w.Level > 7 {
-		panic("workload complexity level unknown")
+	seeds := w.seeder()
+	var payload bencher.PayloadFunc
+	if len(w.Mix) > 0 {
+		payload = w.mixPayload(seeds)
+	} else {
+		payload = w.payload("", seeds)
+	}
+
+	if w.Workflow != nil {
+		return w.workflowPayload(payload, seeds)
 	}
+	return payload
+}
+
+// payload generates the jobs of a single type, class is echoed by the function to tell the classes of a mix apart.
+func (w PerformanceWorkload) payload(class string, seeds seedFunc) bencher.PayloadFunc {
+	unknownLevel := fmt.Sprintf("workload complexity level %d unknown for %s", w.Level, w.Type)
+	job := Job{Class: class, Usage: w.Usage}
 
 	switch w.Type {
 	case "idle":
-		sleep := idleLevel[w.Level]
-		data, err := json.Marshal(Job{Idle: &sleep})
-		if err != nil {
-			panic(err)
-		}
-		return func(invoker bencher.Invoker) []byte {
-			return data
+		sleep, ok := w.idleTask()
+		if !ok {
+			panic(unknownLevel)
 		}
+		job.Idle = &sleep
+		return staticPayload(job, seeds)
 	case "memory":
-		task := memoryLevel[w.Level]
-		data, err := json.Marshal(Job{Memory: &task})
-		if err != nil {
-			panic(err)
-		}
-		return func(invoker bencher.Invoker) []byte {
-			return data
+		task, ok := w.memoryTask()
+		if !ok {
+			panic(unknownLevel)
 		}
+		job.Memory = &task
+		return staticPayload(job, seeds)
 	case "io":
-		ioTemplate := ioLevel[w.Level]
-		io := IOTask{
-			Iteration:       ioTemplate.Iteration,
-			ReadWrite:       ioTemplate.ReadWrite,
-			ChunkSize:       ioTemplate.ChunkSize,
-			Bucket:          w.Bucket,
-			Keys:            w.Keys,
-			Endpoint:        w.Endpoint,
-			AccessKeyID:     w.AccessKeyID,
-			AccessKeySecret: w.AccessKeySecret,
-			Args: map[string]string{
-				"DisableSSL":  strconv.FormatBool(w.DisableSSL),
-				"S3PathStyle": strconv.FormatBool(w.S3PathStyle),
-				"region":      w.S3Region,
-			},
+		ioTemplate, ok := w.ioTask()
+		if !ok {
+			panic(unknownLevel)
 		}
-		data, err := json.Marshal(Job{IO: &io})
-		if err != nil {
-			panic(err)
+		io := w.ioJob(ioTemplate)
+		job.IO = &io
+		return staticPayload(job, seeds)
+	case "disk":
+		task, ok := w.diskTask()
+		if !ok {
+			panic(unknownLevel)
 		}
-		return func(invoker bencher.Invoker) []byte {
-			return data
+		job.Disk = &task
+		return staticPayload(job, seeds)
+	case "alloc":
+		task, ok := w.allocTask()
+		if !ok {
+			panic(unknownLevel)
+		}
+		job.Alloc = &task
+		return staticPayload(job, seeds)
+	case "net":
+		task, ok := w.netTask()
+		if !ok {
+			panic(unknownLevel)
 		}
+		job.Net = &task
+		return staticPayload(job, seeds)
+	case "matrix", "sha256", "gzip", "json":
+		task, ok := w.cpuTask()
+		if !ok {
+			panic(unknownLevel)
+		}
+		job.CPU = &task
+		return staticPayload(job, seeds)
 	case "prime":
-		level := primeLevel[w.Level]
+		level, ok := w.primeTask()
+		if !ok {
+			panic(unknownLevel)
+		}
 		return func(invoker bencher.Invoker) []byte {
-			primeCandidate := uint32(rand.Int31n(level) + rand.Int31n(level) - 1)
-			data, err := json.Marshal(Job{Prime: &primeCandidate})
+			seed, rnd := seeds()
+			primeCandidate := uint32(rnd.Int31n(level) + rnd.Int31n(level) - 1)
+			prime := job
+			prime.Version, prime.Prime, prime.Seed = SchemaVersion, &primeCandidate, seed
+			data, err := json.Marshal(prime)
 			if err != nil {
 				log.Errorf("failed to generate prime payload %+v", err)
 			}
@@ -367,37 +757,141 @@ func (w PerformanceWorkload) Payload() bencher.PayloadFunc {
 	panic(fmt.Sprintf("workload of unknown type %s", w.Type))
 }
 
+// ioJob combines the level parameters with the storage configuration of the workload.
+func (w PerformanceWorkload) ioJob(template IOTask) IOTask {
+	objectSize, _ := w.ioObjects()
+	task := IOTask{
+		Iteration: template.Iteration,
+		ReadWrite: template.ReadWrite,
+		ChunkSize: template.ChunkSize,
+		Bucket:    w.Bucket,
+		Keys:      w.Keys,
+		Backend:   w.Backend,
+		NoCache:   w.NoIOCache,
+		Endpoint:  w.Endpoint,
+		Args: map[string]string{
+			"DisableSSL":  strconv.FormatBool(w.DisableSSL),
+			"S3PathStyle": strconv.FormatBool(w.S3PathStyle),
+			"objectSize":  strconv.FormatInt(objectSize, 10),
+		},
+	}
+	//the function falls back to its default region if we don't send one
+	if w.S3Region != "" {
+		task.Args["region"] = w.S3Region
+	}
+	return task
+}
+
+// SchemaVersion versions the job payload shared by all workload runtimes, bump it on incompatible changes
+const SchemaVersion = 2
+
+// Job is the canonical payload of all workload runtimes, see workloads/go and workloads/python.
 type Job struct {
+	Version int `json:"version"`
+
 	Prime  *uint32     `json:"prime,omitempty"`
 	Memory *MemoryTask `json:"memory,omitempty"`
 	IO     *IOTask     `json:"io,omitempty"`
-	Idle   *int        `json:"idle,omitempty"`
+	//seconds, fractions are supported since schema version 2
+	Idle  *float64   `json:"idle,omitempty"`
+	CPU   *CPUTask   `json:"cpu,omitempty"`
+	Net   *NetTask   `json:"net,omitempty"`
+	Alloc *AllocTask `json:"alloc,omitempty"`
+	Disk  *DiskTask  `json:"disk,omitempty"`
+
+	Seed  *int64 `json:"seed,omitempty"`
+	Class string `json:"class,omitempty"`
+	Next  []Step `json:"next,omitempty"`
+	//asks the function to sample its resource usage
+	Usage bool `json:"usage,omitempty"`
+}
+
+// PrimeTask configures the prime job, candidates are drawn below 2*Max.
+type PrimeTask struct {
+	Max int32 `json:"max,omitempty" yaml:"max"`
+}
+
+// IOParameters overrides parts of the io level, unset fields keep the level values.
+type IOParameters struct {
+	Iteration    *int     `json:"iterations,omitempty" yaml:"iterations"`
+	ReadWrite    *float32 `json:"rw,omitempty" yaml:"rw"`
+	ChunkSize    *int64   `json:"chunkSize,omitempty" yaml:"chunkSize"`
+	ObjectSize   *int64   `json:"objectSize,omitempty" yaml:"objectSize"`
+	ObjectNumber *int     `json:"objects,omitempty" yaml:"objects"`
+}
+
+// CPUTask configures the cpu kernels matrix, sha256, gzip and json, the kernel is the workload type.
+type CPUTask struct {
+	Kernel    string `json:"kernel" yaml:"-"`
+	Size      int    `json:"size,omitempty" yaml:"size"`
+	Iteration int    `json:"itterations,omitempty" yaml:"iterations"`
+}
+
+type DiskTask struct {
+	Files     int    `json:"files,omitempty" yaml:"files"`
+	FileSize  int64  `json:"size,omitempty" yaml:"size"`
+	BlockSize int64  `json:"block,omitempty" yaml:"block"`
+	Dir       string `json:"dir,omitempty" yaml:"dir"`
+}
+
+type AllocTask struct {
+	Size    int64  `json:"mib"`
+	Pattern string `json:"pattern,omitempty"`
+	Stride  int64  `json:"stride,omitempty"`
+	Passes  int    `json:"passes,omitempty"`
+	Hold    int64  `json:"hold_ms,omitempty"`
+}
+
+// AllocParameters overrides parts of the alloc level, the pattern is one of sequential, random or strided.
+type AllocParameters struct {
+	Size    int64         `json:"mib,omitempty" yaml:"mib"`
+	Pattern string        `json:"pattern,omitempty" yaml:"pattern"`
+	Stride  int64         `json:"stride,omitempty" yaml:"stride"`
+	Passes  int           `json:"passes,omitempty" yaml:"passes"`
+	Hold    time.Duration `json:"hold,omitempty" yaml:"hold"`
+}
+
+type NetTask struct {
+	Target      string `json:"target"`
+	Requests    int    `json:"requests,omitempty"`
+	PayloadSize int64  `json:"size,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+	KeepAlive   bool   `json:"keep_alive,omitempty"`
+}
+
+// NetParameters overrides parts of the net level, unset fields keep the level values.
+type NetParameters struct {
+	Requests    *int   `json:"requests,omitempty" yaml:"requests"`
+	PayloadSize *int64 `json:"size,omitempty" yaml:"size"`
+	Concurrency *int   `json:"concurrency,omitempty" yaml:"concurrency"`
+	KeepAlive   *bool  `json:"keepAlive,omitempty" yaml:"keepAlive"`
 }
 
 type MemoryTask struct {
-	OperatorSize   uint32 `json:"operator_size,omitempty"`
-	Iteration      uint32 `json:"itterations,omitempty"`
-	RecursionDepth uint32 `json:"recursion_depth,omitempty"`
+	OperatorSize   uint32 `json:"operator_size,omitempty" yaml:"operator_size"`
+	Iteration      uint32 `json:"itterations,omitempty" yaml:"iterations"`
+	RecursionDepth uint32 `json:"recursion_depth,omitempty" yaml:"recursion_depth"`
 }
 
 type IOTask struct {
-	Iteration int     `json:"itteration,omitempty"`
-	ReadWrite float32 `json:"rw,omitempty"`
-	ChunkSize int64   `json:"size,omitempty"`
+	Iteration int     `json:"itteration,omitempty" yaml:"iterations"`
+	ReadWrite float32 `json:"rw,omitempty" yaml:"rw"`
+	ChunkSize int64   `json:"size,omitempty" yaml:"chunkSize"`
 
-	Bucket string   `json:"bucket,omitempty"`
-	Keys   []string `json:"keys,omitempty"`
+	Bucket string   `json:"bucket,omitempty" yaml:"-"`
+	Keys   []string `json:"keys,omitempty" yaml:"-"`
 
-	Endpoint        string `json:"endpoint,omitempty"`
-	AccessKeyID     string `json:"key_id,omitempty"`
-	AccessKeySecret string `json:"key,omitempty"`
+	Backend  string `json:"backend,omitempty" yaml:"-"`
+	NoCache  bool   `json:"no_cache,omitempty" yaml:"-"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"-"`
 
 	objects map[string]int64
 
-	Args map[string]string `json:"-"`
+	Args map[string]string `json:"args,omitempty" yaml:"-"`
 
-	objectSize   int64
-	objectNumber int
+	//inputs the driver generates before the run, never sent to the function
+	ObjectSize   int64 `json:"-" yaml:"objectSize"`
+	ObjectNumber int   `json:"-" yaml:"objects"`
 }
 
 func generateRandomFile(fileSize int64) (io.ReadSeeker, int64) {
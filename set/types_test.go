@@ -0,0 +1,97 @@
+package set
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTaskParameters(t *testing.T) {
+	iterations, objects := 7, 3
+	w := PerformanceWorkload{
+		Level:        2,
+		MemoryParams: &MemoryTask{Iteration: 42},
+		IOParams:     &IOParameters{Iteration: &iterations, ObjectNumber: &objects},
+		PrimeParams:  &PrimeTask{Max: 1000},
+	}
+
+	//explicit parameters replace their field of the level, all other fields keep the level values
+	memory, ok := w.memoryTask()
+	level := memoryLevel[2]
+	if !ok || memory.Iteration != 42 || memory.OperatorSize != level.OperatorSize || memory.RecursionDepth != level.RecursionDepth {
+		t.Errorf("unexpected memory task %+v", memory)
+	}
+	io, ok := w.ioTask()
+	if !ok || io.Iteration != 7 || io.ObjectNumber != 3 || io.ChunkSize != ioLevel[2].ChunkSize || io.ReadWrite != ioLevel[2].ReadWrite {
+		t.Errorf("unexpected io task %+v", io)
+	}
+	if max, ok := w.primeTask(); !ok || max != 1000 {
+		t.Errorf("expected a prime max of 1000, got %d", max)
+	}
+
+	//the parameters also apply on top of a calibration
+	sleep := 1500 * time.Millisecond
+	w.calibration = &Calibration{Memory: map[byte]MemoryTask{2: {OperatorSize: 5, Iteration: 5, RecursionDepth: 5}}}
+	w.IdleParams = &sleep
+	if memory, _ := w.memoryTask(); memory.Iteration != 42 || memory.OperatorSize != 5 {
+		t.Errorf("unexpected calibrated memory task %+v", memory)
+	}
+	if idle, ok := w.idleTask(); !ok || idle != 1.5 {
+		t.Errorf("expected an idle time of 1.5s, got %f", idle)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	w := PerformanceWorkload{Type: "prime", PrimeParams: &PrimeTask{Max: maxPrime}}
+	if err := w.Validate(); err != nil {
+		t.Errorf("the largest prime max was rejected: %v", err)
+	}
+	for _, max := range []int32{maxPrime + 1, -1} {
+		w.PrimeParams.Max = max
+		if err := w.Validate(); err == nil {
+			t.Errorf("the prime max %d was accepted", max)
+		}
+	}
+
+	w = PerformanceWorkload{Mix: []MixEntry{{Type: "idle", Weight: 1}, {Type: "net", Weight: 1}}}
+	if err := w.Validate(); err == nil {
+		t.Error("net requests without target were accepted")
+	}
+	w.NetSink = "127.0.0.1:0"
+	if err := w.Validate(); err != nil {
+		t.Errorf("net requests to the sink were rejected: %v", err)
+	}
+
+	for level := range ioLevel {
+		w = PerformanceWorkload{Type: "io", Level: level}
+		if err := w.Validate(); err != nil {
+			t.Errorf("io level %d was rejected: %v", level, err)
+		}
+	}
+	chunk, object, zero, rw := int64(MiB), int64(MiB), int64(0), float32(0.5)
+	for name, params := range map[string]*IOParameters{
+		"chunk of the object size": {ChunkSize: &chunk, ObjectSize: &object, ReadWrite: &rw},
+		"empty chunks":             {ChunkSize: &zero},
+	} {
+		w = PerformanceWorkload{Type: "io", Level: 0, IOParams: params}
+		if err := w.Validate(); err == nil {
+			t.Errorf("%s were accepted", name)
+		}
+	}
+}
+
+func TestPayloadUsage(t *testing.T) {
+	for _, jobType := range []string{"prime", "idle"} {
+		w := PerformanceWorkload{Type: jobType, Level: 1}
+		for _, usage := range []bool{false, true} {
+			w.Usage = usage
+			var job Job
+			if err := json.Unmarshal(w.Payload()(nil), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Usage != usage || job.Version != SchemaVersion {
+				t.Errorf("%s: expected usage %t, got %+v", jobType, usage, job)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package set
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/faas-facts/bench/bencher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Workflow composes the benchmarked function with downstream functions.
+// The entry function is the target of the workload, it invokes the steps itself and
+// records the latency of every step in its trace, the entry latency is the end-to-end latency.
+type Workflow struct {
+	//chain (default) invokes the steps one after another, fanout invokes all steps from the entry function and waits for them
+	Mode  string         `json:"mode,omitempty" yaml:"mode"`
+	Steps []WorkflowStep `json:"steps" yaml:"steps"`
+}
+
+type WorkflowStep struct {
+	Name  string `json:"name" yaml:"name"`
+	Type  string `json:"type" yaml:"type"`
+	Level byte   `json:"complexity" yaml:"complexity"`
+
+	//http endpoint of the step, defaults to the deployed step or to the entry function
+	Target     string      `json:"target,omitempty" yaml:"target"`
+	Deployment *Deployment `json:"deployment,omitempty" yaml:"deployment"`
+}
+
+// Step is the downstream invocation send along with the job.
+type Step struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Job    Job    `json:"job"`
+}
+
+// DeployWorkflow deploys the steps with their own deployment, all other steps reuse the entry function.
+// It checks the mode and the jobs of all steps, so the payload of the workload can't fail later on.
+func (w *PerformanceWorkload) DeployWorkflow(entry DeploymentResult) error {
+	if w.Workflow == nil {
+		return nil
+	}
+	if len(w.Workflow.Steps) == 0 {
+		return fmt.Errorf("the workflow of %s has no steps", w.Name)
+	}
+	if _, err := w.Workflow.chained(); err != nil {
+		return err
+	}
+
+	seeds := w.seeder()
+	for i := range w.Workflow.Steps {
+		step := &w.Workflow.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if _, err := w.stepPayload(*step, seeds); err != nil {
+			return fmt.Errorf("invalid workflow step %s: %w", step.Name, err)
+		}
+		if step.Target != "" {
+			continue
+		}
+		//the functions invoke the steps over http
+		if step.Deployment == nil {
+			if entry.URL == "" {
+				return fmt.Errorf("step %s reuses the entry function, which was deployed without url (function %s)", step.Name, entry.Function)
+			}
+			step.Target = entry.URL
+			continue
+		}
+
+		result, err := w.Platform.Deploy(step.Deployment.WithSecrets(w.FunctionSecrets()))
+		if err != nil {
+			return fmt.Errorf("failed to deploy step %s %+v", step.Name, err)
+		}
+		if result.URL == "" {
+			return fmt.Errorf("step %s was deployed without url (function %s)", step.Name, result.Function)
+		}
+		step.Target = result.URL
+		log.Infof("deployed step %s at %s", step.Name, step.Target)
+	}
+	return nil
+}
+
+// chained reports if the steps are nested (chain) or all invoked by the entry function (fanout)
+func (wf Workflow) chained() (bool, error) {
+	switch strings.ToLower(wf.Mode) {
+	case "", "chain":
+		return true, nil
+	case "fanout":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown workflow mode %s, use chain or fanout", wf.Mode)
+}
+
+// stepPayload generates the jobs of a step, unknown types and levels are reported instead of panicking
+func (w PerformanceWorkload) stepPayload(step WorkflowStep, seeds seedFunc) (payload bencher.PayloadFunc, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return w.classWorkload(MixEntry{Type: step.Type, Level: step.Level}).payload("", seeds), nil
+}
+
+// workflowPayload attaches the workflow steps to every entry job, the step jobs are generated per invocation.
+// The steps have to be checked by DeployWorkflow before.
+func (w PerformanceWorkload) workflowPayload(entry bencher.PayloadFunc, seeds seedFunc) bencher.PayloadFunc {
+	chained, err := w.Workflow.chained()
+	if err != nil {
+		panic(err)
+	}
+	payloads := make([]bencher.PayloadFunc, len(w.Workflow.Steps))
+	for i, ws := range w.Workflow.Steps {
+		if ws.Target == "" {
+			panic(fmt.Sprintf("workflow step %s has no target", ws.Name))
+		}
+		if payloads[i], err = w.stepPayload(ws, seeds); err != nil {
+			panic(err)
+		}
+	}
+
+	return func(invoker bencher.Invoker) []byte {
+		data := entry(invoker)
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Errorf("failed to attach workflow %+v", err)
+			return data
+		}
+
+		steps := make([]Step, len(payloads))
+		for i, payload := range payloads {
+			steps[i] = Step{Name: w.Workflow.Steps[i].Name, Target: w.Workflow.Steps[i].Target}
+			if err := json.Unmarshal(payload(invoker), &steps[i].Job); err != nil {
+				log.Errorf("failed to generate the job of step %s %+v", steps[i].Name, err)
+				return data
+			}
+		}
+		if chained {
+			//nest the steps, each one invokes the following
+			for i := len(steps) - 2; i >= 0; i-- {
+				steps[i].Job.Next = steps[i+1 : i+2]
+			}
+			steps = steps[:1]
+		}
+
+		job.Next = steps
+		data, err := json.Marshal(job)
+		if err != nil {
+			log.Errorf("failed to generate workflow payload %+v", err)
+		}
+		return data
+	}
+}
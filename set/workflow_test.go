@@ -0,0 +1,120 @@
+package set
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	workload "github.com/ISE-SMILE/SET/workloads/go"
+)
+
+// stepServer executes posted jobs like a deployed function and answers with the tags of a trace
+func stepServer(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var job workload.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tags, err := workload.Execute(job)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{"Tags": tags})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestWorkflow_Modes(t *testing.T) {
+	for mode, expected := range map[string][]string{
+		"chain":  {"step.a.latency", "step.b.latency", "step.c.latency"},
+		"fanout": {"step.a.latency", "step.b.latency", "step.c.latency"},
+	} {
+		target := stepServer(t)
+		w := PerformanceWorkload{
+			Type: "prime",
+			Workflow: &Workflow{
+				Mode: mode,
+				Steps: []WorkflowStep{
+					{Name: "a", Type: "prime", Level: 0},
+					{Name: "b", Type: "memory", Level: 0},
+					{Name: "c", Type: "idle", Level: 0},
+				},
+			},
+		}
+		if err := w.DeployWorkflow(DeploymentResult{URL: target}); err != nil {
+			t.Fatal(err)
+		}
+
+		var job workload.Job
+		if err := json.Unmarshal(w.Payload()(nil), &job); err != nil {
+			t.Fatal(err)
+		}
+		if mode == "chain" && (len(job.Next) != 1 || len(job.Next[0].Job.Next) != 1) {
+			t.Fatalf("chain is not nested: %+v", job.Next)
+		}
+		if mode == "fanout" && len(job.Next) != 3 {
+			t.Fatalf("fanout has %d steps", len(job.Next))
+		}
+
+		tags, err := workload.Execute(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range expected {
+			if _, ok := tags[tag]; !ok {
+				t.Errorf("%s: missing %s in %v", mode, tag, tags)
+			}
+		}
+	}
+}
+
+func TestWorkflow_StepJobs(t *testing.T) {
+	seed := int64(7)
+	w := PerformanceWorkload{
+		Type:     "idle",
+		Seed:     &seed,
+		Workflow: &Workflow{Mode: "fanout", Steps: []WorkflowStep{{Type: "prime", Level: 6}}},
+	}
+	if err := w.DeployWorkflow(DeploymentResult{URL: "http://localhost:8080"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//every invocation gets its own step jobs
+	payload := w.Payload()
+	candidates := make(map[uint32]bool)
+	for i := 0; i < 10; i++ {
+		var job workload.Job
+		if err := json.Unmarshal(payload(nil), &job); err != nil {
+			t.Fatal(err)
+		}
+		step := job.Next[0]
+		if step.Name != "step1" || step.Target != "http://localhost:8080" || step.Job.Prime == nil || step.Job.Seed == nil {
+			t.Fatalf("unexpected step %+v", step)
+		}
+		candidates[*step.Job.Prime] = true
+	}
+	if len(candidates) < 2 {
+		t.Errorf("the step jobs are identical for every invocation")
+	}
+}
+
+func TestWorkflow_Invalid(t *testing.T) {
+	for name, workflow := range map[string]Workflow{
+		"mode":  {Mode: "loop", Steps: []WorkflowStep{{Type: "idle", Target: "http://step"}}},
+		"level": {Steps: []WorkflowStep{{Type: "idle", Level: 42, Target: "http://step"}}},
+		"type":  {Steps: []WorkflowStep{{Type: "sleep", Target: "http://step"}}},
+		"empty": {},
+		//an OpenWhisk action is invoked by name, the steps need an url
+		"url": {Steps: []WorkflowStep{{Type: "idle"}}},
+	} {
+		workflow := workflow
+		w := PerformanceWorkload{Type: "idle", Workflow: &workflow}
+		if err := w.DeployWorkflow(DeploymentResult{Function: "bencher"}); err == nil {
+			t.Errorf("%s: the invalid workflow was deployed", name)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package bencher
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// AllocTask allocates Size MiB, touches every page Passes times in the given pattern and holds the memory for Hold ms.
+type AllocTask struct {
+	Size int64 `json:"mib"`
+	//sequential (default), random or strided
+	Pattern string `json:"pattern,omitempty"`
+	//distance between touched bytes of the strided pattern, defaults to 16 pages
+	Stride int64 `json:"stride,omitempty"`
+	Passes int   `json:"passes,omitempty"`
+	Hold   int64 `json:"hold_ms,omitempty"`
+}
+
+// Alloc runs the task and returns the achieved resident set size and the page faults it caused.
+func Alloc(task *AllocTask, rng *rand.Rand) (map[string]string, error) {
+	tags := map[string]string{"job": "alloc"}
+	if task == nil {
+		return tags, nil
+	}
+
+	before := readUsage()
+	start := time.Now()
+
+	data := make([]byte, task.Size<<20)
+	page := int64(os.Getpagesize())
+	passes := task.Passes
+	if passes < 1 {
+		passes = 1
+	}
+
+	for pass := 0; pass < passes; pass++ {
+		switch task.Pattern {
+		case "", "sequential":
+			for i := int64(0); i < int64(len(data)); i += page {
+				data[i]++
+			}
+		case "random":
+			for _, p := range rng.Perm(int(int64(len(data)) / page)) {
+				data[int64(p)*page]++
+			}
+		case "strided":
+			stride := task.Stride
+			if stride <= 0 {
+				stride = 16 * page
+			}
+			for offset := int64(0); offset < stride; offset += page {
+				for i := offset; i < int64(len(data)); i += stride {
+					data[i]++
+				}
+			}
+		default:
+			return tags, fmt.Errorf("unknown access pattern %s", task.Pattern)
+		}
+	}
+	touched := time.Since(start)
+
+	rss := currentRSS()
+	time.Sleep(time.Duration(task.Hold) * time.Millisecond)
+	after := readUsage()
+	runtime.KeepAlive(data)
+
+	tags["mib"] = strconv.FormatInt(task.Size, 10)
+	tags["touch_ms"] = strconv.FormatInt(touched.Milliseconds(), 10)
+	tags["rss"] = strconv.FormatInt(rss, 10)
+	tags["max_rss"] = strconv.FormatInt(after.MaxRSS, 10)
+	tags["minor_faults"] = strconv.FormatInt(after.MinorFaults-before.MinorFaults, 10)
+	tags["major_faults"] = strconv.FormatInt(after.MajorFaults-before.MajorFaults, 10)
+	return tags, nil
+}
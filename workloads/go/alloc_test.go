@@ -0,0 +1,33 @@
+package bencher
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestAlloc(t *testing.T) {
+	for _, pattern := range []string{"sequential", "random", "strided"} {
+		tags, err := Alloc(&AllocTask{Size: 16, Pattern: pattern}, seeded())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags["job"] != "alloc" || tags["mib"] != "16" {
+			t.Errorf("%s: unexpected tags %v", pattern, tags)
+		}
+		if runtime.GOOS != "linux" {
+			continue
+		}
+		//every page was touched, so at least the buffer is resident
+		if rss, _ := strconv.ParseInt(tags["rss"], 10, 64); rss < 16<<20 {
+			t.Errorf("%s: expected a resident set of at least 16MiB, got %s", pattern, tags["rss"])
+		}
+		if faults, _ := strconv.ParseInt(tags["minor_faults"], 10, 64); faults <= 0 {
+			t.Errorf("%s: expected page faults, got %s", pattern, tags["minor_faults"])
+		}
+	}
+
+	if _, err := Alloc(&AllocTask{Size: 1, Pattern: "backwards"}, seeded()); err == nil {
+		t.Error("the unknown pattern ran")
+	}
+}
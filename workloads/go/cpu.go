@@ -0,0 +1,166 @@
+package bencher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+)
+
+// CPUTask runs one of the cpu kernels, Size depends on the kernel:
+// matrix - dimension of the square matrices, sha256/gzip - buffer size in bytes, json - fields per document
+type CPUTask struct {
+	Kernel    string `json:"kernel"`
+	Size      int    `json:"size,omitempty"`
+	Iteration int    `json:"itterations,omitempty"`
+}
+
+// CPU runs the kernel of the task and returns a checksum of the result.
+func CPU(task *CPUTask, rng *rand.Rand) (string, error) {
+	if task == nil {
+		return "", nil
+	}
+
+	switch task.Kernel {
+	case "matrix":
+		return Matrix(task.Size, task.Iteration, rng), nil
+	case "sha256":
+		return Hash(task.Size, task.Iteration, rng), nil
+	case "gzip":
+		return Compress(task.Size, task.Iteration, rng)
+	case "json":
+		return JSON(task.Size, task.Iteration, rng)
+	}
+	return "", fmt.Errorf("unknown cpu kernel %s", task.Kernel)
+}
+
+// Matrix multiplies two random n x n matrices, iterations times.
+func Matrix(n, iterations int, rng *rand.Rand) string {
+	a, b, c := randomMatrix(n, rng), randomMatrix(n, rng), make([]float64, n*n)
+	for it := 0; it < iterations; it++ {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				c[i*n+j] = 0
+			}
+			for k := 0; k < n; k++ {
+				aik := a[i*n+k]
+				for j := 0; j < n; j++ {
+					c[i*n+j] += aik * b[k*n+j]
+				}
+			}
+		}
+		//feed the result back to avoid multiplying the same operands
+		a, c = c, a
+	}
+
+	trace := 0.0
+	for i := 0; i < n; i++ {
+		trace += a[i*n+i]
+	}
+	return strconv.FormatFloat(trace, 'g', -1, 64)
+}
+
+func randomMatrix(n int, rng *rand.Rand) []float64 {
+	m := make([]float64, n*n)
+	for i := range m {
+		m[i] = rng.Float64()
+	}
+	return m
+}
+
+// Hash chains sha256 over a random buffer of size bytes, iterations times.
+func Hash(size, iterations int, rng *rand.Rand) string {
+	buffer := make([]byte, size)
+	rng.Read(buffer)
+
+	sum := sha256.Sum256(nil)
+	for i := 0; i < iterations; i++ {
+		copy(buffer, sum[:])
+		sum = sha256.Sum256(buffer)
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+// Compress gzips and inflates a compressible buffer of size bytes, iterations times.
+func Compress(size, iterations int, rng *rand.Rand) (string, error) {
+	buffer := compressibleBytes(size, rng)
+
+	compressed := bytes.Buffer{}
+	compressedSize := 0
+	for i := 0; i < iterations; i++ {
+		compressed.Reset()
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(buffer); err != nil {
+			return "", err
+		}
+		if err := writer.Close(); err != nil {
+			return "", err
+		}
+		compressedSize = compressed.Len()
+
+		reader, err := gzip.NewReader(&compressed)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			return "", err
+		}
+	}
+	return strconv.Itoa(compressedSize), nil
+}
+
+var words = []string{"serverless", "function", "cold", "warm", "start", "latency", "memory", "io", "trace", "bench", "phase", "scale"}
+
+// compressibleBytes generates text from a small vocabulary, similar to logs or documents
+func compressibleBytes(size int, rng *rand.Rand) []byte {
+	buffer := bytes.Buffer{}
+	buffer.Grow(size + 16)
+	for buffer.Len() < size {
+		buffer.WriteString(words[rng.Intn(len(words))])
+		if rng.Intn(8) == 0 {
+			buffer.WriteString(strconv.Itoa(rng.Int()))
+		}
+		buffer.WriteByte(' ')
+	}
+	return buffer.Bytes()[:size]
+}
+
+// JSON encodes and decodes a synthetic document with fields entries, iterations times.
+func JSON(fields, iterations int, rng *rand.Rand) (string, error) {
+	document := make(map[string]interface{}, fields)
+	for i := 0; i < fields; i++ {
+		key := fmt.Sprintf("%s_%d", words[i%len(words)], i)
+		switch i % 4 {
+		case 0:
+			document[key] = rng.Float64()
+		case 1:
+			document[key] = words[rng.Intn(len(words))]
+		case 2:
+			document[key] = []int{rng.Int(), rng.Int(), rng.Int()}
+		default:
+			document[key] = map[string]interface{}{"id": i, "valid": rng.Intn(2) == 0}
+		}
+	}
+
+	size := 0
+	for i := 0; i < iterations; i++ {
+		data, err := json.Marshal(document)
+		if err != nil {
+			return "", err
+		}
+		size = len(data)
+
+		decoded := make(map[string]interface{}, fields)
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return "", err
+		}
+		document = decoded
+	}
+	return strconv.Itoa(size), nil
+}
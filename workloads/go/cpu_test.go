@@ -0,0 +1,79 @@
+package bencher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func seeded() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
+func TestMatrix(t *testing.T) {
+	n := 8
+	rng := seeded()
+	a, b := randomMatrix(n, rng), randomMatrix(n, rng)
+	trace := 0.0
+	for i := 0; i < n; i++ {
+		c := 0.0
+		for k := 0; k < n; k++ {
+			c += a[i*n+k] * b[k*n+i]
+		}
+		trace += c
+	}
+
+	if checksum := Matrix(n, 1, seeded()); checksum != strconv.FormatFloat(trace, 'g', -1, 64) {
+		t.Errorf("expected the trace %f of a*b, got %s", trace, checksum)
+	}
+}
+
+func TestHash(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	if checksum := Hash(64, 0, seeded()); checksum != hex.EncodeToString(empty[:]) {
+		t.Errorf("expected the hash of nothing without iterations, got %s", checksum)
+	}
+
+	buffer := make([]byte, 64)
+	seeded().Read(buffer)
+	copy(buffer, empty[:])
+	expected := sha256.Sum256(buffer)
+	if checksum := Hash(64, 1, seeded()); checksum != hex.EncodeToString(expected[:]) {
+		t.Errorf("expected %x, got %s", expected, checksum)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	checksum, err := Compress(64*1024, 2, seeded())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the words of the vocabulary compress well
+	if size, _ := strconv.Atoi(checksum); size <= 0 || size > 32*1024 {
+		t.Errorf("unexpected compressed size %s", checksum)
+	}
+	if again, _ := Compress(64*1024, 2, seeded()); again != checksum {
+		t.Errorf("the same seed compressed to %s and %s", checksum, again)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	checksum, err := JSON(100, 3, seeded())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := strconv.Atoi(checksum); size <= 100 {
+		t.Errorf("unexpected document size %s", checksum)
+	}
+	if again, _ := JSON(100, 3, seeded()); again != checksum {
+		t.Errorf("the same seed encoded %s and %s bytes", checksum, again)
+	}
+}
+
+func TestCPU(t *testing.T) {
+	if _, err := CPU(&CPUTask{Kernel: "fft"}, seeded()); err == nil {
+		t.Error("the unknown kernel ran")
+	}
+}
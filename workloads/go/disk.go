@@ -0,0 +1,146 @@
+package bencher
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DiskTask writes Files files of FileSize bytes in BlockSize writes, fsyncs, reads and deletes them.
+// The files are read right after they were written, so the reads are mostly served by the page cache
+// and measure the memory bandwidth of the sandbox rather than the disk, the writes are measured up to the fsync.
+type DiskTask struct {
+	Files     int   `json:"files,omitempty"`
+	FileSize  int64 `json:"size,omitempty"`
+	BlockSize int64 `json:"block,omitempty"`
+	//directory of the files, defaults to the temp dir of the function
+	Dir string `json:"dir,omitempty"`
+}
+
+// diskPhases accumulates the time spent in each phase of the disk job
+type diskPhases struct {
+	write, sync, read, remove time.Duration
+}
+
+// Disk runs the task and returns throughput (bytes/s) and mean latency (µs per file) of each phase.
+func Disk(task *DiskTask, rng *rand.Rand) (map[string]string, error) {
+	tags := map[string]string{"job": "disk"}
+	if task == nil || task.Files < 1 {
+		return tags, nil
+	}
+
+	dir, err := ioutil.TempDir(task.Dir, "set-disk")
+	if err != nil {
+		return tags, err
+	}
+	defer os.RemoveAll(dir)
+
+	block := task.BlockSize
+	if block <= 0 || block > task.FileSize {
+		block = task.FileSize
+	}
+	buffer := make([]byte, block)
+	rng.Read(buffer)
+
+	phases := diskPhases{}
+	var written, read int64
+	for i := 0; i < task.Files; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file_%d.bin", i))
+		n, err := writeFile(name, buffer, task.FileSize, &phases)
+		written += n
+		if err != nil {
+			return tags, err
+		}
+	}
+
+	for i := 0; i < task.Files; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file_%d.bin", i))
+		start := time.Now()
+		n, err := readFile(name, buffer)
+		phases.read += time.Since(start)
+		read += n
+		if err != nil {
+			return tags, err
+		}
+	}
+
+	for i := 0; i < task.Files; i++ {
+		start := time.Now()
+		err := os.Remove(filepath.Join(dir, fmt.Sprintf("file_%d.bin", i)))
+		phases.remove += time.Since(start)
+		if err != nil {
+			return tags, err
+		}
+	}
+
+	files := time.Duration(task.Files)
+	tags["written"] = strconv.FormatInt(written, 10)
+	tags["read"] = strconv.FormatInt(read, 10)
+	tags["write_throughput"] = throughput(written, phases.write+phases.sync)
+	tags["read_throughput"] = throughput(read, phases.read)
+	tags["write_latency"] = strconv.FormatInt((phases.write / files).Microseconds(), 10)
+	tags["fsync_latency"] = strconv.FormatInt((phases.sync / files).Microseconds(), 10)
+	tags["read_latency"] = strconv.FormatInt((phases.read / files).Microseconds(), 10)
+	tags["delete_latency"] = strconv.FormatInt((phases.remove / files).Microseconds(), 10)
+	return tags, nil
+}
+
+func writeFile(name string, block []byte, size int64, phases *diskPhases) (int64, error) {
+	start := time.Now()
+	file, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	written := int64(0)
+	for written < size {
+		chunk := block
+		if size-written < int64(len(chunk)) {
+			chunk = chunk[:size-written]
+		}
+		n, err := file.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	phases.write += time.Since(start)
+
+	start = time.Now()
+	err = file.Sync()
+	phases.sync += time.Since(start)
+	return written, err
+}
+
+func readFile(name string, buffer []byte) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	read := int64(0)
+	for {
+		n, err := file.Read(buffer)
+		read += int64(n)
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+func throughput(bytes int64, duration time.Duration) string {
+	if duration <= 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(bytes)/duration.Seconds(), 'f', 0, 64)
+}
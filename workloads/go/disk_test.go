@@ -0,0 +1,28 @@
+package bencher
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	//the file size is no multiple of the block size
+	tags, err := Disk(&DiskTask{Files: 3, FileSize: 10000, BlockSize: 4096, Dir: dir}, seeded())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags["job"] != "disk" || tags["written"] != "30000" || tags["read"] != "30000" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	for _, tag := range []string{"write_throughput", "read_throughput", "write_latency", "fsync_latency", "read_latency", "delete_latency"} {
+		if _, ok := tags[tag]; !ok {
+			t.Errorf("missing %s in %v", tag, tags)
+		}
+	}
+
+	//the files are removed again
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+		t.Errorf("the job left %d entries behind: %v", len(entries), err)
+	}
+}
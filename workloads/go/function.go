@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -13,63 +12,137 @@ import (
 	"github.com/faas-facts/fact/fact"
 	log "github.com/sirupsen/logrus"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-
 	factc "github.com/faas-facts/fact-go-client"
 )
 
 var contentType = "application/octet-stream"
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
+// SchemaVersion is the newest job schema this bencher understands, the driver sends it with every job
+const SchemaVersion = 2
 
 func Handle(client *factc.FactClient, job Job, context interface{}) fact.Trace {
 	client.Start(context, nil)
+
+	//sampling the resources adds to the execution latency, so only jobs that ask for it do
+	var start resources
+	if job.Usage {
+		start = readResources()
+	}
+	tags, err := Execute(job)
+	if job.Usage {
+		for k, v := range resourceTags(start, readResources()) {
+			tags[k] = v
+		}
+	}
+	if err != nil {
+		msg := err.Error()
+		client.Update(context, &msg, tags)
+	} else {
+		client.Update(context, nil, tags)
+	}
+
+	return client.Done(context, nil)
+}
+
+// Execute runs the job without any tracing and returns the tags describing the result.
+func Execute(job Job) (map[string]string, error) {
+	if job.Version > SchemaVersion {
+		return map[string]string{}, fmt.Errorf("job schema version %d is newer than the supported %d", job.Version, SchemaVersion)
+	}
+	//every invocation gets its own source of randomness, warm instances may run several at once
+	seed := time.Now().UnixNano()
+	if job.Seed != nil {
+		seed = *job.Seed
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	tags, err := execute(job, rng)
+	if job.Class != "" {
+		tags["class"] = job.Class
+	}
+	if err == nil && len(job.Next) > 0 {
+		var stepTags map[string]string
+		stepTags, err = invokeNext(job.Next)
+		for k, v := range stepTags {
+			tags[k] = v
+		}
+	}
+	return tags, err
+}
+
+func execute(job Job, rng *rand.Rand) (map[string]string, error) {
 	if job.Idle != nil {
-		dur := time.Duration(*job.Idle) * time.Second
+		dur := time.Duration(*job.Idle * float64(time.Second))
 		Idle(&dur)
-		client.Update(context, nil, map[string]string{
+		return map[string]string{
 			"job": "idle",
-		})
+		}, nil
 	} else if job.Prime != nil {
 		Prime(*job.Prime)
-		client.Update(context, nil, map[string]string{
+		return map[string]string{
 			"job": "prime",
-		})
+		}, nil
 	} else if job.Memory != nil {
-		Memory(job.Memory)
-		client.Update(context, nil, map[string]string{
+		Memory(job.Memory, rng)
+		return map[string]string{
 			"job": "memory",
-		})
+		}, nil
 	} else if job.IO != nil {
-		r, w, e, err := IO(job.IO)
-		client.Update(context, nil, map[string]string{
-			"job": "io",
-		})
+		r, w, e, err := IO(job.IO, rng)
+		tags := map[string]string{
+			"job":    "io",
+			"cached": strconv.FormatBool(job.IO.reused),
+		}
 		if err != nil {
-			msg := err.Error()
-			client.Update(context, &msg, map[string]string{})
-		} else {
-			client.Update(context, nil, map[string]string{
-				"read":   strconv.FormatInt(r, 10),
-				"writen": strconv.FormatInt(w, 10),
-				"errors": strconv.FormatInt(int64(e), 10),
-			})
+			return tags, err
+		}
+		tags["read"] = strconv.FormatInt(r, 10)
+		tags["writen"] = strconv.FormatInt(w, 10)
+		tags["errors"] = strconv.FormatInt(int64(e), 10)
+		return tags, nil
+	} else if job.Disk != nil {
+		return Disk(job.Disk, rng)
+	} else if job.Alloc != nil {
+		return Alloc(job.Alloc, rng)
+	} else if job.Net != nil {
+		result, err := Net(job.Net, rng)
+		return result.Tags(), err
+	} else if job.CPU != nil {
+		checksum, err := CPU(job.CPU, rng)
+		tags := map[string]string{
+			"job":      job.CPU.Kernel,
+			"checksum": checksum,
+		}
+		//the python port caps the matrix size, the tag tells which results compare
+		if job.CPU.Kernel == "matrix" {
+			tags["matrix.size"] = strconv.Itoa(job.CPU.Size)
 		}
+		return tags, err
 	}
 
-	return client.Done(context, nil)
+	return map[string]string{}, nil
 }
 
 type Job struct {
+	Version int `json:"version,omitempty"`
+
 	Prime  *uint32     `json:"prime,omitempty"`
 	Memory *MemoryTask `json:"memory,omitempty"`
 	IO     *IOTask     `json:"io,omitempty"`
-	Idle   *int        `json:"idle,omitempty"`
+	Idle   *float64    `json:"idle,omitempty"`
+	CPU    *CPUTask    `json:"cpu,omitempty"`
+	Net    *NetTask    `json:"net,omitempty"`
+	Alloc  *AllocTask  `json:"alloc,omitempty"`
+	Disk   *DiskTask   `json:"disk,omitempty"`
+
+	//seeds the randomness of the job to make invocations reproducible
+	Seed *int64 `json:"seed,omitempty"`
+	//request class of mixed workloads, echoed in the trace tags
+	Class string `json:"class,omitempty"`
+	//downstream functions of a workflow, invoked once the job is done
+	Next []Step `json:"next,omitempty"`
+	//tags the trace with the resource usage of the invocation
+	Usage bool `json:"usage,omitempty"`
 }
 
 type MemoryTask struct {
@@ -78,34 +151,36 @@ type MemoryTask struct {
 	RecursionDepth uint32 `json:"recursion_depth,omitempty"`
 }
 
-func ParallelMemory(task *MemoryTask, processes uint) {
+func ParallelMemory(task *MemoryTask, processes uint, rng *rand.Rand) {
 	if task == nil {
 		return
 	}
 
-	left := generateOperatorArray(task.OperatorSize)
-	right := generateOperatorArray(task.OperatorSize)
+	left := generateOperatorArray(task.OperatorSize, rng)
+	right := generateOperatorArray(task.OperatorSize, rng)
 
 	for p := uint(0); p < processes; p++ {
+		//a rand.Rand is not safe for concurrent use, each process derives its own
+		processRng := rand.New(rand.NewSource(rng.Int63()))
 		go func() {
 			for i := uint32(0); i < task.Iteration/uint32(processes); i++ {
-				compute(0, task.RecursionDepth, left, right)
+				compute(0, task.RecursionDepth, left, right, processRng)
 			}
 		}()
 	}
 
 }
 
-func Memory(task *MemoryTask) {
+func Memory(task *MemoryTask, rng *rand.Rand) {
 	if task == nil {
 		return
 	}
 
-	left := generateOperatorArray(task.OperatorSize)
-	right := generateOperatorArray(task.OperatorSize)
+	left := generateOperatorArray(task.OperatorSize, rng)
+	right := generateOperatorArray(task.OperatorSize, rng)
 
 	for i := uint32(0); i < task.Iteration; i++ {
-		compute(0, task.RecursionDepth, left, right)
+		compute(0, task.RecursionDepth, left, right, rng)
 
 		if i%100 == 0 {
 			//increase allocations per 100 itterations
@@ -118,28 +193,28 @@ func Memory(task *MemoryTask) {
 
 }
 
-func generateOperatorArray(size uint32) []float64 {
+func generateOperatorArray(size uint32, rng *rand.Rand) []float64 {
 	data := make([]float64, size)
 	for i := 0; i < len(data); i++ {
-		data[i] = rand.Float64() * float64(rand.Int63())
+		data[i] = rng.Float64() * float64(rng.Int63())
 	}
 	return data
 }
 
-func compute(i, anchor uint32, left, right []float64) {
+func compute(i, anchor uint32, left, right []float64, rng *rand.Rand) {
 	if i < anchor {
-		compute(i+1, anchor, left, right)
+		compute(i+1, anchor, left, right, rng)
 	} else {
-		randomOpt(left, right)
+		randomOpt(left, right, rng)
 	}
 }
 
-func randomOpt(left, right []float64) {
-	a := left[rand.Intn(len(left))]
-	b := right[rand.Intn(len(right))]
+func randomOpt(left, right []float64, rng *rand.Rand) {
+	a := left[rng.Intn(len(left))]
+	b := right[rng.Intn(len(right))]
 
 	var c float64
-	if rand.Float32() < 0.5 {
+	if rng.Float32() < 0.5 {
 		c = a * b
 	} else {
 		if b > 0 {
@@ -149,10 +224,10 @@ func randomOpt(left, right []float64) {
 		}
 	}
 
-	if rand.Float32() < 0.5 {
-		left[rand.Intn(len(left))] = c
+	if rng.Float32() < 0.5 {
+		left[rng.Intn(len(left))] = c
 	} else {
-		right[rand.Intn(len(right))] = c
+		right[rng.Intn(len(right))] = c
 	}
 }
 
@@ -218,13 +293,19 @@ type IOTask struct {
 	Bucket string   `json:"bucket,omitempty"`
 	Keys   []string `json:"keys,omitempty"`
 
+	//one of s3 (default), http, redis or fs
+	Backend string `json:"backend,omitempty"`
+	//disables reusing clients and object metadata across warm invocations
+	NoCache         bool   `json:"no_cache,omitempty"`
 	Endpoint        string `json:"endpoint,omitempty"`
 	AccessKeyID     string `json:"key_id,omitempty"`
 	AccessKeySecret string `json:"key,omitempty"`
 
 	objects map[string]int64
+	//set if the invocation reused a cached client
+	reused bool
 
-	Args map[string]string `json:"-"`
+	Args map[string]string `json:"args,omitempty"`
 }
 
 func getStringFlag(key, defaultValue string, args map[string]string) string {
@@ -243,77 +324,96 @@ func getBoolFlag(key string, args map[string]string) bool {
 	}
 }
 
-func IO(task *IOTask) (int64, int64, int, error) {
+func IO(task *IOTask, rng *rand.Rand) (int64, int64, int, error) {
 	if task == nil {
 		return -1, -1, 1, nil
 	}
+	if task.ChunkSize <= 0 {
+		return -1, -1, 1, fmt.Errorf("chunk size %d is not positive", task.ChunkSize)
+	}
 
-	//1 setup a connection
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region:           aws.String(getStringFlag("region", "auto", task.Args)),
-		Endpoint:         aws.String(task.Endpoint),
-		Credentials:      credentials.NewStaticCredentials(task.AccessKeyID, task.AccessKeySecret, ""),
-		DisableSSL:       aws.Bool(getBoolFlag("DisableSSL", task.Args)),
-		S3ForcePathStyle: aws.Bool(getBoolFlag("S3PathStyle", task.Args)),
-	}))
-
-	client := s3.New(sess)
+	resolveCredentials(task)
 
+	//1 setup a connection, reusing the one of a previous warm invocation if allowed
+	var storage Storage
 	task.objects = make(map[string]int64)
+	if task.NoCache {
+		var err error
+		storage, err = NewStorage(task)
+		if err != nil {
+			log.Errorf("storage setup error %+v", err)
+			return -1, -1, 1, err
+		}
+		if closer, ok := storage.(io.Closer); ok {
+			defer closer.Close()
+		}
+	} else {
+		entry, reused, err := cachedStorageFor(task)
+		if err != nil {
+			log.Errorf("storage setup error %+v", err)
+			return -1, -1, 1, err
+		}
+		storage = entry.storage
+		task.objects = entry.sizes()
+		task.reused = reused
+		defer func() {
+			for key, size := range task.objects {
+				entry.remember(key, size)
+			}
+		}()
+	}
+
 	for _, key := range task.Keys {
-		head := s3.HeadObjectInput{
-			Bucket: &task.Bucket,
-			Key:    &key,
+		if _, ok := task.objects[key]; ok {
+			continue
 		}
-		object, err := client.HeadObject(&head)
+		size, err := storage.Size(key)
 		if err != nil {
-			log.Errorf("head %s error %f", key, err)
+			log.Errorf("head %s error %+v", key, err)
+			if !task.NoCache {
+				evictStorage(task)
+			}
 			return -1, -1, 1, err
 		}
-		task.objects[key] = *object.ContentLength
+		task.objects[key] = size
+	}
+
+	//a broken connection must not be handed to the next invocation
+	evicted := task.NoCache
+	failed := func(err error) {
+		if !evicted && connectionError(err) {
+			evictStorage(task)
+			evicted = true
+		}
 	}
 
 	reads := int64(0)
 	writes := int64(0)
 	errors := 0
 	for i := 0; i < task.Iteration; i++ {
-		if rand.Float32() < task.ReadWrite {
-			key := task.Keys[rand.Intn(len(task.Keys))]
-			start := rand.Int63n(task.objects[key] - task.ChunkSize)
-			rangeString := fmt.Sprintf("%d-%d", start, start+task.ChunkSize)
-			get := s3.GetObjectInput{
-				Bucket: &task.Bucket,
-				Key:    &key,
-				Range:  &rangeString,
+		if rng.Float32() < task.ReadWrite {
+			key := task.Keys[rng.Intn(len(task.Keys))]
+			//objects no larger than a chunk are read whole
+			start, length := int64(0), task.ChunkSize
+			if span := task.objects[key] - task.ChunkSize; span > 0 {
+				start = rng.Int63n(span)
+			} else {
+				length = task.objects[key]
 			}
-			object, err := client.GetObject(&get)
+			read, err := storage.Read(key, start, length)
 			if err != nil {
 				errors++
-				log.Errorf("read error %f", err)
-			} else {
-				//actually consume the body...
-				written, err := io.Copy(ioutil.Discard, object.Body)
-				if err != nil {
-					errors++
-					log.Errorf("read error %f", err)
-				}
-				reads += written
+				log.Errorf("read error %+v", err)
+				failed(err)
 			}
-			//read
+			reads += read
 		} else {
 			key := fmt.Sprintf("generated_%d.bin", i)
-			body := randomBytes(task.ChunkSize)
-			put := s3.PutObjectInput{
-				Body:          body,
-				Bucket:        &task.Bucket,
-				ContentLength: &task.ChunkSize,
-				ContentType:   &contentType,
-				Key:           &key,
-			}
-			_, err := client.PutObject(&put)
+			err := storage.Write(key, randomBytes(task.ChunkSize, rng), task.ChunkSize)
 			if err != nil {
 				errors++
-				log.Errorf("write error %f", err)
+				log.Errorf("write error %+v", err)
+				failed(err)
 			} else {
 				writes += task.ChunkSize
 			}
@@ -322,9 +422,9 @@ func IO(task *IOTask) (int64, int64, int, error) {
 	return reads, writes, errors, nil
 }
 
-func randomBytes(chucksize int64) io.ReadSeeker {
+func randomBytes(chucksize int64, rng *rand.Rand) io.ReadSeeker {
 	data := make([]byte, chucksize)
-	n, err := rand.Read(data)
+	n, err := rng.Read(data)
 	if err != nil || int64(n) < chucksize {
 		log.Print("failed to generate random bytes")
 	}
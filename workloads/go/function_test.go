@@ -0,0 +1,33 @@
+package bencher
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExecuteSeed(t *testing.T) {
+	seed := int64(42)
+	job := Job{CPU: &CPUTask{Kernel: "sha256", Size: 1024, Iteration: 10}, Seed: &seed}
+
+	//concurrent invocations with the same seed produce the same result
+	checksums := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range checksums {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tags, err := Execute(job)
+			if err != nil {
+				t.Error(err)
+			}
+			checksums[i] = tags["checksum"]
+		}(i)
+	}
+	wg.Wait()
+
+	for _, checksum := range checksums[1:] {
+		if checksum == "" || checksum != checksums[0] {
+			t.Fatalf("expected the same checksum for the same seed, got %v", checksums)
+		}
+	}
+}
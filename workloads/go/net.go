@@ -0,0 +1,143 @@
+package bencher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NetTask sends Requests POSTs with PayloadSize bytes to Target using Concurrency parallel clients.
+type NetTask struct {
+	Target      string `json:"target"`
+	Requests    int    `json:"requests,omitempty"`
+	PayloadSize int64  `json:"size,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+	KeepAlive   bool   `json:"keep_alive,omitempty"`
+}
+
+// NetResult summarizes the requests of a net job, latencies are measured per request.
+type NetResult struct {
+	Requests int
+	Errors   int
+	Sent     int64
+	Received int64
+	Duration time.Duration
+
+	latencies []time.Duration
+}
+
+// Percentile returns the p-th (0-100) percentile of the request latencies.
+func (r NetResult) Percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(r.latencies, func(i, j int) bool {
+		return r.latencies[i] < r.latencies[j]
+	})
+	index := int(float64(len(r.latencies)-1) * p / 100)
+	return r.latencies[index]
+}
+
+func (r NetResult) Tags() map[string]string {
+	throughput := 0.0
+	if r.Duration > 0 {
+		throughput = float64(r.Sent+r.Received) / r.Duration.Seconds()
+	}
+	return map[string]string{
+		"job":        "net",
+		"requests":   strconv.Itoa(r.Requests),
+		"errors":     strconv.Itoa(r.Errors),
+		"sent":       strconv.FormatInt(r.Sent, 10),
+		"received":   strconv.FormatInt(r.Received, 10),
+		"throughput": strconv.FormatFloat(throughput, 'f', 0, 64),
+		"p50":        strconv.FormatInt(r.Percentile(50).Microseconds(), 10),
+		"p99":        strconv.FormatInt(r.Percentile(99).Microseconds(), 10),
+	}
+}
+
+// Net runs the requests of the task, failed requests are counted and don't stop the job.
+func Net(task *NetTask, rng *rand.Rand) (NetResult, error) {
+	result := NetResult{}
+	if task == nil {
+		return result, nil
+	}
+	if task.Target == "" {
+		return result, fmt.Errorf("net job without target")
+	}
+
+	concurrency := task.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	client := &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			DisableKeepAlives:   !task.KeepAlive,
+			MaxIdleConnsPerHost: concurrency,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	payload := make([]byte, task.PayloadSize)
+	rng.Read(payload)
+
+	requests := make(chan struct{}, task.Requests)
+	for i := 0; i < task.Requests; i++ {
+		requests <- struct{}{}
+	}
+	close(requests)
+
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for c := 0; c < concurrency; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range requests {
+				latency, received, err := send(client, task.Target, payload)
+
+				lock.Lock()
+				result.Requests++
+				if err != nil {
+					result.Errors++
+				} else {
+					result.Sent += int64(len(payload))
+					result.Received += received
+					result.latencies = append(result.latencies, latency)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+func send(client *http.Client, target string, payload []byte) (time.Duration, int64, error) {
+	start := time.Now()
+	resp, err := client.Post(target, contentType, bytes.NewReader(payload))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	//the body has to be drained to reuse the connection
+	received, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return 0, received, err
+	}
+	if resp.StatusCode >= 300 {
+		return 0, received, fmt.Errorf("%s responded with %s", target, resp.Status)
+	}
+	return time.Since(start), received, nil
+}
@@ -0,0 +1,481 @@
+package bencher
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Storage is the state store the IO job reads from and writes to.
+// All backends follow the same access pattern so results are comparable across stores.
+type Storage interface {
+	//Size returns the length of the object stored under key
+	Size(key string) (int64, error)
+	//Read consumes length bytes starting at offset and returns the number of bytes read
+	Read(key string, offset, length int64) (int64, error)
+	//Write stores length bytes from body under key
+	Write(key string, body io.ReadSeeker, length int64) error
+}
+
+// resolveCredentials falls back to the credentials SET hands to the function at deployment time,
+// so they don't have to be part of every payload.
+func resolveCredentials(task *IOTask) {
+	if task.AccessKeyID == "" && task.AccessKeySecret == "" {
+		task.AccessKeyID = os.Getenv("SET_IO_KEY_ID")
+		task.AccessKeySecret = os.Getenv("SET_IO_SECRET")
+	}
+}
+
+// NewStorage connects to the backend selected by task.Backend, defaulting to s3.
+func NewStorage(task *IOTask) (Storage, error) {
+	switch strings.ToLower(task.Backend) {
+	case "", "s3":
+		return newS3Storage(task), nil
+	case "http":
+		return newHTTPStorage(task)
+	case "redis":
+		return newRedisStorage(task)
+	case "fs":
+		return newFSStorage(task)
+	}
+	return nil, fmt.Errorf("unknown storage backend %s", task.Backend)
+}
+
+// cachedStorage keeps a connected backend and the sizes of the objects we already looked up.
+// Warm instances may run several invocations at once, the sizes are only accessed through sizes and remember.
+type cachedStorage struct {
+	storage Storage
+
+	lock    sync.Mutex
+	objects map[string]int64
+}
+
+// sizes returns a copy of the known object sizes, owned by the calling invocation
+func (c *cachedStorage) sizes() map[string]int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	objects := make(map[string]int64, len(c.objects))
+	for k, v := range c.objects {
+		objects[k] = v
+	}
+	return objects
+}
+
+func (c *cachedStorage) remember(key string, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.objects[key] = size
+}
+
+// storageCache survives warm invocations, like a real application would keep its clients around.
+var storageCache = struct {
+	sync.Mutex
+	entries map[string]*cachedStorage
+}{entries: make(map[string]*cachedStorage)}
+
+// storageCacheKey identifies a backend by endpoint and credentials, the secret is only kept as a hash.
+func storageCacheKey(task *IOTask) string {
+	secret := sha256.Sum256([]byte(task.AccessKeySecret))
+
+	args := make([]string, 0, len(task.Args))
+	for k, v := range task.Args {
+		args = append(args, k+"="+v)
+	}
+	sort.Strings(args)
+
+	return strings.Join([]string{
+		strings.ToLower(task.Backend),
+		task.Endpoint,
+		task.Bucket,
+		task.AccessKeyID,
+		hex.EncodeToString(secret[:]),
+		strings.Join(args, ","),
+	}, "|")
+}
+
+// cachedStorageFor returns a cached backend for the task, creating and caching one if needed.
+// The second return value reports whether an existing client was reused.
+func cachedStorageFor(task *IOTask) (*cachedStorage, bool, error) {
+	key := storageCacheKey(task)
+
+	storageCache.Lock()
+	defer storageCache.Unlock()
+	if entry, ok := storageCache.entries[key]; ok {
+		return entry, true, nil
+	}
+
+	storage, err := NewStorage(task)
+	if err != nil {
+		return nil, false, err
+	}
+	entry := &cachedStorage{
+		storage: storage,
+		objects: make(map[string]int64),
+	}
+	storageCache.entries[key] = entry
+	return entry, false, nil
+}
+
+// connectionError reports if err means the connection of a backend broke, so it must not be reused
+func connectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	//net.ErrClosed needs go 1.16, OpenWhisk and the container image still build with go 1.15
+	return err != nil && strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// evictStorage drops a cached backend, e.g. after its connection broke.
+func evictStorage(task *IOTask) {
+	key := storageCacheKey(task)
+
+	storageCache.Lock()
+	defer storageCache.Unlock()
+	if entry, ok := storageCache.entries[key]; ok {
+		if closer, ok := entry.storage.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		delete(storageCache.entries, key)
+	}
+}
+
+type s3Storage struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3Storage(task *IOTask) *s3Storage {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String(getStringFlag("region", "auto", task.Args)),
+		Endpoint:         aws.String(task.Endpoint),
+		Credentials:      credentials.NewStaticCredentials(task.AccessKeyID, task.AccessKeySecret, ""),
+		DisableSSL:       aws.Bool(getBoolFlag("DisableSSL", task.Args)),
+		S3ForcePathStyle: aws.Bool(getBoolFlag("S3PathStyle", task.Args)),
+	}))
+
+	return &s3Storage{
+		client: s3.New(sess),
+		bucket: task.Bucket,
+	}
+}
+
+func (s *s3Storage) Size(key string) (int64, error) {
+	object, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return -1, err
+	}
+	return *object.ContentLength, nil
+}
+
+func (s *s3Storage) Read(key string, offset, length int64) (int64, error) {
+	rangeString := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+		Range:  &rangeString,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer object.Body.Close()
+	//actually consume the body...
+	return io.Copy(ioutil.Discard, object.Body)
+}
+
+func (s *s3Storage) Write(key string, body io.ReadSeeker, length int64) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Body:          body,
+		Bucket:        &s.bucket,
+		ContentLength: &length,
+		ContentType:   &contentType,
+		Key:           &key,
+	})
+	return err
+}
+
+// httpStorage talks to a generic blob store that maps HEAD/GET/PUT on <endpoint>/<bucket>/<key> to objects.
+type httpStorage struct {
+	client *http.Client
+	base   string
+	token  string
+}
+
+func newHTTPStorage(task *IOTask) (*httpStorage, error) {
+	if task.Endpoint == "" {
+		return nil, fmt.Errorf("http storage needs an endpoint")
+	}
+	base := strings.TrimSuffix(task.Endpoint, "/")
+	if task.Bucket != "" {
+		base = base + "/" + task.Bucket
+	}
+	return &httpStorage{
+		client: &http.Client{Timeout: 5 * time.Minute},
+		base:   base,
+		token:  task.AccessKeySecret,
+	}, nil
+}
+
+func (s *httpStorage) do(method, key string, body io.Reader, length int64, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.base+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = length
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s failed with %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *httpStorage) Size(key string) (int64, error) {
+	resp, err := s.do(http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return -1, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (s *httpStorage) Read(key string, offset, length int64) (int64, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, map[string]string{
+		"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(ioutil.Discard, resp.Body)
+}
+
+func (s *httpStorage) Write(key string, body io.ReadSeeker, length int64) error {
+	resp, err := s.do(http.MethodPut, key, body, length, nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// redisStorage stores objects as strings in a Redis-compatible key-value store, keys are prefixed with the bucket.
+// We only speak the handful of RESP commands we need to avoid pulling a client library into every function.
+// The connection is shared by the invocations of a warm instance, so commands are serialized.
+type redisStorage struct {
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	prefix string
+}
+
+func newRedisStorage(task *IOTask) (*redisStorage, error) {
+	address := strings.TrimPrefix(task.Endpoint, "redis://")
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &redisStorage{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if task.Bucket != "" {
+		s.prefix = task.Bucket + "/"
+	}
+
+	if task.AccessKeySecret != "" {
+		args := []string{"AUTH", task.AccessKeySecret}
+		if task.AccessKeyID != "" {
+			args = []string{"AUTH", task.AccessKeyID, task.AccessKeySecret}
+		}
+		if _, err := s.command(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db := getStringFlag("db", "", task.Args); db != "" {
+		if _, err := s.command("SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *redisStorage) Close() error {
+	return s.conn.Close()
+}
+
+func (s *redisStorage) command(args ...string) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writer := bufio.NewWriter(s.conn)
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return s.reply()
+}
+
+func (s *redisStorage) reply() (interface{}, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:length], nil
+	}
+	return nil, fmt.Errorf("unexpected redis reply %s", line)
+}
+
+func (s *redisStorage) Size(key string) (int64, error) {
+	reply, err := s.command("STRLEN", s.prefix+key)
+	if err != nil {
+		return -1, err
+	}
+	size, ok := reply.(int64)
+	if !ok || size == 0 {
+		return -1, fmt.Errorf("%s does not exist", key)
+	}
+	return size, nil
+}
+
+func (s *redisStorage) Read(key string, offset, length int64) (int64, error) {
+	reply, err := s.command("GETRANGE", s.prefix+key,
+		strconv.FormatInt(offset, 10), strconv.FormatInt(offset+length-1, 10))
+	if err != nil {
+		return 0, err
+	}
+	data, _ := reply.([]byte)
+	return int64(len(data)), nil
+}
+
+func (s *redisStorage) Write(key string, body io.ReadSeeker, length int64) error {
+	data, err := ioutil.ReadAll(io.LimitReader(body, length))
+	if err != nil {
+		return err
+	}
+	_, err = s.command("SET", s.prefix+key, string(data))
+	return err
+}
+
+// fsStorage uses the local (ephemeral) filesystem of the function, by default the temp directory.
+// Since the driver cannot upload into the function sandbox, missing objects are generated on first access.
+type fsStorage struct {
+	dir        string
+	objectSize int64
+}
+
+func newFSStorage(task *IOTask) (*fsStorage, error) {
+	dir := task.Endpoint
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, task.Bucket)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	objectSize, _ := strconv.ParseInt(getStringFlag("objectSize", "0", task.Args), 10, 64)
+	return &fsStorage{
+		dir:        dir,
+		objectSize: objectSize,
+	}, nil
+}
+
+func (s *fsStorage) Size(key string) (int64, error) {
+	path := filepath.Join(s.dir, key)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && s.objectSize > 0 {
+		//the backend is shared by concurrent invocations, generating objects uses a source of its own
+		content := randomBytes(s.objectSize, rand.New(rand.NewSource(time.Now().UnixNano())))
+		if err := s.Write(key, content, s.objectSize); err != nil {
+			return -1, err
+		}
+		return s.objectSize, nil
+	} else if err != nil {
+		return -1, err
+	}
+	return info.Size(), nil
+}
+
+func (s *fsStorage) Read(key string, offset, length int64) (int64, error) {
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(ioutil.Discard, io.NewSectionReader(f, offset, length))
+}
+
+func (s *fsStorage) Write(key string, body io.ReadSeeker, length int64) error {
+	f, err := os.Create(filepath.Join(s.dir, key))
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(f, body, length)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
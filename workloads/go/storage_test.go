@@ -0,0 +1,95 @@
+package bencher
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestIOConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	task := func() *IOTask {
+		return &IOTask{
+			Iteration: 20,
+			ReadWrite: 0.5,
+			ChunkSize: 64,
+			Bucket:    "concurrent",
+			Keys:      []string{"a.bin", "b.bin"},
+			Backend:   "fs",
+			Endpoint:  dir,
+			Args:      map[string]string{"objectSize": "1024"},
+		}
+	}
+	defer evictStorage(task())
+
+	//warm invocations share the cached backend and the sizes it looked up
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, errors, err := IO(task(), rand.New(rand.NewSource(1))); err != nil || errors > 0 {
+				t.Errorf("io failed with %d errors: %v", errors, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entry, reused, err := cachedStorageFor(task())
+	if err != nil || !reused {
+		t.Fatalf("expected a cached backend, got %v", err)
+	}
+	if sizes := entry.sizes(); sizes["a.bin"] != 1024 || sizes["b.bin"] != 1024 {
+		t.Errorf("unexpected object sizes %v", sizes)
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	//a connection closed by the storage itself has to be evicted like a broken one
+	if _, err := conn.Write([]byte("PING\r\n")); !connectionError(err) {
+		t.Errorf("%v is no connection error", err)
+	}
+	if connectionError(errors.New("NoSuchKey")) || connectionError(nil) {
+		t.Error("an error of the backend was taken for a connection error")
+	}
+}
+
+func TestIOChunkSize(t *testing.T) {
+	dir := t.TempDir()
+	for _, chunk := range []int64{64, 128} {
+		task := &IOTask{
+			Iteration: 10,
+			ReadWrite: 1,
+			ChunkSize: chunk,
+			Bucket:    "chunks",
+			Keys:      []string{"a.bin"},
+			Backend:   "fs",
+			Endpoint:  dir,
+			Args:      map[string]string{"objectSize": "64"},
+			NoCache:   true,
+		}
+		//chunks that don't fit into the object read all of it
+		reads, _, errors, err := IO(task, rand.New(rand.NewSource(1)))
+		if err != nil || errors > 0 || reads != 10*64 {
+			t.Errorf("chunks of %d read %d bytes with %d errors: %v", chunk, reads, errors, err)
+		}
+	}
+
+	task := &IOTask{Iteration: 1, Keys: []string{"a.bin"}, Backend: "fs", Endpoint: dir, NoCache: true}
+	if _, _, _, err := IO(task, rand.New(rand.NewSource(1))); err == nil {
+		t.Error("io without a chunk size was run")
+	}
+}
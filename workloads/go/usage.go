@@ -0,0 +1,112 @@
+package bencher
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usage is a snapshot of the resource usage of the function process
+type usage struct {
+	UserCPU time.Duration
+	SysCPU  time.Duration
+	//peak resident set size in bytes
+	MaxRSS      int64
+	MinorFaults int64
+	MajorFaults int64
+}
+
+// resources combines the process usage with the go runtime state at one point of an invocation
+type resources struct {
+	usage
+	RSS        int64
+	Heap       uint64
+	NumGC      uint32
+	PauseTotal time.Duration
+	Goroutines int
+}
+
+func readResources() resources {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return resources{
+		usage:      readUsage(),
+		RSS:        currentRSS(),
+		Heap:       stats.HeapAlloc,
+		NumGC:      stats.NumGC,
+		PauseTotal: time.Duration(stats.PauseTotalNs),
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// resourceTags describes what the invocation used between start and end and what the platform granted.
+// Counters are reported as the difference, gauges at both ends.
+func resourceTags(start, end resources) map[string]string {
+	tags := map[string]string{
+		"usage.cpu_user_ms":      strconv.FormatInt((end.UserCPU - start.UserCPU).Milliseconds(), 10),
+		"usage.cpu_sys_ms":       strconv.FormatInt((end.SysCPU - start.SysCPU).Milliseconds(), 10),
+		"usage.minor_faults":     strconv.FormatInt(end.MinorFaults-start.MinorFaults, 10),
+		"usage.major_faults":     strconv.FormatInt(end.MajorFaults-start.MajorFaults, 10),
+		"usage.gc":               strconv.FormatUint(uint64(end.NumGC-start.NumGC), 10),
+		"usage.gc_pause_us":      strconv.FormatInt((end.PauseTotal - start.PauseTotal).Microseconds(), 10),
+		"usage.max_rss":          strconv.FormatInt(end.MaxRSS, 10),
+		"usage.rss.start":        strconv.FormatInt(start.RSS, 10),
+		"usage.rss.end":          strconv.FormatInt(end.RSS, 10),
+		"usage.heap.start":       strconv.FormatUint(start.Heap, 10),
+		"usage.heap.end":         strconv.FormatUint(end.Heap, 10),
+		"usage.goroutines.start": strconv.Itoa(start.Goroutines),
+		"usage.goroutines.end":   strconv.Itoa(end.Goroutines),
+		"usage.num_cpu":          strconv.Itoa(runtime.NumCPU()),
+		"usage.gomaxprocs":       strconv.Itoa(runtime.GOMAXPROCS(0)),
+	}
+	if limit := cgroupMemoryLimit(); limit != "" {
+		tags["usage.cgroup_memory"] = limit
+	}
+	if quota := cgroupCPUQuota(); quota != "" {
+		tags["usage.cgroup_cpu"] = quota
+	}
+	return tags
+}
+
+// cgroupMemoryLimit returns the memory limit in bytes (or max) of cgroup v2 or v1, empty if there is none
+func cgroupMemoryLimit() string {
+	if limit := readCgroupFile("/sys/fs/cgroup/memory.max"); limit != "" {
+		return limit
+	}
+	return readCgroupFile("/sys/fs/cgroup/memory/memory.limit_in_bytes")
+}
+
+// cgroupCPUQuota returns the cpu quota as fraction of cpus (or max) of cgroup v2 or v1, empty if there is none
+func cgroupCPUQuota() string {
+	quota, period := "", ""
+	if max := readCgroupFile("/sys/fs/cgroup/cpu.max"); max != "" {
+		fields := strings.Fields(max)
+		quota = fields[0]
+		if len(fields) > 1 {
+			period = fields[1]
+		}
+	} else {
+		quota = readCgroupFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+		period = readCgroupFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	}
+
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q < 0 {
+		return quota
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return quota
+	}
+	return strconv.FormatFloat(q/p, 'f', 2, 64)
+}
+
+func readCgroupFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
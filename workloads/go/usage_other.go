@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!illumos,!linux,!netbsd,!openbsd,!solaris
+
+package bencher
+
+func readUsage() usage {
+	return usage{}
+}
+
+func currentRSS() int64 {
+	return 0
+}
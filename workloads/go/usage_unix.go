@@ -0,0 +1,53 @@
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd illumos linux netbsd openbsd solaris
+
+//the GOOS list stands in for the unix constraint of go 1.19, OpenWhisk still compiles the action with go 1.15
+
+package bencher
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func readUsage() usage {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return usage{}
+	}
+
+	maxRSS := int64(ru.Maxrss)
+	//linux reports KiB, darwin bytes
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024
+	}
+	return usage{
+		UserCPU:     time.Duration(ru.Utime.Nano()),
+		SysCPU:      time.Duration(ru.Stime.Nano()),
+		MaxRSS:      maxRSS,
+		MinorFaults: int64(ru.Minflt),
+		MajorFaults: int64(ru.Majflt),
+	}
+}
+
+// currentRSS returns the resident set size in bytes, or 0 if /proc is not available
+func currentRSS() int64 {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
@@ -0,0 +1,110 @@
+package bencher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is a downstream function of a workflow, the function invokes it after its own job is done.
+// Steps carry their own Next steps, so chains are nested steps and fan-outs are several steps at once.
+type Step struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Job    Job    `json:"job"`
+}
+
+var stepClient = &http.Client{Timeout: 15 * time.Minute}
+
+// downstreamTrace is the part of the returned trace we need to record the step
+type downstreamTrace struct {
+	Tags             map[string]string `json:"Tags"`
+	ExecutionLatency *struct {
+		Seconds int64 `json:"seconds"`
+		Nanos   int32 `json:"nanos"`
+	} `json:"ExecutionLatency"`
+}
+
+// invokeNext calls all steps in parallel and waits for them (fan-in).
+// It returns the latency tags of every step, including the ones reported by the downstream functions.
+func invokeNext(steps []Step) (map[string]string, error) {
+	tags := make(map[string]string)
+	lock := sync.Mutex{}
+	errs := make([]error, len(steps))
+
+	wg := sync.WaitGroup{}
+	for i := range steps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stepTags, err := invokeStep(steps[i])
+			errs[i] = err
+
+			lock.Lock()
+			defer lock.Unlock()
+			for k, v := range stepTags {
+				tags[k] = v
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return tags, err
+		}
+	}
+	return tags, nil
+}
+
+func invokeStep(step Step) (map[string]string, error) {
+	prefix := "step." + step.Name + "."
+	tags := make(map[string]string)
+
+	payload, err := json.Marshal(step.Job)
+	if err != nil {
+		return tags, err
+	}
+
+	start := time.Now()
+	resp, err := stepClient.Post(step.Target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		tags[prefix+"error"] = err.Error()
+		return tags, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	tags[prefix+"latency"] = strconv.FormatInt(time.Since(start).Milliseconds(), 10)
+	if err != nil {
+		tags[prefix+"error"] = err.Error()
+		return tags, err
+	}
+	if resp.StatusCode >= 300 {
+		err = fmt.Errorf("step %s failed with %s", step.Name, resp.Status)
+		tags[prefix+"error"] = err.Error()
+		return tags, err
+	}
+
+	var trace downstreamTrace
+	if err := json.Unmarshal(body, &trace); err != nil {
+		//the step ran, we just can't tell how long it took itself
+		return tags, nil
+	}
+	if trace.ExecutionLatency != nil {
+		execution := time.Duration(trace.ExecutionLatency.Seconds)*time.Second + time.Duration(trace.ExecutionLatency.Nanos)
+		tags[prefix+"execution"] = strconv.FormatInt(execution.Milliseconds(), 10)
+	}
+	//propagate the steps further down the workflow
+	for k, v := range trace.Tags {
+		if strings.HasPrefix(k, "step.") {
+			tags[k] = v
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,1230 @@
+package bencher;
+
+import com.google.gson.Gson;
+import com.google.gson.JsonArray;
+import com.google.gson.JsonElement;
+import com.google.gson.JsonObject;
+import com.google.gson.JsonParser;
+
+import java.io.ByteArrayInputStream;
+import java.io.ByteArrayOutputStream;
+import java.io.File;
+import java.io.FileInputStream;
+import java.io.FileOutputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.InputStreamReader;
+import java.io.OutputStream;
+import java.io.PrintStream;
+import java.io.RandomAccessFile;
+import java.lang.management.GarbageCollectorMXBean;
+import java.lang.management.ManagementFactory;
+import java.math.BigInteger;
+import java.net.HttpURLConnection;
+import java.net.InetAddress;
+import java.net.Socket;
+import java.net.URI;
+import java.net.URL;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.Paths;
+import java.security.MessageDigest;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.List;
+import java.util.Map;
+import java.util.Random;
+import java.util.TreeMap;
+import java.util.UUID;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.concurrent.Future;
+import java.util.stream.Stream;
+import java.util.zip.GZIPInputStream;
+import java.util.zip.GZIPOutputStream;
+
+import software.amazon.awssdk.auth.credentials.AwsBasicCredentials;
+import software.amazon.awssdk.auth.credentials.StaticCredentialsProvider;
+import software.amazon.awssdk.core.sync.RequestBody;
+import software.amazon.awssdk.regions.Region;
+import software.amazon.awssdk.services.s3.S3Client;
+import software.amazon.awssdk.services.s3.S3ClientBuilder;
+
+/**
+ * Java port of the Go bencher, jobs follow the same schema (see set/types.go) and report the same tags.
+ */
+public final class Bencher {
+
+    /** Version of the job schema generated by the driver. */
+    public static final int SCHEMA_VERSION = 2;
+
+    private static final Gson gson = new Gson();
+
+    //source of all job randomness, execute replaces it for every job, seeded if the payload carries a seed
+    private static Random random = new Random();
+
+    //the alloc job parks its buffer here, so the jit can't drop it before it is measured
+    private static volatile Object retained;
+
+    //the class is loaded once per container, so the id and boot time tell cold from warm starts
+    private static final String CONTAINER_ID = UUID.randomUUID().toString();
+    private static final long BOOT_TIME = ManagementFactory.getRuntimeMXBean().getStartTime();
+
+    private Bencher() {
+    }
+
+    /**
+     * Executes a job read from stdin without tracing and prints the result tags as json.
+     * Used by the conformance tests of the driver to compare the java and go workloads.
+     */
+    public static void main(String[] args) throws IOException {
+        JsonObject job = JsonParser.parseReader(new InputStreamReader(System.in, StandardCharsets.UTF_8))
+                .getAsJsonObject();
+        //keep stdout clean for the result, the workloads log their errors
+        PrintStream out = System.out;
+        System.setOut(System.err);
+        try {
+            out.print(gson.toJson(execute(job)));
+        } catch (Exception e) {
+            out.print(gson.toJson(Collections.singletonMap("error", String.valueOf(e.getMessage()))));
+            out.flush();
+            System.exit(1);
+        }
+        out.flush();
+    }
+
+    /**
+     * Runs the job and returns a trace shaped like the ones of the fact clients.
+     */
+    public static JsonObject handle(JsonObject job) {
+        //sampling the resources adds to the execution latency, so only jobs that ask for it do
+        boolean usage = has(job, "usage") && job.get("usage").getAsBoolean();
+        Resources start = usage ? Resources.read() : null;
+        long startTime = System.nanoTime();
+
+        JsonObject trace = new JsonObject();
+        trace.addProperty("ContainerID", CONTAINER_ID);
+        trace.addProperty("HostID", hostname());
+        trace.add("BootTime", timestamp(BOOT_TIME));
+        trace.add("StartTime", timestamp(System.currentTimeMillis()));
+        trace.addProperty("Platform", platform());
+        trace.addProperty("Runtime", "java " + System.getProperty("java.version"));
+        Map<String, String> tags;
+        try {
+            tags = execute(job);
+        } catch (Exception e) {
+            tags = new TreeMap<>();
+            JsonObject logs = new JsonObject();
+            logs.addProperty("error", String.valueOf(e.getMessage()));
+            trace.add("Logs", logs);
+        }
+        if (usage) {
+            tags.putAll(Resources.tags(start, Resources.read()));
+        }
+        trace.add("Tags", gson.toJsonTree(tags));
+
+        long nanos = System.nanoTime() - startTime;
+        trace.add("EndTime", timestamp(System.currentTimeMillis()));
+        JsonObject latency = new JsonObject();
+        latency.addProperty("seconds", nanos / 1_000_000_000L);
+        latency.addProperty("nanos", nanos % 1_000_000_000L);
+        trace.add("ExecutionLatency", latency);
+        return trace;
+    }
+
+    //milliseconds since the epoch, formatted like the timestamps of the fact traces
+    private static JsonObject timestamp(long millis) {
+        JsonObject timestamp = new JsonObject();
+        timestamp.addProperty("seconds", millis / 1000);
+        timestamp.addProperty("nanos", (millis % 1000) * 1_000_000L);
+        return timestamp;
+    }
+
+    //detects the platform from its environment, like the inspectors of the fact clients
+    private static String platform() {
+        if (System.getenv("AWS_LAMBDA_LOG_STREAM_NAME") != null) {
+            return "AWS";
+        } else if (System.getenv("X_GOOGLE_FUNCTION_NAME") != null) {
+            return "GCF";
+        } else if (System.getenv("WEBSITE_HOSTNAME") != null) {
+            return "ACF";
+        } else if (System.getenv("__OW_ACTION_NAME") != null) {
+            return "OW";
+        }
+        return "UKN";
+    }
+
+    private static String hostname() {
+        try {
+            return InetAddress.getLocalHost().getHostName();
+        } catch (IOException e) {
+            return "";
+        }
+    }
+
+    /**
+     * Runs the job without any tracing and returns the tags describing the result.
+     */
+    public static Map<String, String> execute(JsonObject job) throws Exception {
+        int version = integer(job, "version", 0);
+        if (version > SCHEMA_VERSION) {
+            throw new IllegalArgumentException(String.format(
+                    "job schema version %d is newer than the supported %d", version, SCHEMA_VERSION));
+        }
+        //a warm instance must not repeat the seed of an earlier job
+        random = has(job, "seed") ? new Random(job.get("seed").getAsLong()) : new Random();
+
+        Map<String, String> tags = run(job);
+        if (has(job, "class")) {
+            tags.put("class", job.get("class").getAsString());
+        }
+        if (has(job, "next") && job.getAsJsonArray("next").size() > 0) {
+            tags.putAll(invokeNext(job.getAsJsonArray("next")));
+        }
+        return tags;
+    }
+
+    private static Map<String, String> run(JsonObject job) throws Exception {
+        Map<String, String> tags = new TreeMap<>();
+        if (has(job, "idle")) {
+            Thread.sleep(Math.round(job.get("idle").getAsDouble() * 1000));
+            tags.put("job", "idle");
+        } else if (has(job, "prime")) {
+            prime(job.get("prime").getAsLong());
+            tags.put("job", "prime");
+        } else if (has(job, "memory")) {
+            memory(job.getAsJsonObject("memory"));
+            tags.put("job", "memory");
+        } else if (has(job, "io")) {
+            IOResult result = io(job.getAsJsonObject("io"));
+            tags.put("job", "io");
+            tags.put("cached", String.valueOf(result.cached));
+            tags.put("read", String.valueOf(result.reads));
+            tags.put("writen", String.valueOf(result.writes));
+            tags.put("errors", String.valueOf(result.errors));
+        } else if (has(job, "disk")) {
+            return disk(job.getAsJsonObject("disk"));
+        } else if (has(job, "alloc")) {
+            return alloc(job.getAsJsonObject("alloc"));
+        } else if (has(job, "net")) {
+            return net(job.getAsJsonObject("net"));
+        } else if (has(job, "cpu")) {
+            JsonObject task = job.getAsJsonObject("cpu");
+            String kernel = task.get("kernel").getAsString();
+            tags.put("job", kernel);
+            tags.put("checksum", cpu(kernel, integer(task, "size", 0), integer(task, "itterations", 0)));
+            //the python port caps the matrix size, the tag tells which results compare
+            if (kernel.equals("matrix")) {
+                tags.put("matrix.size", String.valueOf(integer(task, "size", 0)));
+            }
+        }
+        return tags;
+    }
+
+    // Miller Rabin with the bases 2, 7, 61, sufficient for 32 bit numbers
+    static boolean prime(long n) {
+        if (n == 0 || n == 1) {
+            return false;
+        }
+        if (n == 2 || n == 7 || n == 61) {
+            return true;
+        }
+        BigInteger big = BigInteger.valueOf(n);
+        BigInteger last = big.subtract(BigInteger.ONE);
+        long d = n - 1;
+        int s = 0;
+        while ((d & 1) == 0) {
+            d >>= 1;
+            s++;
+        }
+        for (long a : new long[]{2, 7, 61}) {
+            BigInteger x = BigInteger.valueOf(a).modPow(BigInteger.valueOf(d), big);
+            if (x.equals(BigInteger.ONE) || x.equals(last)) {
+                continue;
+            }
+            boolean composite = true;
+            for (int r = 1; r < s; r++) {
+                x = x.multiply(x).mod(big);
+                if (x.equals(BigInteger.ONE)) {
+                    return false;
+                }
+                if (x.equals(last)) {
+                    composite = false;
+                    break;
+                }
+            }
+            if (composite) {
+                return false;
+            }
+        }
+        return true;
+    }
+
+    static void memory(JsonObject task) {
+        int size = integer(task, "operator_size", 0);
+        double[] left = operatorArray(size);
+        double[] right = operatorArray(size);
+        int iterations = integer(task, "itterations", 0);
+        int depth = integer(task, "recursion_depth", 0);
+        for (int i = 0; i < iterations; i++) {
+            compute(0, depth, left, right);
+            if (i % 100 == 0) {
+                //increase allocations per 100 itterations
+                double[] tmp = right.clone();
+                right = left.clone();
+                left = tmp;
+            }
+        }
+    }
+
+    private static double[] operatorArray(int size) {
+        double[] data = new double[size];
+        for (int i = 0; i < size; i++) {
+            data[i] = random.nextDouble() * Long.MAX_VALUE;
+        }
+        return data;
+    }
+
+    private static void compute(int i, int anchor, double[] left, double[] right) {
+        if (i < anchor) {
+            compute(i + 1, anchor, left, right);
+        } else {
+            randomOpt(left, right);
+        }
+    }
+
+    private static void randomOpt(double[] left, double[] right) {
+        if (left.length == 0 || right.length == 0) {
+            return;
+        }
+        double a = left[random.nextInt(left.length)];
+        double b = right[random.nextInt(right.length)];
+        double c = random.nextBoolean() || b <= 0 ? a * b : a / b;
+        if (random.nextBoolean()) {
+            left[random.nextInt(left.length)] = c;
+        } else {
+            right[random.nextInt(right.length)] = c;
+        }
+    }
+
+    private static final String[] words = {"serverless", "function", "cold", "warm", "start", "latency",
+            "memory", "io", "trace", "bench", "phase", "scale"};
+
+    /**
+     * Runs one of the cpu kernels and returns a checksum of the result, size depends on the kernel:
+     * matrix - dimension of the square matrices, sha256/gzip - buffer size in bytes, json - fields per document.
+     */
+    static String cpu(String kernel, int size, int iterations) throws Exception {
+        switch (kernel) {
+            case "matrix":
+                return matrix(size, iterations);
+            case "sha256":
+                return hash(size, iterations);
+            case "gzip":
+                return compress(size, iterations);
+            case "json":
+                return json(size, iterations);
+            default:
+                throw new IllegalArgumentException("unknown cpu kernel " + kernel);
+        }
+    }
+
+    static String matrix(int n, int iterations) {
+        double[] a = randomMatrix(n);
+        double[] b = randomMatrix(n);
+        double[] c = new double[n * n];
+        for (int it = 0; it < iterations; it++) {
+            for (int i = 0; i < n; i++) {
+                for (int j = 0; j < n; j++) {
+                    c[i * n + j] = 0;
+                }
+                for (int k = 0; k < n; k++) {
+                    double aik = a[i * n + k];
+                    for (int j = 0; j < n; j++) {
+                        c[i * n + j] += aik * b[k * n + j];
+                    }
+                }
+            }
+            //feed the result back to avoid multiplying the same operands
+            double[] tmp = a;
+            a = c;
+            c = tmp;
+        }
+        double trace = 0;
+        for (int i = 0; i < n; i++) {
+            trace += a[i * n + i];
+        }
+        return String.valueOf(trace);
+    }
+
+    private static double[] randomMatrix(int n) {
+        double[] m = new double[n * n];
+        for (int i = 0; i < m.length; i++) {
+            m[i] = random.nextDouble();
+        }
+        return m;
+    }
+
+    static String hash(int size, int iterations) throws Exception {
+        byte[] buffer = new byte[size];
+        random.nextBytes(buffer);
+        MessageDigest digest = MessageDigest.getInstance("SHA-256");
+        byte[] sum = digest.digest();
+        for (int i = 0; i < iterations; i++) {
+            System.arraycopy(sum, 0, buffer, 0, Math.min(sum.length, buffer.length));
+            sum = digest.digest(buffer);
+        }
+        return hex(sum);
+    }
+
+    static String compress(int size, int iterations) throws IOException {
+        byte[] buffer = compressibleBytes(size);
+        int compressedSize = 0;
+        for (int i = 0; i < iterations; i++) {
+            ByteArrayOutputStream compressed = new ByteArrayOutputStream();
+            try (GZIPOutputStream writer = new GZIPOutputStream(compressed)) {
+                writer.write(buffer);
+            }
+            compressedSize = compressed.size();
+            try (GZIPInputStream reader = new GZIPInputStream(new ByteArrayInputStream(compressed.toByteArray()))) {
+                byte[] chunk = new byte[32 * 1024];
+                while (reader.read(chunk) >= 0) {
+                    //discard
+                }
+            }
+        }
+        return String.valueOf(compressedSize);
+    }
+
+    //text from a small vocabulary, similar to logs or documents
+    private static byte[] compressibleBytes(int size) {
+        StringBuilder text = new StringBuilder(size + 16);
+        while (text.length() < size) {
+            text.append(words[random.nextInt(words.length)]);
+            if (random.nextInt(8) == 0) {
+                text.append(random.nextLong() & Long.MAX_VALUE);
+            }
+            text.append(' ');
+        }
+        return text.substring(0, size).getBytes(StandardCharsets.UTF_8);
+    }
+
+    static String json(int fields, int iterations) {
+        JsonObject document = new JsonObject();
+        for (int i = 0; i < fields; i++) {
+            String key = words[i % words.length] + "_" + i;
+            switch (i % 4) {
+                case 0:
+                    document.addProperty(key, random.nextDouble());
+                    break;
+                case 1:
+                    document.addProperty(key, words[random.nextInt(words.length)]);
+                    break;
+                case 2:
+                    JsonArray values = new JsonArray();
+                    for (int v = 0; v < 3; v++) {
+                        values.add(random.nextLong() & Long.MAX_VALUE);
+                    }
+                    document.add(key, values);
+                    break;
+                default:
+                    JsonObject nested = new JsonObject();
+                    nested.addProperty("id", i);
+                    nested.addProperty("valid", random.nextBoolean());
+                    document.add(key, nested);
+            }
+        }
+        int size = 0;
+        for (int i = 0; i < iterations; i++) {
+            String data = gson.toJson(document);
+            size = data.length();
+            document = new JsonParser().parse(data).getAsJsonObject();
+        }
+        return String.valueOf(size);
+    }
+
+    /** Storage is a backend of the io job, mirroring the storage interface of the Go bencher. */
+    interface Storage {
+        long size(String key) throws Exception;
+
+        long read(String key, long offset, int length) throws Exception;
+
+        void write(String key, byte[] data) throws Exception;
+    }
+
+    static final class S3Storage implements Storage {
+        private final S3Client client;
+        private final String bucket;
+
+        S3Storage(JsonObject task, String keyId, String secret) {
+            JsonObject args = object(task, "args");
+            S3ClientBuilder builder = S3Client.builder()
+                    .forcePathStyle("true".equals(string(args, "S3PathStyle", "")));
+            if (has(args, "region")) {
+                builder.region(Region.of(args.get("region").getAsString()));
+            }
+            String endpoint = string(task, "endpoint", "");
+            if (!endpoint.isEmpty()) {
+                if (!endpoint.contains("://")) {
+                    endpoint = ("true".equals(string(args, "DisableSSL", "")) ? "http://" : "https://") + endpoint;
+                }
+                builder.endpointOverride(URI.create(endpoint));
+            }
+            if (!keyId.isEmpty() || !secret.isEmpty()) {
+                builder.credentialsProvider(StaticCredentialsProvider.create(AwsBasicCredentials.create(keyId, secret)));
+            }
+            this.client = builder.build();
+            this.bucket = string(task, "bucket", "");
+        }
+
+        @Override
+        public long size(String key) {
+            return client.headObject(r -> r.bucket(bucket).key(key)).contentLength();
+        }
+
+        @Override
+        public long read(String key, long offset, int length) {
+            return client.getObjectAsBytes(r -> r.bucket(bucket).key(key)
+                    .range(String.format("bytes=%d-%d", offset, offset + length - 1))).asByteArray().length;
+        }
+
+        @Override
+        public void write(String key, byte[] data) {
+            client.putObject(r -> r.bucket(bucket).key(key), RequestBody.fromBytes(data));
+        }
+    }
+
+    static final class HTTPStorage implements Storage {
+        private final String base;
+        private final String token;
+
+        HTTPStorage(JsonObject task, String keyId, String secret) {
+            String endpoint = string(task, "endpoint", "");
+            if (endpoint.isEmpty()) {
+                throw new IllegalArgumentException("http storage needs an endpoint");
+            }
+            String bucket = string(task, "bucket", "");
+            this.base = endpoint.replaceAll("/$", "") + (bucket.isEmpty() ? "" : "/" + bucket);
+            this.token = secret;
+        }
+
+        private HttpURLConnection open(String method, String key) throws IOException {
+            HttpURLConnection connection = (HttpURLConnection) new URL(base + "/" + key).openConnection();
+            connection.setRequestMethod(method);
+            if (!token.isEmpty()) {
+                connection.setRequestProperty("Authorization", "Bearer " + token);
+            }
+            return connection;
+        }
+
+        private static void check(HttpURLConnection connection, String method, String key) throws IOException {
+            int status = connection.getResponseCode();
+            if (status >= 300) {
+                throw new IOException(String.format("%s %s failed with %d", method, key, status));
+            }
+        }
+
+        @Override
+        public long size(String key) throws IOException {
+            HttpURLConnection connection = open("HEAD", key);
+            check(connection, "HEAD", key);
+            return connection.getContentLengthLong();
+        }
+
+        @Override
+        public long read(String key, long offset, int length) throws IOException {
+            HttpURLConnection connection = open("GET", key);
+            connection.setRequestProperty("Range", String.format("bytes=%d-%d", offset, offset + length - 1));
+            check(connection, "GET", key);
+            try (InputStream body = connection.getInputStream()) {
+                return drain(body);
+            }
+        }
+
+        @Override
+        public void write(String key, byte[] data) throws IOException {
+            HttpURLConnection connection = open("PUT", key);
+            connection.setDoOutput(true);
+            connection.setRequestProperty("Content-Type", "application/octet-stream");
+            try (OutputStream body = connection.getOutputStream()) {
+                body.write(data);
+            }
+            check(connection, "PUT", key);
+        }
+    }
+
+    // minimal RESP client, like the Go bencher we avoid pulling a client library into the function
+    static final class RedisStorage implements Storage {
+        private final Socket socket;
+        private final InputStream in;
+        private final OutputStream out;
+        private final String prefix;
+
+        RedisStorage(JsonObject task, String keyId, String secret) throws IOException {
+            String[] address = string(task, "endpoint", "").replace("redis://", "").split(":");
+            this.socket = new Socket(address[0], Integer.parseInt(address[1]));
+            this.in = socket.getInputStream();
+            this.out = socket.getOutputStream();
+            String bucket = string(task, "bucket", "");
+            this.prefix = bucket.isEmpty() ? "" : bucket + "/";
+
+            if (!secret.isEmpty()) {
+                if (keyId.isEmpty()) {
+                    command("AUTH", secret);
+                } else {
+                    command("AUTH", keyId, secret);
+                }
+            }
+            String db = string(object(task, "args"), "db", "");
+            if (!db.isEmpty()) {
+                command("SELECT", db);
+            }
+        }
+
+        private synchronized Object command(Object... args) throws IOException {
+            ByteArrayOutputStream request = new ByteArrayOutputStream();
+            request.write(("*" + args.length + "\r\n").getBytes(StandardCharsets.UTF_8));
+            for (Object arg : args) {
+                byte[] data = arg instanceof byte[] ? (byte[]) arg : String.valueOf(arg).getBytes(StandardCharsets.UTF_8);
+                request.write(("$" + data.length + "\r\n").getBytes(StandardCharsets.UTF_8));
+                request.write(data);
+                request.write("\r\n".getBytes(StandardCharsets.UTF_8));
+            }
+            out.write(request.toByteArray());
+            out.flush();
+            return reply();
+        }
+
+        private Object reply() throws IOException {
+            String line = line();
+            switch (line.charAt(0)) {
+                case '+':
+                    return line.substring(1);
+                case '-':
+                    throw new IOException("redis: " + line.substring(1));
+                case ':':
+                    return Long.parseLong(line.substring(1));
+                case '$':
+                    int length = Integer.parseInt(line.substring(1));
+                    if (length < 0) {
+                        return null;
+                    }
+                    byte[] data = new byte[length + 2];
+                    for (int read = 0; read < data.length; ) {
+                        int n = in.read(data, read, data.length - read);
+                        if (n < 0) {
+                            throw new IOException("redis connection closed");
+                        }
+                        read += n;
+                    }
+                    return new String(data, 0, length, StandardCharsets.ISO_8859_1);
+                default:
+                    throw new IOException("unexpected redis reply " + line);
+            }
+        }
+
+        private String line() throws IOException {
+            StringBuilder line = new StringBuilder();
+            int c;
+            while ((c = in.read()) != '\n') {
+                if (c < 0) {
+                    throw new IOException("redis connection closed");
+                }
+                if (c != '\r') {
+                    line.append((char) c);
+                }
+            }
+            return line.toString();
+        }
+
+        @Override
+        public long size(String key) throws IOException {
+            long size = (Long) command("STRLEN", prefix + key);
+            if (size == 0) {
+                throw new IOException(key + " does not exist");
+            }
+            return size;
+        }
+
+        @Override
+        public long read(String key, long offset, int length) throws IOException {
+            Object data = command("GETRANGE", prefix + key, offset, offset + length - 1);
+            return data == null ? 0 : ((String) data).length();
+        }
+
+        @Override
+        public void write(String key, byte[] data) throws IOException {
+            command("SET", prefix + key, data);
+        }
+    }
+
+    // uses the local filesystem of the function, missing objects are generated on first access
+    static final class FSStorage implements Storage {
+        private final Path dir;
+        private final long objectSize;
+
+        FSStorage(JsonObject task) throws IOException {
+            String endpoint = string(task, "endpoint", System.getProperty("java.io.tmpdir"));
+            this.dir = Paths.get(endpoint, string(task, "bucket", ""));
+            Files.createDirectories(dir);
+            this.objectSize = Long.parseLong(string(object(task, "args"), "objectSize", "0"));
+        }
+
+        @Override
+        public long size(String key) throws IOException {
+            Path file = dir.resolve(key);
+            if (!Files.exists(file) && objectSize > 0) {
+                write(key, randomBytes((int) objectSize));
+            }
+            return Files.size(file);
+        }
+
+        @Override
+        public long read(String key, long offset, int length) throws IOException {
+            try (RandomAccessFile file = new RandomAccessFile(dir.resolve(key).toFile(), "r")) {
+                file.seek(offset);
+                int n = file.read(new byte[length]);
+                return Math.max(n, 0);
+            }
+        }
+
+        @Override
+        public void write(String key, byte[] data) throws IOException {
+            Files.write(dir.resolve(key), data);
+        }
+    }
+
+    // connected backend and the object sizes we looked up, kept across warm invocations
+    private static final class CachedStorage {
+        final Storage storage;
+        final Map<String, Long> objects = new ConcurrentHashMap<>();
+
+        CachedStorage(Storage storage) {
+            this.storage = storage;
+        }
+    }
+
+    private static final Map<String, CachedStorage> storageCache = new ConcurrentHashMap<>();
+
+    static final class IOResult {
+        long reads;
+        long writes;
+        int errors;
+        boolean cached;
+    }
+
+    static IOResult io(JsonObject task) throws Exception {
+        String keyId = string(task, "key_id", "");
+        String secret = string(task, "key", "");
+        if (keyId.isEmpty() && secret.isEmpty()) {
+            keyId = setting("SET_IO_KEY_ID");
+            secret = setting("SET_IO_SECRET");
+        }
+
+        String backend = string(task, "backend", "").toLowerCase();
+        Map<String, String> args = new TreeMap<>();
+        for (Map.Entry<String, JsonElement> arg : object(task, "args").entrySet()) {
+            args.put(arg.getKey(), arg.getValue().getAsString());
+        }
+        String cacheKey = String.join("|", backend, string(task, "endpoint", ""), string(task, "bucket", ""),
+                keyId, hex(MessageDigest.getInstance("SHA-256").digest(secret.getBytes(StandardCharsets.UTF_8))),
+                args.toString());
+
+        boolean noCache = has(task, "no_cache") && task.get("no_cache").getAsBoolean();
+        IOResult result = new IOResult();
+        CachedStorage entry = noCache ? null : storageCache.get(cacheKey);
+        result.cached = entry != null;
+        if (entry == null) {
+            entry = new CachedStorage(connect(backend, task, keyId, secret));
+            if (!noCache) {
+                storageCache.put(cacheKey, entry);
+            }
+        }
+
+        List<String> keys = new ArrayList<>();
+        if (has(task, "keys")) {
+            for (JsonElement key : task.getAsJsonArray("keys")) {
+                keys.add(key.getAsString());
+            }
+        }
+        for (String key : keys) {
+            if (entry.objects.containsKey(key)) {
+                continue;
+            }
+            try {
+                entry.objects.put(key, entry.storage.size(key));
+            } catch (Exception e) {
+                storageCache.remove(cacheKey);
+                throw new IOException(String.format("head %s error %s", key, e.getMessage()), e);
+            }
+        }
+
+        int chunkSize = integer(task, "size", 0);
+        double rw = has(task, "rw") ? task.get("rw").getAsDouble() : 0;
+        int iterations = integer(task, "itteration", 0);
+        for (int i = 0; i < iterations; i++) {
+            if (random.nextDouble() < rw) {
+                String key = keys.get(random.nextInt(keys.size()));
+                //objects no larger than a chunk are read whole
+                long span = entry.objects.get(key) - chunkSize;
+                long start = span > 0 ? (long) (random.nextDouble() * span) : 0;
+                int length = span > 0 ? chunkSize : entry.objects.get(key).intValue();
+                try {
+                    result.reads += entry.storage.read(key, start, length);
+                } catch (Exception e) {
+                    result.errors++;
+                    System.err.println("read error " + e.getMessage());
+                }
+            } else {
+                try {
+                    entry.storage.write("generated_" + i + ".bin", randomBytes(chunkSize));
+                    result.writes += chunkSize;
+                } catch (Exception e) {
+                    result.errors++;
+                    System.err.println("write error " + e.getMessage());
+                }
+            }
+        }
+        return result;
+    }
+
+    // setting reads the environment, or the system properties on platforms without function environment
+    private static String setting(String key) {
+        return System.getProperty(key, System.getenv().getOrDefault(key, ""));
+    }
+
+    private static Storage connect(String backend, JsonObject task, String keyId, String secret) throws Exception {
+        switch (backend) {
+            case "":
+            case "s3":
+                return new S3Storage(task, keyId, secret);
+            case "http":
+                return new HTTPStorage(task, keyId, secret);
+            case "redis":
+                return new RedisStorage(task, keyId, secret);
+            case "fs":
+                return new FSStorage(task);
+            default:
+                throw new IllegalArgumentException("unknown storage backend " + backend);
+        }
+    }
+
+    static Map<String, String> net(JsonObject task) throws Exception {
+        String target = string(task, "target", "");
+        if (target.isEmpty()) {
+            throw new IllegalArgumentException("net job without target");
+        }
+        int concurrency = Math.max(1, integer(task, "concurrency", 1));
+        int requests = integer(task, "requests", 0);
+        boolean keepAlive = has(task, "keep_alive") && task.get("keep_alive").getAsBoolean();
+        //HttpURLConnection pools connections through this property only
+        System.setProperty("http.keepAlive", String.valueOf(keepAlive));
+        byte[] payload = randomBytes(integer(task, "size", 0));
+
+        List<Long> latencies = Collections.synchronizedList(new ArrayList<>());
+        long[] counters = new long[3]; //errors, sent, received
+        ExecutorService pool = Executors.newFixedThreadPool(concurrency);
+        List<Future<?>> pending = new ArrayList<>();
+        long start = System.nanoTime();
+        for (int i = 0; i < requests; i++) {
+            pending.add(pool.submit(() -> {
+                long begin = System.nanoTime();
+                try {
+                    HttpURLConnection connection = (HttpURLConnection) new URL(target).openConnection();
+                    connection.setRequestMethod("POST");
+                    connection.setDoOutput(true);
+                    connection.setRequestProperty("Content-Type", "application/octet-stream");
+                    try (OutputStream body = connection.getOutputStream()) {
+                        body.write(payload);
+                    }
+                    if (connection.getResponseCode() >= 300) {
+                        throw new IOException(target + " responded with " + connection.getResponseCode());
+                    }
+                    long received;
+                    try (InputStream body = connection.getInputStream()) {
+                        received = drain(body);
+                    }
+                    synchronized (counters) {
+                        counters[1] += payload.length;
+                        counters[2] += received;
+                    }
+                    latencies.add((System.nanoTime() - begin) / 1000);
+                } catch (IOException e) {
+                    synchronized (counters) {
+                        counters[0]++;
+                    }
+                }
+            }));
+        }
+        for (Future<?> f : pending) {
+            f.get();
+        }
+        double duration = (System.nanoTime() - start) / 1e9;
+        pool.shutdown();
+
+        Map<String, String> tags = new TreeMap<>();
+        tags.put("job", "net");
+        tags.put("requests", String.valueOf(requests));
+        tags.put("errors", String.valueOf(counters[0]));
+        tags.put("sent", String.valueOf(counters[1]));
+        tags.put("received", String.valueOf(counters[2]));
+        tags.put("throughput", String.format("%.0f", duration > 0 ? (counters[1] + counters[2]) / duration : 0));
+        tags.put("p50", String.valueOf(percentile(latencies, 50)));
+        tags.put("p99", String.valueOf(percentile(latencies, 99)));
+        return tags;
+    }
+
+    private static long percentile(List<Long> latencies, int p) {
+        if (latencies.isEmpty()) {
+            return 0;
+        }
+        List<Long> sorted = new ArrayList<>(latencies);
+        Collections.sort(sorted);
+        return sorted.get((sorted.size() - 1) * p / 100);
+    }
+
+    static Map<String, String> alloc(JsonObject task) throws Exception {
+        Usage before = Usage.read();
+        long start = System.nanoTime();
+
+        int mib = integer(task, "mib", 0);
+        byte[] data = new byte[mib << 20];
+        int page = 4096;
+        int passes = Math.max(1, integer(task, "passes", 1));
+        String pattern = string(task, "pattern", "sequential");
+        for (int pass = 0; pass < passes; pass++) {
+            switch (pattern) {
+                case "":
+                case "sequential":
+                    for (int i = 0; i < data.length; i += page) {
+                        data[i]++;
+                    }
+                    break;
+                case "random":
+                    List<Integer> order = new ArrayList<>();
+                    for (int i = 0; i < data.length / page; i++) {
+                        order.add(i);
+                    }
+                    Collections.shuffle(order, random);
+                    for (int p : order) {
+                        data[p * page]++;
+                    }
+                    break;
+                case "strided":
+                    int stride = integer(task, "stride", 16 * page);
+                    for (int offset = 0; offset < stride; offset += page) {
+                        for (int i = offset; i < data.length; i += stride) {
+                            data[i]++;
+                        }
+                    }
+                    break;
+                default:
+                    throw new IllegalArgumentException("unknown access pattern " + pattern);
+            }
+        }
+        long touched = (System.nanoTime() - start) / 1_000_000;
+
+        long rss = Usage.currentRSS();
+        Thread.sleep(integer(task, "hold_ms", 0));
+        Usage after = Usage.read();
+
+        Map<String, String> tags = new TreeMap<>();
+        tags.put("job", "alloc");
+        tags.put("mib", String.valueOf(mib));
+        tags.put("touch_ms", String.valueOf(touched));
+        tags.put("rss", String.valueOf(rss));
+        tags.put("max_rss", String.valueOf(after.maxRSS));
+        tags.put("minor_faults", String.valueOf(after.minorFaults - before.minorFaults));
+        tags.put("major_faults", String.valueOf(after.majorFaults - before.majorFaults));
+        //keep the allocation reachable until we measured it
+        retained = data;
+        retained = null;
+        return tags;
+    }
+
+    static Map<String, String> disk(JsonObject task) throws IOException {
+        Map<String, String> tags = new TreeMap<>();
+        tags.put("job", "disk");
+        int files = integer(task, "files", 0);
+        if (files < 1) {
+            return tags;
+        }
+        long size = task.has("size") ? task.get("size").getAsLong() : 0;
+        long block = task.has("block") ? task.get("block").getAsLong() : 0;
+        if (block <= 0 || block > size) {
+            block = size;
+        }
+        byte[] buffer = randomBytes((int) block);
+
+        String base = string(task, "dir", System.getProperty("java.io.tmpdir"));
+        Path dir = Files.createTempDirectory(Paths.get(base), "set-disk");
+        long write = 0, sync = 0, read = 0, remove = 0;
+        long written = 0, readBytes = 0;
+        try {
+            for (int i = 0; i < files; i++) {
+                File file = dir.resolve("file_" + i + ".bin").toFile();
+                long start = System.nanoTime();
+                try (FileOutputStream out = new FileOutputStream(file)) {
+                    for (long remaining = size; remaining > 0; remaining -= block) {
+                        int n = (int) Math.min(block, remaining);
+                        out.write(buffer, 0, n);
+                        written += n;
+                    }
+                    write += System.nanoTime() - start;
+
+                    start = System.nanoTime();
+                    out.getFD().sync();
+                    sync += System.nanoTime() - start;
+                }
+            }
+            for (int i = 0; i < files; i++) {
+                long start = System.nanoTime();
+                try (FileInputStream in = new FileInputStream(dir.resolve("file_" + i + ".bin").toFile())) {
+                    readBytes += drain(in);
+                }
+                read += System.nanoTime() - start;
+            }
+            for (int i = 0; i < files; i++) {
+                long start = System.nanoTime();
+                Files.delete(dir.resolve("file_" + i + ".bin"));
+                remove += System.nanoTime() - start;
+            }
+        } finally {
+            try (Stream<Path> leftovers = Files.list(dir)) {
+                leftovers.forEach(f -> f.toFile().delete());
+            }
+            Files.deleteIfExists(dir);
+        }
+
+        tags.put("written", String.valueOf(written));
+        tags.put("read", String.valueOf(readBytes));
+        tags.put("write_throughput", throughput(written, write + sync));
+        tags.put("read_throughput", throughput(readBytes, read));
+        tags.put("write_latency", String.valueOf(write / files / 1000));
+        tags.put("fsync_latency", String.valueOf(sync / files / 1000));
+        tags.put("read_latency", String.valueOf(read / files / 1000));
+        tags.put("delete_latency", String.valueOf(remove / files / 1000));
+        return tags;
+    }
+
+    private static String throughput(long bytes, long nanos) {
+        if (nanos <= 0) {
+            return "0";
+        }
+        return String.format("%.0f", bytes / (nanos / 1e9));
+    }
+
+    // invokeNext calls all steps in parallel and waits for them (fan-in)
+    static Map<String, String> invokeNext(JsonArray steps) throws Exception {
+        ExecutorService pool = Executors.newFixedThreadPool(steps.size());
+        List<Future<Map<String, String>>> results = new ArrayList<>();
+        for (JsonElement step : steps) {
+            results.add(pool.submit(() -> invokeStep(step.getAsJsonObject())));
+        }
+        pool.shutdown();
+
+        Map<String, String> tags = new TreeMap<>();
+        Exception error = null;
+        for (int i = 0; i < results.size(); i++) {
+            try {
+                tags.putAll(results.get(i).get());
+            } catch (Exception e) {
+                Throwable cause = e.getCause() != null ? e.getCause() : e;
+                String name = steps.get(i).getAsJsonObject().get("name").getAsString();
+                tags.put("step." + name + ".error", String.valueOf(cause.getMessage()));
+                if (error == null) {
+                    error = new IOException(cause.getMessage(), cause);
+                }
+            }
+        }
+        if (error != null) {
+            throw error;
+        }
+        return tags;
+    }
+
+    private static Map<String, String> invokeStep(JsonObject step) throws IOException {
+        String name = step.get("name").getAsString();
+        String prefix = "step." + name + ".";
+        Map<String, String> tags = new TreeMap<>();
+
+        long start = System.nanoTime();
+        HttpURLConnection connection = (HttpURLConnection) new URL(step.get("target").getAsString()).openConnection();
+        connection.setRequestMethod("POST");
+        connection.setDoOutput(true);
+        connection.setRequestProperty("Content-Type", "application/json");
+        try (OutputStream body = connection.getOutputStream()) {
+            body.write(gson.toJson(step.get("job")).getBytes(StandardCharsets.UTF_8));
+        }
+        int status = connection.getResponseCode();
+        String response;
+        try (InputStream body = status >= 300 ? connection.getErrorStream() : connection.getInputStream()) {
+            response = body == null ? "" : readString(body);
+        }
+        tags.put(prefix + "latency", String.valueOf((System.nanoTime() - start) / 1_000_000));
+        if (status >= 300) {
+            throw new IOException(String.format("step %s failed with %d", name, status));
+        }
+
+        JsonObject trace;
+        try {
+            trace = new JsonParser().parse(response).getAsJsonObject();
+        } catch (RuntimeException e) {
+            //the step ran, we just can't tell how long it took itself
+            return tags;
+        }
+        if (has(trace, "ExecutionLatency")) {
+            JsonObject latency = trace.getAsJsonObject("ExecutionLatency");
+            long millis = integer(latency, "seconds", 0) * 1000L + integer(latency, "nanos", 0) / 1_000_000L;
+            tags.put(prefix + "execution", String.valueOf(millis));
+        }
+        for (Map.Entry<String, JsonElement> tag : object(trace, "Tags").entrySet()) {
+            if (tag.getKey().startsWith("step.")) {
+                tags.put(tag.getKey(), tag.getValue().getAsString());
+            }
+        }
+        return tags;
+    }
+
+    /** Usage is a snapshot of the resource usage of the function process, read from /proc. */
+    static class Usage {
+        long userCPU;
+        long sysCPU;
+        long maxRSS;
+        long minorFaults;
+        long majorFaults;
+
+        //clock ticks per second of /proc/self/stat, 100 on all common linux platforms
+        private static final long TICKS = 100;
+
+        static Usage read() {
+            Usage usage = new Usage();
+            try {
+                String stat = new String(Files.readAllBytes(Paths.get("/proc/self/stat")), StandardCharsets.UTF_8);
+                //the fields after the command name, which may contain spaces
+                String[] fields = stat.substring(stat.lastIndexOf(')') + 2).split(" ");
+                usage.minorFaults = Long.parseLong(fields[7]);
+                usage.majorFaults = Long.parseLong(fields[9]);
+                usage.userCPU = Long.parseLong(fields[11]) * 1000 / TICKS;
+                usage.sysCPU = Long.parseLong(fields[12]) * 1000 / TICKS;
+                for (String line : Files.readAllLines(Paths.get("/proc/self/status"))) {
+                    if (line.startsWith("VmHWM:")) {
+                        usage.maxRSS = Long.parseLong(line.replaceAll("[^0-9]", "")) * 1024;
+                    }
+                }
+            } catch (IOException | RuntimeException e) {
+                //not on linux, report zeros
+            }
+            return usage;
+        }
+
+        // currentRSS returns the resident set size in bytes, or 0 if /proc is not available
+        static long currentRSS() {
+            try {
+                String[] fields = new String(Files.readAllBytes(Paths.get("/proc/self/statm")), StandardCharsets.UTF_8).split(" ");
+                return Long.parseLong(fields[1]) * 4096;
+            } catch (IOException | RuntimeException e) {
+                return 0;
+            }
+        }
+    }
+
+    /** Resources combines the process usage with the jvm state at one point of an invocation. */
+    static final class Resources extends Usage {
+        long rss;
+        long heap;
+        long gc;
+        long gcMillis;
+        int threads;
+
+        static Resources read() {
+            Usage usage = Usage.read();
+            Resources r = new Resources();
+            r.userCPU = usage.userCPU;
+            r.sysCPU = usage.sysCPU;
+            r.maxRSS = usage.maxRSS;
+            r.minorFaults = usage.minorFaults;
+            r.majorFaults = usage.majorFaults;
+            r.rss = currentRSS();
+            r.heap = Runtime.getRuntime().totalMemory() - Runtime.getRuntime().freeMemory();
+            for (GarbageCollectorMXBean collector : ManagementFactory.getGarbageCollectorMXBeans()) {
+                r.gc += Math.max(collector.getCollectionCount(), 0);
+                r.gcMillis += Math.max(collector.getCollectionTime(), 0);
+            }
+            r.threads = Thread.activeCount();
+            return r;
+        }
+
+        // tags describes what the invocation used between start and end, using the keys of the Go bencher
+        static Map<String, String> tags(Resources start, Resources end) {
+            Map<String, String> tags = new TreeMap<>();
+            tags.put("usage.cpu_user_ms", String.valueOf(end.userCPU - start.userCPU));
+            tags.put("usage.cpu_sys_ms", String.valueOf(end.sysCPU - start.sysCPU));
+            tags.put("usage.minor_faults", String.valueOf(end.minorFaults - start.minorFaults));
+            tags.put("usage.major_faults", String.valueOf(end.majorFaults - start.majorFaults));
+            tags.put("usage.gc", String.valueOf(end.gc - start.gc));
+            tags.put("usage.gc_pause_us", String.valueOf((end.gcMillis - start.gcMillis) * 1000));
+            tags.put("usage.max_rss", String.valueOf(end.maxRSS));
+            tags.put("usage.rss.start", String.valueOf(start.rss));
+            tags.put("usage.rss.end", String.valueOf(end.rss));
+            tags.put("usage.heap.start", String.valueOf(start.heap));
+            tags.put("usage.heap.end", String.valueOf(end.heap));
+            tags.put("usage.threads.start", String.valueOf(start.threads));
+            tags.put("usage.threads.end", String.valueOf(end.threads));
+            tags.put("usage.num_cpu", String.valueOf(Runtime.getRuntime().availableProcessors()));
+            return tags;
+        }
+    }
+
+    private static byte[] randomBytes(int size) {
+        byte[] data = new byte[size];
+        random.nextBytes(data);
+        return data;
+    }
+
+    private static String readString(InputStream in) throws IOException {
+        ByteArrayOutputStream data = new ByteArrayOutputStream();
+        byte[] chunk = new byte[32 * 1024];
+        int n;
+        while ((n = in.read(chunk)) >= 0) {
+            data.write(chunk, 0, n);
+        }
+        return new String(data.toByteArray(), StandardCharsets.UTF_8);
+    }
+
+    private static long drain(InputStream in) throws IOException {
+        byte[] chunk = new byte[32 * 1024];
+        long total = 0;
+        int n;
+        while ((n = in.read(chunk)) >= 0) {
+            total += n;
+        }
+        return total;
+    }
+
+    private static String hex(byte[] data) {
+        StringBuilder hex = new StringBuilder();
+        for (byte b : data) {
+            hex.append(String.format("%02x", b));
+        }
+        return hex.toString();
+    }
+
+    private static boolean has(JsonObject object, String key) {
+        return object != null && object.has(key) && !object.get(key).isJsonNull();
+    }
+
+    private static int integer(JsonObject object, String key, int fallback) {
+        return has(object, key) ? object.get(key).getAsInt() : fallback;
+    }
+
+    private static String string(JsonObject object, String key, String fallback) {
+        return has(object, key) ? object.get(key).getAsString() : fallback;
+    }
+
+    private static JsonObject object(JsonObject object, String key) {
+        return has(object, key) ? object.getAsJsonObject(key) : new JsonObject();
+    }
+}
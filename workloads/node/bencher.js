@@ -0,0 +1,901 @@
+'use strict';
+// Node.js port of the Go bencher, jobs follow the same schema (see set/types.go) and report the same tags.
+
+const crypto = require('crypto');
+const fs = require('fs');
+const http = require('http');
+const https = require('https');
+const net = require('net');
+const os = require('os');
+const path = require('path');
+const zlib = require('zlib');
+
+// version of the job schema generated by the driver
+const SCHEMA_VERSION = 2;
+
+// newRandom returns the source of randomness of one invocation, Math.random unless the job carries a seed,
+// then a seeded mulberry32 generator, so warm instances don't carry a seed over to the next job
+function newRandom(seed) {
+  if (seed === undefined || seed === null) {
+    return Math.random;
+  }
+  let state = Number(BigInt.asUintN(32, BigInt(seed)));
+  return () => {
+    state = (state + 0x6d2b79f5) >>> 0;
+    let t = state;
+    t = Math.imul(t ^ (t >>> 15), t | 1);
+    t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+    return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+  };
+}
+
+function randomInt(random, n) {
+  return Math.floor(random() * n);
+}
+
+function randomBytes(random, size) {
+  const data = Buffer.allocUnsafe(size);
+  for (let i = 0; i < size; i++) {
+    data[i] = randomInt(random, 256);
+  }
+  return data;
+}
+
+// Execute runs the job without any tracing and returns the tags describing the result.
+async function Execute(job) {
+  const version = job.version || 0;
+  if (version > SCHEMA_VERSION) {
+    throw new Error(`job schema version ${version} is newer than the supported ${SCHEMA_VERSION}`);
+  }
+  const tags = await execute(job, newRandom(job.seed));
+  if (job.class) {
+    tags.class = job.class;
+  }
+  if (job.next && job.next.length > 0) {
+    Object.assign(tags, await invokeNext(job.next));
+  }
+  return tags;
+}
+
+async function execute(job, random) {
+  if (job.idle !== undefined) {
+    await Idle(job.idle);
+    return { job: 'idle' };
+  } else if (job.prime !== undefined) {
+    Prime(job.prime);
+    return { job: 'prime' };
+  } else if (job.memory) {
+    Memory(job.memory, random);
+    return { job: 'memory' };
+  } else if (job.io) {
+    const [reads, writes, errors, cached] = await IO(job.io, random);
+    return {
+      job: 'io',
+      cached: String(cached),
+      read: String(reads),
+      writen: String(writes),
+      errors: String(errors),
+    };
+  } else if (job.net) {
+    return Net(job.net, random);
+  } else if (job.alloc) {
+    return Alloc(job.alloc, random);
+  } else if (job.disk) {
+    return Disk(job.disk, random);
+  } else if (job.cpu) {
+    const tags = { job: job.cpu.kernel, checksum: String(CPU(job.cpu, random)) };
+    // the python port caps the matrix size, the tag tells which results compare
+    if (job.cpu.kernel === 'matrix') {
+      tags['matrix.size'] = String(job.cpu.size || 0);
+    }
+    return tags;
+  }
+  return {};
+}
+
+function Idle(seconds) {
+  return new Promise((resolve) => setTimeout(resolve, seconds * 1000));
+}
+
+// Miller Rabin with the bases 2, 7, 61, sufficient for 32 bit numbers
+function Prime(n) {
+  if (n === 0 || n === 1) {
+    return false;
+  }
+  if (n === 2 || n === 7 || n === 61) {
+    return true;
+  }
+  const big = BigInt(n);
+  let d = big - 1n;
+  let s = 0;
+  while ((d & 1n) === 0n) {
+    d >>= 1n;
+    s++;
+  }
+  for (const a of [2n, 7n, 61n]) {
+    let x = 1n;
+    let p = a;
+    for (let dr = d; dr > 0n; dr >>= 1n) {
+      if (dr & 1n) {
+        x = (x * p) % big;
+      }
+      p = (p * p) % big;
+    }
+    if (x === 1n || x === big - 1n) {
+      continue;
+    }
+    let composite = true;
+    for (let r = 1; r < s; r++) {
+      x = (x * x) % big;
+      if (x === 1n) {
+        return false;
+      }
+      if (x === big - 1n) {
+        composite = false;
+        break;
+      }
+    }
+    if (composite) {
+      return false;
+    }
+  }
+  return true;
+}
+
+function generateOperatorArray(size, random) {
+  const data = new Float64Array(size);
+  for (let i = 0; i < size; i++) {
+    data[i] = random() * Number.MAX_SAFE_INTEGER;
+  }
+  return data;
+}
+
+function randomOpt(left, right, random) {
+  const a = left[randomInt(random, left.length)];
+  const b = right[randomInt(random, right.length)];
+  const c = random() < 0.5 || b <= 0 ? a * b : a / b;
+  if (random() < 0.5) {
+    left[randomInt(random, left.length)] = c;
+  } else {
+    right[randomInt(random, right.length)] = c;
+  }
+}
+
+function compute(i, anchor, left, right, random) {
+  if (i < anchor) {
+    compute(i + 1, anchor, left, right, random);
+  } else {
+    randomOpt(left, right, random);
+  }
+}
+
+function Memory(task, random) {
+  let left = generateOperatorArray(task.operator_size || 0, random);
+  let right = generateOperatorArray(task.operator_size || 0, random);
+  for (let i = 0; i < (task.itterations || 0); i++) {
+    compute(0, task.recursion_depth || 0, left, right, random);
+    if (i % 100 === 0) {
+      //increase allocations per 100 itterations
+      const tmp = Float64Array.from(right);
+      right = Float64Array.from(left);
+      left = tmp;
+    }
+  }
+}
+
+const words = ['serverless', 'function', 'cold', 'warm', 'start', 'latency', 'memory', 'io', 'trace', 'bench', 'phase', 'scale'];
+
+function CPU(task, random) {
+  const size = task.size || 0;
+  const iterations = task.itterations || 0;
+  switch (task.kernel) {
+    case 'matrix':
+      return Matrix(size, iterations, random);
+    case 'sha256':
+      return Hash(size, iterations, random);
+    case 'gzip':
+      return Compress(size, iterations, random);
+    case 'json':
+      return JSONKernel(size, iterations, random);
+  }
+  throw new Error(`unknown cpu kernel ${task.kernel}`);
+}
+
+function Matrix(n, iterations, random) {
+  const randomMatrix = () => Float64Array.from({ length: n * n }, () => random());
+  let a = randomMatrix();
+  const b = randomMatrix();
+  let c = new Float64Array(n * n);
+  for (let it = 0; it < iterations; it++) {
+    c.fill(0);
+    for (let i = 0; i < n; i++) {
+      for (let k = 0; k < n; k++) {
+        const aik = a[i * n + k];
+        for (let j = 0; j < n; j++) {
+          c[i * n + j] += aik * b[k * n + j];
+        }
+      }
+    }
+    //feed the result back to avoid multiplying the same operands
+    [a, c] = [c, a];
+  }
+  let trace = 0;
+  for (let i = 0; i < n; i++) {
+    trace += a[i * n + i];
+  }
+  return trace;
+}
+
+function Hash(size, iterations, random) {
+  const buffer = randomBytes(random, size);
+  let digest = crypto.createHash('sha256').digest();
+  for (let i = 0; i < iterations; i++) {
+    digest.copy(buffer, 0, 0, Math.min(digest.length, buffer.length));
+    digest = crypto.createHash('sha256').update(buffer).digest();
+  }
+  return digest.toString('hex');
+}
+
+function compressibleBytes(size, random) {
+  const parts = [];
+  let length = 0;
+  while (length < size) {
+    let word = words[randomInt(random, words.length)];
+    if (randomInt(random, 8) === 0) {
+      word += String(randomInt(random, Number.MAX_SAFE_INTEGER));
+    }
+    parts.push(word);
+    length += word.length + 1;
+  }
+  return Buffer.from(parts.join(' ')).subarray(0, size);
+}
+
+function Compress(size, iterations, random) {
+  const buffer = compressibleBytes(size, random);
+  let compressed = Buffer.alloc(0);
+  for (let i = 0; i < iterations; i++) {
+    compressed = zlib.gzipSync(buffer);
+    zlib.gunzipSync(compressed);
+  }
+  return compressed.length;
+}
+
+function JSONKernel(fields, iterations, random) {
+  let document = {};
+  for (let i = 0; i < fields; i++) {
+    const key = `${words[i % words.length]}_${i}`;
+    switch (i % 4) {
+      case 0:
+        document[key] = random();
+        break;
+      case 1:
+        document[key] = words[randomInt(random, words.length)];
+        break;
+      case 2:
+        document[key] = [randomInt(random, Number.MAX_SAFE_INTEGER), randomInt(random, Number.MAX_SAFE_INTEGER), randomInt(random, Number.MAX_SAFE_INTEGER)];
+        break;
+      default:
+        document[key] = { id: i, valid: randomInt(random, 2) === 0 };
+    }
+  }
+  let size = 0;
+  for (let i = 0; i < iterations; i++) {
+    const data = JSON.stringify(document);
+    size = data.length;
+    document = JSON.parse(data);
+  }
+  return size;
+}
+
+function request(target, method, body, headers) {
+  const url = new URL(target);
+  const client = url.protocol === 'https:' ? https : http;
+  return new Promise((resolve, reject) => {
+    const req = client.request(url, { method, headers, agent: headers.agent }, (res) => {
+      const chunks = [];
+      res.on('data', (chunk) => chunks.push(chunk));
+      res.on('end', () => resolve({ status: res.statusCode, headers: res.headers, body: Buffer.concat(chunks) }));
+      res.on('error', reject);
+    });
+    req.setTimeout(15 * 60 * 1000, () => req.destroy(new Error(`${method} ${target} timed out`)));
+    req.on('error', reject);
+    req.end(body);
+  });
+}
+
+class HTTPStorage {
+  constructor(task, keyId, secret) {
+    if (!task.endpoint) {
+      throw new Error('http storage needs an endpoint');
+    }
+    this.base = task.endpoint.replace(/\/$/, '') + (task.bucket ? `/${task.bucket}` : '');
+    this.token = secret;
+  }
+
+  async do(method, key, body, headers = {}) {
+    if (this.token) {
+      headers.Authorization = `Bearer ${this.token}`;
+    }
+    const res = await request(`${this.base}/${key}`, method, body, headers);
+    if (res.status >= 300) {
+      throw new Error(`${method} ${key} failed with ${res.status}`);
+    }
+    return res;
+  }
+
+  async size(key) {
+    const res = await this.do('HEAD', key);
+    return Number(res.headers['content-length']);
+  }
+
+  async read(key, offset, length) {
+    const res = await this.do('GET', key, undefined, { Range: `bytes=${offset}-${offset + length - 1}` });
+    return res.body.length;
+  }
+
+  async write(key, data) {
+    await this.do('PUT', key, data, { 'Content-Type': 'application/octet-stream' });
+  }
+}
+
+// minimal RESP client, like the Go bencher we avoid pulling a client library into the function
+class RedisStorage {
+  constructor(task, keyId, secret) {
+    this.task = task;
+    this.keyId = keyId;
+    this.secret = secret;
+    this.prefix = task.bucket ? `${task.bucket}/` : '';
+    this.buffer = Buffer.alloc(0);
+    this.waiting = [];
+  }
+
+  async connect() {
+    const [host, port] = this.task.endpoint.replace('redis://', '').split(':');
+    this.socket = net.createConnection({ host, port: Number(port) });
+    await new Promise((resolve, reject) => {
+      this.socket.once('connect', resolve);
+      this.socket.once('error', reject);
+    });
+    this.socket.on('data', (data) => {
+      this.buffer = Buffer.concat([this.buffer, data]);
+      this.drain();
+    });
+    if (this.secret) {
+      await (this.keyId ? this.command('AUTH', this.keyId, this.secret) : this.command('AUTH', this.secret));
+    }
+    const db = (this.task.args || {}).db;
+    if (db) {
+      await this.command('SELECT', db);
+    }
+    return this;
+  }
+
+  // drain resolves pending commands with complete replies
+  drain() {
+    while (this.waiting.length > 0) {
+      const end = this.buffer.indexOf('\r\n');
+      if (end < 0) {
+        return;
+      }
+      const line = this.buffer.subarray(0, end).toString();
+      const { resolve, reject } = this.waiting[0];
+      let consumed = end + 2;
+      let value;
+      switch (line[0]) {
+        case '+':
+          value = line.slice(1);
+          break;
+        case '-':
+          value = new Error(`redis: ${line.slice(1)}`);
+          break;
+        case ':':
+          value = Number(line.slice(1));
+          break;
+        case '$': {
+          const length = Number(line.slice(1));
+          if (length < 0) {
+            value = null;
+            break;
+          }
+          if (this.buffer.length < consumed + length + 2) {
+            return;
+          }
+          value = this.buffer.subarray(consumed, consumed + length);
+          consumed += length + 2;
+          break;
+        }
+        default:
+          value = new Error(`unexpected redis reply ${line}`);
+      }
+      this.buffer = this.buffer.subarray(consumed);
+      this.waiting.shift();
+      if (value instanceof Error) {
+        reject(value);
+      } else {
+        resolve(value);
+      }
+    }
+  }
+
+  command(...args) {
+    const parts = [Buffer.from(`*${args.length}\r\n`)];
+    for (const arg of args) {
+      const data = Buffer.isBuffer(arg) ? arg : Buffer.from(String(arg));
+      parts.push(Buffer.from(`$${data.length}\r\n`), data, Buffer.from('\r\n'));
+    }
+    return new Promise((resolve, reject) => {
+      this.waiting.push({ resolve, reject });
+      this.socket.write(Buffer.concat(parts));
+    });
+  }
+
+  async size(key) {
+    const size = await this.command('STRLEN', this.prefix + key);
+    if (!size) {
+      throw new Error(`${key} does not exist`);
+    }
+    return size;
+  }
+
+  async read(key, offset, length) {
+    const data = await this.command('GETRANGE', this.prefix + key, offset, offset + length - 1);
+    return data ? data.length : 0;
+  }
+
+  async write(key, data) {
+    await this.command('SET', this.prefix + key, data);
+  }
+}
+
+// uses the local filesystem of the function, missing objects are generated on first access
+class FSStorage {
+  constructor(task) {
+    this.dir = path.join(task.endpoint || os.tmpdir(), task.bucket || '');
+    fs.mkdirSync(this.dir, { recursive: true });
+    this.objectSize = Number((task.args || {}).objectSize || 0);
+  }
+
+  async size(key) {
+    const file = path.join(this.dir, key);
+    if (!fs.existsSync(file) && this.objectSize > 0) {
+      //the objects are the same input for every job, they don't depend on its seed
+      await this.write(key, randomBytes(Math.random, this.objectSize));
+    }
+    return fs.statSync(file).size;
+  }
+
+  async read(key, offset, length) {
+    const fd = fs.openSync(path.join(this.dir, key), 'r');
+    try {
+      return fs.readSync(fd, Buffer.alloc(length), 0, length, offset);
+    } finally {
+      fs.closeSync(fd);
+    }
+  }
+
+  async write(key, data) {
+    fs.writeFileSync(path.join(this.dir, key), data);
+  }
+}
+
+class S3Storage {
+  constructor(task, keyId, secret) {
+    //the sdk is only loaded for s3, it is part of the lambda runtime and has to be bundled elsewhere
+    const s3 = require('@aws-sdk/client-s3');
+    const args = task.args || {};
+    this.sdk = s3;
+    this.bucket = task.bucket;
+    let endpoint = task.endpoint || undefined;
+    if (endpoint && args.DisableSSL === 'true' && !endpoint.includes('://')) {
+      endpoint = `http://${endpoint}`;
+    }
+    this.client = new s3.S3Client({
+      region: args.region || 'auto',
+      endpoint,
+      forcePathStyle: args.S3PathStyle === 'true',
+      credentials: keyId || secret ? { accessKeyId: keyId, secretAccessKey: secret } : undefined,
+    });
+  }
+
+  async size(key) {
+    const head = await this.client.send(new this.sdk.HeadObjectCommand({ Bucket: this.bucket, Key: key }));
+    return Number(head.ContentLength);
+  }
+
+  async read(key, offset, length) {
+    const object = await this.client.send(new this.sdk.GetObjectCommand({
+      Bucket: this.bucket,
+      Key: key,
+      Range: `bytes=${offset}-${offset + length - 1}`,
+    }));
+    const data = await object.Body.transformToByteArray();
+    return data.length;
+  }
+
+  async write(key, data) {
+    await this.client.send(new this.sdk.PutObjectCommand({ Bucket: this.bucket, Key: key, Body: data }));
+  }
+}
+
+const backends = {
+  '': S3Storage,
+  s3: S3Storage,
+  http: HTTPStorage,
+  redis: RedisStorage,
+  fs: FSStorage,
+};
+
+// connected backends and the object sizes we looked up, kept across warm invocations
+const storageCache = new Map();
+
+async function IO(task, random) {
+  let keyId = task.key_id || '';
+  let secret = task.key || '';
+  if (!keyId && !secret) {
+    keyId = process.env.SET_IO_KEY_ID || '';
+    secret = process.env.SET_IO_SECRET || '';
+  }
+
+  const backend = (task.backend || '').toLowerCase();
+  if (!(backend in backends)) {
+    throw new Error(`unknown storage backend ${task.backend}`);
+  }
+
+  const args = Object.entries(task.args || {}).map(([k, v]) => `${k}=${v}`).sort().join(',');
+  const cacheKey = [backend, task.endpoint || '', task.bucket || '', keyId,
+    crypto.createHash('sha256').update(secret).digest('hex'), args].join('|');
+
+  let entry = task.no_cache ? undefined : storageCache.get(cacheKey);
+  const cached = entry !== undefined;
+  if (!cached) {
+    let storage = new backends[backend](task, keyId, secret);
+    if (storage.connect) {
+      storage = await storage.connect();
+    }
+    entry = { storage, objects: new Map() };
+    if (!task.no_cache) {
+      storageCache.set(cacheKey, entry);
+    }
+  }
+  const { storage, objects } = entry;
+
+  const keys = task.keys || [];
+  for (const key of keys) {
+    if (objects.has(key)) {
+      continue;
+    }
+    try {
+      objects.set(key, await storage.size(key));
+    } catch (err) {
+      storageCache.delete(cacheKey);
+      throw new Error(`head ${key} error ${err.message}`);
+    }
+  }
+
+  const chunkSize = task.size || 0;
+  let reads = 0;
+  let writes = 0;
+  let errors = 0;
+  for (let i = 0; i < (task.itteration || 0); i++) {
+    if (random() < (task.rw || 0)) {
+      const key = keys[randomInt(random, keys.length)];
+      // objects no larger than a chunk are read whole
+      const span = objects.get(key) - chunkSize;
+      const start = span > 0 ? randomInt(random, span) : 0;
+      try {
+        reads += await storage.read(key, start, span > 0 ? chunkSize : objects.get(key));
+      } catch (err) {
+        errors++;
+        console.error(`read error ${err.message}`);
+      }
+    } else {
+      try {
+        await storage.write(`generated_${i}.bin`, randomBytes(random, chunkSize));
+        writes += chunkSize;
+      } catch (err) {
+        errors++;
+        console.error(`write error ${err.message}`);
+      }
+    }
+  }
+  return [reads, writes, errors, cached];
+}
+
+function percentile(latencies, p) {
+  if (latencies.length === 0) {
+    return 0;
+  }
+  const sorted = [...latencies].sort((a, b) => a - b);
+  return sorted[Math.floor((sorted.length - 1) * p / 100)];
+}
+
+async function Net(task, random) {
+  if (!task.target) {
+    throw new Error('net job without target');
+  }
+  const concurrency = Math.max(1, task.concurrency || 1);
+  const url = new URL(task.target);
+  const Agent = url.protocol === 'https:' ? https.Agent : http.Agent;
+  const agent = new Agent({ keepAlive: !!task.keep_alive, maxSockets: concurrency });
+  const payload = randomBytes(random, task.size || 0);
+
+  const result = { requests: 0, errors: 0, sent: 0, received: 0, latencies: [] };
+  let pending = task.requests || 0;
+  const worker = async () => {
+    while (pending > 0) {
+      pending--;
+      const start = process.hrtime.bigint();
+      try {
+        const res = await request(task.target, 'POST', payload, { 'Content-Type': 'application/octet-stream', agent });
+        if (res.status >= 300) {
+          throw new Error(`${task.target} responded with ${res.status}`);
+        }
+        result.sent += payload.length;
+        result.received += res.body.length;
+        result.latencies.push(Number(process.hrtime.bigint() - start) / 1000);
+      } catch (err) {
+        result.errors++;
+      }
+      result.requests++;
+    }
+  };
+
+  const start = process.hrtime.bigint();
+  await Promise.all(Array.from({ length: concurrency }, worker));
+  const duration = Number(process.hrtime.bigint() - start) / 1e9;
+  agent.destroy();
+
+  const throughput = duration > 0 ? (result.sent + result.received) / duration : 0;
+  return {
+    job: 'net',
+    requests: String(result.requests),
+    errors: String(result.errors),
+    sent: String(result.sent),
+    received: String(result.received),
+    throughput: throughput.toFixed(0),
+    p50: String(Math.floor(percentile(result.latencies, 50))),
+    p99: String(Math.floor(percentile(result.latencies, 99))),
+  };
+}
+
+function currentRSS() {
+  return process.memoryUsage().rss;
+}
+
+function Alloc(task, random) {
+  const before = process.resourceUsage();
+  const start = process.hrtime.bigint();
+
+  const data = Buffer.alloc((task.mib || 0) * 1024 * 1024);
+  const page = 4096;
+  const pages = Math.floor(data.length / page);
+  const pattern = task.pattern || 'sequential';
+  for (let pass = 0; pass < Math.max(1, task.passes || 1); pass++) {
+    if (pattern === 'sequential') {
+      for (let i = 0; i < data.length; i += page) {
+        data[i]++;
+      }
+    } else if (pattern === 'random') {
+      const order = Array.from({ length: pages }, (_, i) => i);
+      for (let i = order.length - 1; i > 0; i--) {
+        const j = randomInt(random, i + 1);
+        [order[i], order[j]] = [order[j], order[i]];
+      }
+      for (const p of order) {
+        data[p * page]++;
+      }
+    } else if (pattern === 'strided') {
+      const stride = task.stride || 16 * page;
+      for (let offset = 0; offset < stride; offset += page) {
+        for (let i = offset; i < data.length; i += stride) {
+          data[i]++;
+        }
+      }
+    } else {
+      throw new Error(`unknown access pattern ${pattern}`);
+    }
+  }
+  const touched = Number(process.hrtime.bigint() - start) / 1e6;
+
+  const rss = currentRSS();
+  const hold = task.hold_ms || 0;
+  return Idle(hold / 1000).then(() => {
+    const after = process.resourceUsage();
+    return {
+      job: 'alloc',
+      mib: String(task.mib || 0),
+      touch_ms: String(Math.floor(touched)),
+      rss: String(rss),
+      max_rss: String(after.maxRSS * 1024),
+      minor_faults: String(after.minorPageFault - before.minorPageFault),
+      major_faults: String(after.majorPageFault - before.majorPageFault),
+    };
+  });
+}
+
+function Disk(task, random) {
+  const files = task.files || 0;
+  if (files < 1) {
+    return { job: 'disk' };
+  }
+  const size = task.size || 0;
+  let block = task.block || 0;
+  if (block <= 0 || block > size) {
+    block = size;
+  }
+  const buffer = randomBytes(random, block);
+
+  const dir = fs.mkdtempSync(path.join(task.dir || os.tmpdir(), 'set-disk'));
+  const phases = { write: 0, sync: 0, read: 0, remove: 0 };
+  const time = (phase, fn) => {
+    const start = process.hrtime.bigint();
+    const result = fn();
+    phases[phase] += Number(process.hrtime.bigint() - start) / 1000;
+    return result;
+  };
+
+  let written = 0;
+  let read = 0;
+  try {
+    const names = Array.from({ length: files }, (_, i) => path.join(dir, `file_${i}.bin`));
+    for (const name of names) {
+      const fd = fs.openSync(name, 'w');
+      try {
+        time('write', () => {
+          for (let remaining = size; remaining > 0; remaining -= block) {
+            written += fs.writeSync(fd, buffer, 0, Math.min(block, remaining));
+          }
+        });
+        time('sync', () => fs.fsyncSync(fd));
+      } finally {
+        fs.closeSync(fd);
+      }
+    }
+    const chunk = Buffer.alloc(block);
+    for (const name of names) {
+      time('read', () => {
+        const fd = fs.openSync(name, 'r');
+        try {
+          let n;
+          while ((n = fs.readSync(fd, chunk, 0, block, null)) > 0) {
+            read += n;
+          }
+        } finally {
+          fs.closeSync(fd);
+        }
+      });
+    }
+    for (const name of names) {
+      time('remove', () => fs.unlinkSync(name));
+    }
+  } finally {
+    fs.rmSync(dir, { recursive: true, force: true });
+  }
+
+  const throughput = (bytes, micros) => (micros > 0 ? (bytes / (micros / 1e6)).toFixed(0) : '0');
+  const latency = (phase) => String(Math.floor(phases[phase] / files));
+  return {
+    job: 'disk',
+    written: String(written),
+    read: String(read),
+    write_throughput: throughput(written, phases.write + phases.sync),
+    read_throughput: throughput(read, phases.read),
+    write_latency: latency('write'),
+    fsync_latency: latency('sync'),
+    read_latency: latency('read'),
+    delete_latency: latency('remove'),
+  };
+}
+
+async function invokeStep(step) {
+  const prefix = `step.${step.name}.`;
+  const tags = {};
+  const start = process.hrtime.bigint();
+  const res = await request(step.target, 'POST', JSON.stringify(step.job), { 'Content-Type': 'application/json' });
+  tags[prefix + 'latency'] = String(Number((process.hrtime.bigint() - start) / 1000000n));
+  if (res.status >= 300) {
+    throw new Error(`step ${step.name} failed with ${res.status}`);
+  }
+
+  let trace;
+  try {
+    trace = JSON.parse(res.body.toString());
+  } catch (err) {
+    //the step ran, we just can't tell how long it took itself
+    return tags;
+  }
+  if (trace.ExecutionLatency) {
+    const latency = trace.ExecutionLatency;
+    tags[prefix + 'execution'] = String(Math.floor((latency.seconds || 0) * 1000 + (latency.nanos || 0) / 1e6));
+  }
+  for (const [k, v] of Object.entries(trace.Tags || {})) {
+    if (k.startsWith('step.')) {
+      tags[k] = v;
+    }
+  }
+  return tags;
+}
+
+// invokeNext calls all steps in parallel and waits for them (fan-in)
+async function invokeNext(steps) {
+  const results = await Promise.allSettled(steps.map(invokeStep));
+  const tags = {};
+  let error;
+  results.forEach((result, i) => {
+    if (result.status === 'fulfilled') {
+      Object.assign(tags, result.value);
+    } else {
+      tags[`step.${steps[i].name}.error`] = result.reason.message;
+      error = error || result.reason;
+    }
+  });
+  if (error) {
+    throw error;
+  }
+  return tags;
+}
+
+// resourceTags reports a subset of the resource usage tags of the Go bencher
+function resourceTags(start, end) {
+  return {
+    'usage.cpu_user_ms': String(Math.floor((end.userCPUTime - start.userCPUTime) / 1000)),
+    'usage.cpu_sys_ms': String(Math.floor((end.systemCPUTime - start.systemCPUTime) / 1000)),
+    'usage.minor_faults': String(end.minorPageFault - start.minorPageFault),
+    'usage.major_faults': String(end.majorPageFault - start.majorPageFault),
+    'usage.max_rss': String(end.maxRSS * 1024),
+    'usage.num_cpu': String(os.cpus().length),
+  };
+}
+
+// timestamp formats milliseconds since the epoch like the timestamps of the fact traces
+function timestamp(millis) {
+  return { seconds: Math.floor(millis / 1000), nanos: Math.round((millis % 1000) * 1e6) };
+}
+
+// platform detects the platform from its environment, like the inspectors of the fact clients
+function platform() {
+  if (process.env.AWS_LAMBDA_LOG_STREAM_NAME) {
+    return 'AWS';
+  } else if (process.env.X_GOOGLE_FUNCTION_NAME) {
+    return 'GCF';
+  } else if (process.env.WEBSITE_HOSTNAME) {
+    return 'ACF';
+  } else if (process.env.__OW_ACTION_NAME) {
+    return 'OW';
+  }
+  return 'UKN';
+}
+
+// the module is loaded once per container, so the id and boot time tell cold from warm starts
+const containerID = crypto.randomBytes(16).toString('hex');
+const bootTime = timestamp(Date.now());
+
+// Handle runs the job and returns a trace shaped like the ones of the fact clients
+async function Handle(job) {
+  // sampling the resources adds to the execution latency, so only jobs that ask for it do
+  const start = job.usage ? process.resourceUsage() : null;
+  const startTime = process.hrtime.bigint();
+  const trace = {
+    ContainerID: containerID,
+    HostID: os.hostname(),
+    BootTime: bootTime,
+    StartTime: timestamp(Date.now()),
+    Platform: platform(),
+    Runtime: `node ${process.version}`,
+    Tags: {},
+  };
+  try {
+    trace.Tags = await Execute(job);
+  } catch (err) {
+    trace.Logs = { error: err.message };
+  }
+  if (start) {
+    Object.assign(trace.Tags, resourceTags(start, process.resourceUsage()));
+  }
+  const nanos = process.hrtime.bigint() - startTime;
+  trace.EndTime = timestamp(Date.now());
+  trace.ExecutionLatency = { seconds: Number(nanos / 1000000000n), nanos: Number(nanos % 1000000000n) };
+  return trace;
+}
+
+module.exports = { Execute, Handle, SCHEMA_VERSION };
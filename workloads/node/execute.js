@@ -0,0 +1,24 @@
+#!/usr/bin/env node
+// Executes a job read from stdin without tracing and prints the result tags as json.
+// Used by the conformance tests of the driver to compare the node and go workloads.
+'use strict';
+
+const { Execute } = require('./bencher');
+
+async function main() {
+  const chunks = [];
+  for await (const chunk of process.stdin) {
+    chunks.push(chunk);
+  }
+  //keep stdout clean for the result, the workloads log their errors
+  console.log = console.error;
+  try {
+    const tags = await Execute(JSON.parse(Buffer.concat(chunks).toString()));
+    process.stdout.write(JSON.stringify(tags));
+  } catch (err) {
+    process.stdout.write(JSON.stringify({ error: err.message }));
+    process.exitCode = 1;
+  }
+}
+
+main();
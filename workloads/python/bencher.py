@@ -1,41 +1,113 @@
 #!/usr/bin/env/python
 from multiprocessing import Pool
 
-import boto3
 import os
 import time
-from botocore.client import Config,ClientError
+import random
+import gzip
+import hashlib
+import json
+import socket
+import threading
+import http.client
+import urllib.parse
+import urllib.request
 
-from factclient.fact import Fact
-from factclient.io.ConsoleLogging import ConsoleLogging
+try:
+	from factclient.fact import Fact
+	from factclient.io.ConsoleLogging import ConsoleLogging
+except ImportError:
+	#local execution, e.g. the conformance tests of the driver
+	Fact = None
 
-import random
+#version of the job schema generated by the driver, see set/types.go
+SCHEMA_VERSION = 2
 
 def init():
+	if Fact is None:
+		return
 	io = ConsoleLogging()
 	Fact.boot({"inlcudeEnvironment": False, "io": io, "send_on_update": True})
 
 
 init()
 
-job_keys = ["prime","memory","IO","idle"]
+job_keys = ["prime","memory","io","idle","cpu","net","alloc","disk"]
 def Handle(falco,job,context ):
 	if not validate(job):
 		return {"error":"job not defined correctly"}
-	
+
 	Fact.start(context, job)
-	if "prime" in job:
+	#sampling the resources adds to the execution latency, so only jobs that ask for it do
+	usage = bool(job.get("usage"))
+	start = readUsage() if usage else None
+	error = None
+	try:
+		tags = Execute(job)
+	except Exception as e:
+		#like the go bencher, a failed job still ends its trace, with the error logged
+		error = str(e)
+		tags = {}
+	if usage:
+		tags.update(resourceTags(start, readUsage()))
+	Fact.update(context, error, tags)
+
+	trace = Fact.done(context, "test done", ["no more args"])
+	if isinstance(trace, dict):
+		trace.setdefault("Tags", {}).update(tags)
+	return trace
+
+def Execute(job):
+	"""
+	Runs the job without any tracing and returns the tags describing the result, like Execute of the Go bencher.
+	"""
+	version = int(job.get("version", 0))
+	if version > SCHEMA_VERSION:
+		raise ValueError("job schema version %d is newer than the supported %d"%(version, SCHEMA_VERSION))
+
+	#every job reseeds, without a seed from the os, so a warm instance doesn't repeat the seed of an earlier job
+	random.seed(job.get("seed"))
+
+	tags = execute(job)
+	if job.get("class"):
+		tags["class"] = job["class"]
+	if job.get("next"):
+		tags.update(invokeNext(job["next"]))
+	return tags
+
+def execute(job):
+	if "idle" in job:
+		Idle(float(job["idle"]))
+		return {"job":"idle"}
+	elif "prime" in job:
 		Prime(int(job["prime"]))
+		return {"job":"prime"}
 	elif "memory" in job:
 		Memory(job["memory"])
-	elif "IO" in job:
-		IO(job["IO"])
-	elif "idle" in job:
-		Idle(int(job["idle"]))
-	else:
-		return {"error":"job not defined correctly"}
-
-	return Fact.done(context, "test done", ["no more args"])
+		return {"job":"memory"}
+	elif "io" in job:
+		reads, writes, errors, cached = IO(job["io"])
+		return {
+			"job":"io",
+			"cached":formatBool(cached),
+			"read":str(reads),
+			"writen":str(writes),
+			"errors":str(errors),
+		}
+	elif "net" in job:
+		return Net(job["net"])
+	elif "alloc" in job:
+		return Alloc(job["alloc"])
+	elif "disk" in job:
+		return Disk(job["disk"])
+	elif "cpu" in job:
+		checksum = CPU(job["cpu"])
+		tags = {"job":job["cpu"]["kernel"],"checksum":str(checksum)}
+		#the matrix size actually used, larger sizes are capped
+		if job["cpu"]["kernel"] == "matrix":
+			tags["matrix.size"] = str(matrix_size(int(job["cpu"].get("size", 0))))
+		return tags
+	return {}
 
 def validate(job):
 	if isinstance(job, dict):
@@ -45,6 +117,9 @@ def validate(job):
 	
 	return False
 
+def formatBool(value):
+	return "true" if value else "false"
+
 def randomOpt(left, right):
 	a = left[random.randint(0,len(left)-1)]
 	b = right[random.randint(0,len(right)-1)]
@@ -93,15 +168,14 @@ def PMemory(task):
 		p.map(Memory, [ptask]*threads)
 
 def Memory(task):
-	if not all (k in task for k in (
-		"operator_size","itterations","recursion_depth")):
-		print("missing key in "+task.keys())
-		return
-	
-	left = generateOperatorArray(task["operator_size"])
-	right = generateOperatorArray(task["operator_size"])
-	for i in range(task["itterations"]):
-		compute(0, task["recursion_depth"], left, right)
+	#zero values are omitted by the driver
+	operator_size = task.get("operator_size", 0)
+	recursion_depth = task.get("recursion_depth", 0)
+
+	left = generateOperatorArray(operator_size)
+	right = generateOperatorArray(operator_size)
+	for i in range(task.get("itterations", 0)):
+		compute(0, recursion_depth, left, right)
 		if i%100 == 0:
 			tmp = left.copy()
 			left = right.copy()
@@ -109,6 +183,85 @@ def Memory(task):
 
 	return left,right
 	
+words = ["serverless", "function", "cold", "warm", "start", "latency", "memory", "io", "trace", "bench", "phase", "scale"]
+
+def CPU(task):
+	kernel = task.get("kernel")
+	size = int(task.get("size", 0))
+	itterations = int(task.get("itterations", 0))
+	if kernel == "matrix":
+		return Matrix(size, itterations)
+	elif kernel == "sha256":
+		return Hash(size, itterations)
+	elif kernel == "gzip":
+		return Compress(size, itterations)
+	elif kernel == "json":
+		return JSON(size, itterations)
+	print("unknown cpu kernel %s"%kernel)
+
+# pure python multiplies about 10^7 operands per second, larger matrices would not finish within the function timeout
+MATRIX_MAX_SIZE = 256
+
+def matrix_size(n):
+	return min(n, MATRIX_MAX_SIZE)
+
+def Matrix(n, itterations):
+	if n > MATRIX_MAX_SIZE:
+		print("capping the matrix size %d to %d"%(n, MATRIX_MAX_SIZE))
+		n = matrix_size(n)
+	a = [[random.random() for _ in range(n)] for _ in range(n)]
+	b = [[random.random() for _ in range(n)] for _ in range(n)]
+	for _ in range(itterations):
+		#feed the result back to avoid multiplying the same operands
+		a = [[sum(x * y for x, y in zip(row, col)) for col in zip(*b)] for row in a]
+	return sum(a[i][i] for i in range(n))
+
+def Hash(size, itterations):
+	buffer = bytearray(random.getrandbits(8) for _ in range(size))
+	digest = hashlib.sha256(b"").digest()
+	for _ in range(itterations):
+		buffer[:len(digest)] = digest
+		digest = hashlib.sha256(buffer).digest()
+	return digest.hex()
+
+def compressibleBytes(size):
+	parts = []
+	length = 0
+	while length < size:
+		word = random.choice(words)
+		if random.randint(0, 7) == 0:
+			word += str(random.getrandbits(62))
+		parts.append(word)
+		length += len(word) + 1
+	return " ".join(parts).encode()[:size]
+
+def Compress(size, itterations):
+	buffer = compressibleBytes(size)
+	compressed = b""
+	for _ in range(itterations):
+		compressed = gzip.compress(buffer)
+		gzip.decompress(compressed)
+	return len(compressed)
+
+def JSON(fields, itterations):
+	document = {}
+	for i in range(fields):
+		key = "%s_%d"%(words[i%len(words)], i)
+		if i%4 == 0:
+			document[key] = random.random()
+		elif i%4 == 1:
+			document[key] = random.choice(words)
+		elif i%4 == 2:
+			document[key] = [random.getrandbits(62) for _ in range(3)]
+		else:
+			document[key] = {"id": i, "valid": random.randint(0, 1) == 0}
+	size = 0
+	for _ in range(itterations):
+		data = json.dumps(document)
+		size = len(data)
+		document = json.loads(data)
+	return size
+
 def Idle(n):
 	time.sleep(n)
 
@@ -150,75 +303,462 @@ def Prime(n):
  
 	return True 
 
+class S3Storage:
+	def __init__(self, task, key_id, secret):
+		import boto3
+		from botocore.client import Config
+
+		args = task.get("args", {})
+		config = None
+		if args.get("S3PathStyle", "").lower() == "true":
+			config = Config(s3={"addressing_style": "path"})
+
+		self.bucket = task.get("bucket")
+		self.client = boto3.client('s3',
+			endpoint_url=task.get("endpoint") or None,
+			aws_access_key_id=key_id or None,
+			aws_secret_access_key=secret or None,
+			use_ssl=args.get("DisableSSL", "").lower() != "true",
+			config=config,
+			region_name=args.get("region") or None)
+
+	def size(self, key):
+		head = self.client.head_object(Bucket=self.bucket, Key=key)
+		return int(head["ContentLength"])
+
+	def read(self, key, offset, length):
+		resp = self.client.get_object(Bucket=self.bucket, Key=key, Range="bytes=%d-%d"%(offset, offset+length-1))
+		return len(resp['Body'].read())
+
+	def write(self, key, data):
+		self.client.put_object(Body=data, Bucket=self.bucket, Key=key)
+
+class HTTPStorage:
+	def __init__(self, task, key_id, secret):
+		if not task.get("endpoint"):
+			raise ValueError("http storage needs an endpoint")
+		self.base = task["endpoint"].rstrip("/")
+		if task.get("bucket"):
+			self.base += "/" + task["bucket"]
+		self.token = secret
+
+	def do(self, method, key, data=None, headers={}):
+		req = urllib.request.Request(self.base+"/"+key, data=data, method=method, headers=dict(headers))
+		if data is not None:
+			req.add_header("Content-Type", "application/octet-stream")
+		if self.token:
+			req.add_header("Authorization", "Bearer "+self.token)
+		return urllib.request.urlopen(req, timeout=300)
+
+	def size(self, key):
+		with self.do("HEAD", key) as resp:
+			return int(resp.headers["Content-Length"])
+
+	def read(self, key, offset, length):
+		with self.do("GET", key, headers={"Range":"bytes=%d-%d"%(offset, offset+length-1)}) as resp:
+			return len(resp.read())
+
+	def write(self, key, data):
+		with self.do("PUT", key, data=data) as resp:
+			resp.read()
+
+class RedisStorage:
+	def __init__(self, task, key_id, secret):
+		host, _, port = task.get("endpoint", "").replace("redis://", "").rpartition(":")
+		self.conn = socket.create_connection((host, int(port)), timeout=10)
+		self.reader = self.conn.makefile("rb")
+		self.prefix = task["bucket"]+"/" if task.get("bucket") else ""
+		if secret:
+			self.command("AUTH", key_id, secret) if key_id else self.command("AUTH", secret)
+		db = task.get("args", {}).get("db")
+		if db:
+			self.command("SELECT", db)
+
+	def command(self, *args):
+		out = b"*%d\r\n"%len(args)
+		for arg in args:
+			arg = arg if isinstance(arg, bytes) else str(arg).encode()
+			out += b"$%d\r\n%s\r\n"%(len(arg), arg)
+		self.conn.sendall(out)
+		return self.reply()
+
+	def reply(self):
+		line = self.reader.readline().rstrip(b"\r\n")
+		if not line:
+			raise IOError("empty redis reply")
+		kind, rest = line[:1], line[1:]
+		if kind == b"+":
+			return rest.decode()
+		elif kind == b"-":
+			raise IOError("redis: %s"%rest.decode())
+		elif kind == b":":
+			return int(rest)
+		elif kind == b"$":
+			length = int(rest)
+			if length < 0:
+				return None
+			return self.reader.read(length+2)[:length]
+		raise IOError("unexpected redis reply %s"%line)
+
+	def size(self, key):
+		size = self.command("STRLEN", self.prefix+key)
+		if not size:
+			raise IOError("%s does not exist"%key)
+		return size
+
+	def read(self, key, offset, length):
+		return len(self.command("GETRANGE", self.prefix+key, offset, offset+length-1) or b"")
+
+	def write(self, key, data):
+		self.command("SET", self.prefix+key, data)
+
+class FSStorage:
+	"""
+	uses the local filesystem of the function, missing objects are generated on first access
+	"""
+	def __init__(self, task, key_id, secret):
+		import tempfile
+		self.dir = os.path.join(task.get("endpoint") or tempfile.gettempdir(), task.get("bucket", ""))
+		os.makedirs(self.dir, exist_ok=True)
+		self.object_size = int(task.get("args", {}).get("objectSize", "0"))
+
+	def size(self, key):
+		path = os.path.join(self.dir, key)
+		if not os.path.exists(path) and self.object_size > 0:
+			self.write(key, os.urandom(self.object_size))
+		return os.path.getsize(path)
+
+	def read(self, key, offset, length):
+		with open(os.path.join(self.dir, key), "rb") as f:
+			f.seek(offset)
+			return len(f.read(length))
+
+	def write(self, key, data):
+		with open(os.path.join(self.dir, key), "wb") as f:
+			f.write(data)
+
+backends = {"": S3Storage, "s3": S3Storage, "http": HTTPStorage, "redis": RedisStorage, "fs": FSStorage}
+
+#connected backends and the object sizes we looked up, kept across warm invocations
+storage_cache = {}
+
 def IO(task):
-	if task ==  None :
-		return -1, -1, 1
-	
-	if not all (k in task for k in (
-		"endpoint_url","keyId","key","keys","itterations",
-		"bucket","read_write","chunk_size")):
-		return -1,-1,1
-	
-	region = "us-east-1"
-	if "region" in task:
-		region = task["region"]
-	
-	use_ssl = True
-	if "disableSSL" in task:
-		use_ssl=task["disableSSL"].lower() == "true"
-	
-	config=None
-	if "S3PathStyle" in task:
-		if task["S3PathStyle"].lower() == "true":
-			config=Config(signature_version='s3v4'),
-
-	s3 = boto3.client('s3',
-		endpoint_url=task["endpoint_url"],
-		aws_access_key_id=task["keyId"],
-		aws_secret_access_key=task["key"],
-		use_ssl=use_ssl,
-		config=config,
-		region_name=region)
-
-	chunk_size = int(task["chunk_size"])
-	objects = {}
-
-	for key in task["keys"]:
+	"""
+	returns reads, writes, errors and whether a cached storage client was reused
+	"""
+	key_id = task.get("key_id", "")
+	secret = task.get("key", "")
+	if not key_id and not secret:
+		key_id = os.environ.get("SET_IO_KEY_ID", "")
+		secret = os.environ.get("SET_IO_SECRET", "")
+
+	backend = task.get("backend", "").lower()
+	if backend not in backends:
+		raise ValueError("unknown storage backend %s"%backend)
+
+	cache_key = "|".join([backend, task.get("endpoint", ""), task.get("bucket", ""), key_id,
+		hashlib.sha256(secret.encode()).hexdigest(),
+		",".join(sorted("%s=%s"%(k, v) for k, v in task.get("args", {}).items()))])
+	cached = False
+	if not task.get("no_cache") and cache_key in storage_cache:
+		storage, objects = storage_cache[cache_key]
+		cached = True
+	else:
+		storage, objects = backends[backend](task, key_id, secret), {}
+		if not task.get("no_cache"):
+			storage_cache[cache_key] = (storage, objects)
+
+	keys = task.get("keys", [])
+	for key in keys:
+		if key in objects:
+			continue
 		try:
-			head = s3.head_object(
-				Bucket=task["bucket"],
-				Key=key)
-			objects[key] = int(head["ContentLength"])
+			objects[key] = storage.size(key)
 		except Exception as e:
-			print("failed to get key %s"%key,e)
+			storage_cache.pop(cache_key, None)
+			raise IOError("head %s error %s"%(key, e))
 
-	reads = 0 
+	chunk_size = int(task.get("size", 0))
+	reads = 0
 	writes = 0
 	errors = 0
-
-	for i in range(task["itterations"]):
-		if random.uniform(0, 1) < task["read_write"]:
-			key = random.choice(task["keys"])
-			start = random.randint(0,objects[key]-chunk_size)
-			rangeString = "bytes=%d-%d"%(start, start+chunk_size)
+	for i in range(task.get("itteration", 0)):
+		if random.random() < task.get("rw", 0):
+			key = random.choice(keys)
+			#objects no larger than a chunk are read whole
+			start, length = 0, chunk_size
+			if objects[key] > chunk_size:
+				start = random.randrange(objects[key]-chunk_size)
+			else:
+				length = objects[key]
 			try:
-				resp = s3.get_object(Bucket=task["bucket"],Key=key,Range=rangeString)
-		   
-				data = resp['Body'].read()
-				reads += len(data)
-			except ClientError as e:
-				error_code = e.response["Error"]["Code"]
+				reads += storage.read(key, start, length)
+			except Exception as e:
 				errors+=1
-				print("failed to get %s [%d-%d] - %s"%(key,start,start+chunk_size,error_code))
+				print("failed to read %s [%d-%d] - %s"%(key,start,start+chunk_size,e))
 		else:
 			key = "generated_%d.bin"%i
-			rnd = os.urandom(chunk_size)
 			try:
-				resp = s3.put_object(Body=rnd, Bucket=task["bucket"], Key=key)
+				storage.write(key, os.urandom(chunk_size))
 				writes += chunk_size
-			except ClientError as e:
-				error_code = e.response["Error"]["Code"]
+			except Exception as e:
 				errors+=1
-				print("failed to write  %d"%(key,error_code))
-			
-	return reads, writes, errors
\ No newline at end of file
+				print("failed to write %s - %s"%(key,e))
+
+	return reads, writes, errors, cached
+
+def percentile(latencies, p):
+	if not latencies:
+		return 0
+	latencies = sorted(latencies)
+	return latencies[int((len(latencies)-1)*p/100)]
+
+def Net(task):
+	if not task.get("target"):
+		raise ValueError("net job without target")
+
+	url = urllib.parse.urlsplit(task["target"])
+	connection = http.client.HTTPSConnection if url.scheme == "https" else http.client.HTTPConnection
+	path = url.path or "/"
+	if url.query:
+		path += "?" + url.query
+	payload = os.urandom(int(task.get("size", 0)))
+	keep_alive = task.get("keep_alive", False)
+
+	lock = threading.Lock()
+	pending = list(range(int(task.get("requests", 0))))
+	result = {"requests": 0, "errors": 0, "sent": 0, "received": 0, "latencies": []}
+
+	def worker():
+		conn = None
+		while True:
+			with lock:
+				if not pending:
+					break
+				pending.pop()
+			start = time.perf_counter()
+			try:
+				if conn is None:
+					conn = connection(url.netloc, timeout=60)
+				conn.request("POST", path, body=payload, headers={
+					"Content-Type": "application/octet-stream",
+					"Connection": "keep-alive" if keep_alive else "close"})
+				resp = conn.getresponse()
+				received = len(resp.read())
+				if resp.status >= 300:
+					raise IOError("%s responded with %d"%(task["target"], resp.status))
+				latency = time.perf_counter() - start
+				with lock:
+					result["sent"] += len(payload)
+					result["received"] += received
+					result["latencies"].append(latency)
+				failed = False
+			except Exception:
+				failed = True
+			with lock:
+				result["requests"] += 1
+				if failed:
+					result["errors"] += 1
+			if failed or not keep_alive:
+				if conn is not None:
+					conn.close()
+				conn = None
+		if conn is not None:
+			conn.close()
+
+	start = time.perf_counter()
+	threads = [threading.Thread(target=worker) for _ in range(max(1, int(task.get("concurrency", 1))))]
+	for t in threads:
+		t.start()
+	for t in threads:
+		t.join()
+	duration = time.perf_counter() - start
+
+	throughput = (result["sent"]+result["received"])/duration if duration > 0 else 0
+	return {
+		"job": "net",
+		"requests": str(result["requests"]),
+		"errors": str(result["errors"]),
+		"sent": str(result["sent"]),
+		"received": str(result["received"]),
+		"throughput": "%.0f"%throughput,
+		"p50": str(int(percentile(result["latencies"], 50)*1e6)),
+		"p99": str(int(percentile(result["latencies"], 99)*1e6)),
+	}
+
+def currentRSS():
+	try:
+		with open("/proc/self/statm") as f:
+			return int(f.read().split()[1]) * os.sysconf("SC_PAGE_SIZE")
+	except (OSError, IndexError, ValueError):
+		return 0
+
+def readUsage():
+	import resource
+	return resource.getrusage(resource.RUSAGE_SELF)
+
+def resourceTags(start, end):
+	return {
+		"usage.cpu_user_ms": str(int((end.ru_utime-start.ru_utime)*1000)),
+		"usage.cpu_sys_ms": str(int((end.ru_stime-start.ru_stime)*1000)),
+		"usage.minor_faults": str(end.ru_minflt-start.ru_minflt),
+		"usage.major_faults": str(end.ru_majflt-start.ru_majflt),
+		"usage.max_rss": str(end.ru_maxrss*1024),
+		"usage.num_cpu": str(os.cpu_count()),
+	}
+
+def Alloc(task):
+	before = readUsage()
+	start = time.perf_counter()
+
+	data = bytearray(int(task.get("mib", 0)) << 20)
+	page = os.sysconf("SC_PAGE_SIZE")
+	pattern = task.get("pattern", "") or "sequential"
+	for _ in range(max(1, int(task.get("passes", 1)))):
+		if pattern == "sequential":
+			offsets = range(0, len(data), page)
+		elif pattern == "random":
+			offsets = [p*page for p in random.sample(range(len(data)//page), len(data)//page)]
+		elif pattern == "strided":
+			stride = int(task.get("stride", 0)) or 16*page
+			offsets = (i for offset in range(0, stride, page) for i in range(offset, len(data), stride))
+		else:
+			raise ValueError("unknown access pattern %s"%pattern)
+		for i in offsets:
+			data[i] = (data[i]+1) % 256
+	touched = time.perf_counter() - start
+
+	rss = currentRSS()
+	time.sleep(int(task.get("hold_ms", 0))/1000)
+	after = readUsage()
+
+	return {
+		"job": "alloc",
+		"mib": str(task.get("mib", 0)),
+		"touch_ms": str(int(touched*1000)),
+		"rss": str(rss),
+		"max_rss": str(after.ru_maxrss*1024),
+		"minor_faults": str(after.ru_minflt-before.ru_minflt),
+		"major_faults": str(after.ru_majflt-before.ru_majflt),
+	}
+
+def Disk(task):
+	import tempfile
+	import shutil
+
+	files = int(task.get("files", 0))
+	if files < 1:
+		return {"job": "disk"}
+	size = int(task.get("size", 0))
+	block = int(task.get("block", 0))
+	if block <= 0 or block > size:
+		block = size
+	buffer = os.urandom(block)
+
+	directory = tempfile.mkdtemp(prefix="set-disk", dir=task.get("dir") or None)
+	phases = {"write": 0.0, "sync": 0.0, "read": 0.0, "remove": 0.0}
+	written = 0
+	read = 0
+	try:
+		names = [os.path.join(directory, "file_%d.bin"%i) for i in range(files)]
+		for name in names:
+			start = time.perf_counter()
+			with open(name, "wb") as f:
+				remaining = size
+				while remaining > 0:
+					written += f.write(buffer[:remaining])
+					remaining -= block
+				f.flush()
+				phases["write"] += time.perf_counter() - start
+				start = time.perf_counter()
+				os.fsync(f.fileno())
+				phases["sync"] += time.perf_counter() - start
+
+		for name in names:
+			start = time.perf_counter()
+			with open(name, "rb", buffering=0) as f:
+				while True:
+					chunk = f.read(block)
+					if not chunk:
+						break
+					read += len(chunk)
+			phases["read"] += time.perf_counter() - start
+
+		for name in names:
+			start = time.perf_counter()
+			os.remove(name)
+			phases["remove"] += time.perf_counter() - start
+	finally:
+		shutil.rmtree(directory, ignore_errors=True)
+
+	def throughput(n, duration):
+		return "%.0f"%(n/duration) if duration > 0 else "0"
+
+	def latency(phase):
+		return str(int(phases[phase]/files*1e6))
+
+	return {
+		"job": "disk",
+		"written": str(written),
+		"read": str(read),
+		"write_throughput": throughput(written, phases["write"]+phases["sync"]),
+		"read_throughput": throughput(read, phases["read"]),
+		"write_latency": latency("write"),
+		"fsync_latency": latency("sync"),
+		"read_latency": latency("read"),
+		"delete_latency": latency("remove"),
+	}
+
+def invokeStep(step):
+	prefix = "step.%s."%step["name"]
+	tags = {}
+	req = urllib.request.Request(step["target"], data=json.dumps(step["job"]).encode(), method="POST",
+		headers={"Content-Type": "application/json"})
+	start = time.perf_counter()
+	try:
+		with urllib.request.urlopen(req, timeout=900) as resp:
+			body = resp.read()
+	except Exception as e:
+		tags[prefix+"error"] = str(e)
+		raise
+	finally:
+		tags[prefix+"latency"] = str(int((time.perf_counter()-start)*1000))
+
+	try:
+		trace = json.loads(body)
+	except ValueError:
+		#the step ran, we just can't tell how long it took itself
+		return tags
+	execution = trace.get("ExecutionLatency") or {}
+	if execution:
+		tags[prefix+"execution"] = str(int(execution.get("seconds", 0)*1000 + execution.get("nanos", 0)/1e6))
+	for k, v in (trace.get("Tags") or {}).items():
+		if k.startswith("step."):
+			tags[k] = v
+	return tags
+
+def invokeNext(steps):
+	"""
+	invokes all steps in parallel and waits for them (fan-in)
+	"""
+	tags = {}
+	errors = []
+	lock = threading.Lock()
+
+	def run(step):
+		try:
+			result = invokeStep(step)
+		except Exception as e:
+			result = {"step.%s.error"%step["name"]: str(e)}
+			errors.append(e)
+		with lock:
+			tags.update(result)
+
+	threads = [threading.Thread(target=run, args=(step,)) for step in steps]
+	for t in threads:
+		t.start()
+	for t in threads:
+		t.join()
+	if errors:
+		raise errors[0]
+	return tags
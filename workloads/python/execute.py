@@ -0,0 +1,20 @@
+#!/usr/bin/env python
+"""
+Executes a job read from stdin without tracing and prints the result tags as json.
+Used by the conformance tests of the driver to compare the python and go workloads.
+"""
+import contextlib
+import json
+import sys
+
+from bencher import Execute
+
+if __name__ == "__main__":
+	try:
+		#keep stdout clean for the result, the workloads print their errors
+		with contextlib.redirect_stdout(sys.stderr):
+			tags = Execute(json.load(sys.stdin))
+	except Exception as e:
+		json.dump({"error": str(e)}, sys.stdout)
+		sys.exit(1)
+	json.dump(tags, sys.stdout)